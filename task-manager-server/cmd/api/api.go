@@ -4,15 +4,31 @@ import (
 	"database/sql"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/SibHelly/task-manager-server/config"
+	"github.com/SibHelly/task-manager-server/service/auth"
 	"github.com/SibHelly/task-manager-server/service/category"
 	"github.com/SibHelly/task-manager-server/service/chat"
+	"github.com/SibHelly/task-manager-server/service/checklist"
 	comments "github.com/SibHelly/task-manager-server/service/comment"
+	"github.com/SibHelly/task-manager-server/service/events"
 	"github.com/SibHelly/task-manager-server/service/group"
+	"github.com/SibHelly/task-manager-server/service/label"
+	"github.com/SibHelly/task-manager-server/service/notify"
 	"github.com/SibHelly/task-manager-server/service/priority"
+	"github.com/SibHelly/task-manager-server/service/ratelimit"
+	"github.com/SibHelly/task-manager-server/service/search"
+	"github.com/SibHelly/task-manager-server/service/stats"
 	"github.com/SibHelly/task-manager-server/service/status"
 	"github.com/SibHelly/task-manager-server/service/tasks"
+	"github.com/SibHelly/task-manager-server/service/template"
+	"github.com/SibHelly/task-manager-server/service/timetrack"
 	"github.com/SibHelly/task-manager-server/service/user"
+	"github.com/SibHelly/task-manager-server/service/view"
+	"github.com/SibHelly/task-manager-server/service/webhook"
+	"github.com/SibHelly/task-manager-server/types"
 	"github.com/gorilla/mux"
 )
 
@@ -54,35 +70,90 @@ func (s *APIServer) Run() error {
 
 	handler := enableCORS(router)
 
+	limitStore := ratelimit.NewMemoryStore()
+	apiLimiter := ratelimit.NewLimiter(limitStore, "api:", int(config.Envs.RateLimitPerMinute), time.Minute)
+	subrouter.Use(apiLimiter.Middleware)
+
 	userStore := user.NewStore(s.db)
-	userHandler := user.NewHandler(userStore)
+	var idp types.IdentityProvider
+	if config.Envs.OIDCIssuer != "" {
+		idp = auth.NewOIDCProvider(auth.OIDCConfig{
+			Issuer:       config.Envs.OIDCIssuer,
+			ClientID:     config.Envs.OIDCClientID,
+			ClientSecret: config.Envs.OIDCClientSecret,
+			RedirectURL:  config.Envs.OIDCRedirectURL,
+			Scopes:       strings.Fields(config.Envs.OIDCScopes),
+		}, nil)
+	}
+	userHandler := user.NewHandler(userStore, limitStore,
+		notify.FromConfig(config.Envs.NotifySender, config.Envs.NotifyFile),
+		notify.FromConfig(config.Envs.EmailSender, config.Envs.EmailFile), idp)
 	userHandler.RegisterRoutes(subrouter)
 
+	groupStore := group.NewStore(s.db)
+
 	statusStore := status.NewStore(s.db)
-	statusHandler := status.NewHandler(statusStore, userStore)
+	statusHandler := status.NewHandler(statusStore, groupStore, userStore)
 	statusHandler.RegisterRoutes(subrouter)
 
 	priorityStore := priority.NewStore(s.db)
-	priorityHandler := priority.NewHandler(priorityStore, userStore)
+	priorityHandler := priority.NewHandler(priorityStore, groupStore, userStore)
 	priorityHandler.RegisterRoutes(subrouter)
 
 	categoryStore := category.NewStore(s.db)
-	categoryHandler := category.NewHandler(categoryStore, userStore)
+	categoryHandler := category.NewHandler(categoryStore, groupStore, userStore)
 	categoryHandler.RegisterRoutes(subrouter)
 
-	groupStore := group.NewStore(s.db)
-	groupHandler := group.NewHandler(groupStore, userStore)
+	eventBus := events.NewBus()
+
+	groupHandler := group.NewHandler(groupStore, userStore, eventBus)
 	groupHandler.RegisterRoutes(subrouter)
 
 	taskStore := tasks.NewStore(s.db)
-	taskHandler := tasks.NewHandler(taskStore, userStore, priorityStore, statusStore, groupStore, categoryStore)
+	go taskStore.RunRebalancer(time.Duration(config.Envs.RankRebalanceInSeconds) * time.Second)
+	taskHandler := tasks.NewHandler(taskStore, userStore, priorityStore, statusStore, groupStore, categoryStore, eventBus)
 	taskHandler.RegisterRoutes(subrouter)
 
+	labelStore := label.NewStore(s.db)
+	labelHandler := label.NewHandler(labelStore, taskStore, groupStore, userStore)
+	labelHandler.RegisterRoutes(subrouter)
+
+	checklistStore := checklist.NewStore(s.db)
+	checklistHandler := checklist.NewHandler(checklistStore, taskStore, userStore)
+	checklistHandler.RegisterRoutes(subrouter)
+
+	templateStore := template.NewStore(s.db)
+	templateHandler := template.NewHandler(templateStore, taskStore, groupStore, userStore)
+	templateHandler.RegisterRoutes(subrouter)
+
+	viewStore := view.NewStore(s.db)
+	viewHandler := view.NewHandler(viewStore, taskStore, groupStore, userStore)
+	viewHandler.RegisterRoutes(subrouter)
+
+	timeStore := timetrack.NewStore(s.db)
+	timeHandler := timetrack.NewHandler(timeStore, taskStore, groupStore, userStore)
+	timeHandler.RegisterRoutes(subrouter)
+
+	statsStore := stats.NewStore(s.db)
+	statsHandler := stats.NewHandler(statsStore, groupStore, userStore)
+	statsHandler.RegisterRoutes(subrouter)
+
 	chatStore := chat.NewStore(s.db)
 	commnetStore := comments.NewStore(s.db)
-	chatHandler := chat.NewHandler(chatStore, commnetStore, userStore)
+	chatHandler := chat.NewHandler(chatStore, commnetStore, userStore, taskStore, eventBus)
 	chatHandler.RegisterRoutes(subrouter)
 
+	searchStore := search.NewStore(s.db)
+	searchHandler := search.NewHandler(searchStore, userStore)
+	searchHandler.RegisterRoutes(subrouter)
+
+	webhookStore := webhook.NewStore(s.db)
+	dispatcher := webhook.NewDispatcher(webhookStore, webhook.NewClient(10*time.Second))
+	eventBus.Subscribe(dispatcher.HandleEvent)
+	go dispatcher.Run(time.Duration(config.Envs.WebhookPollInSeconds) * time.Second)
+	webhookHandler := webhook.NewHandler(webhookStore, dispatcher, groupStore, userStore)
+	webhookHandler.RegisterRoutes(subrouter)
+
 	log.Println("Listening on", s.addr)
 
 	return http.ListenAndServe(s.addr, handler)
@@ -0,0 +1,3 @@
+ALTER TABLE `tasks`
+    DROP INDEX `idx_tasks_group_end_time`,
+    DROP COLUMN `estimate`;
@@ -0,0 +1,3 @@
+ALTER TABLE `tasks`
+    ADD COLUMN `estimate` INT NULL,
+    ADD INDEX `idx_tasks_group_end_time` (`group_id`, `end_time`);
@@ -0,0 +1,14 @@
+CREATE TABLE `time_entries` (
+    `entry_id` INT PRIMARY KEY AUTO_INCREMENT,
+    `task_id` INT NOT NULL,
+    `user_id` INT NOT NULL,
+    `started_at` DATETIME NOT NULL,
+    `ended_at` DATETIME,
+    `note` TEXT,
+    `running_user_id` INT AS (IF(`ended_at` IS NULL, `user_id`, NULL)) STORED,
+    FOREIGN KEY (`task_id`) REFERENCES `tasks`(`task_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    FOREIGN KEY (`user_id`) REFERENCES `users`(`user_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    UNIQUE KEY `unique_running_timer` (`running_user_id`),
+    KEY `idx_time_entries_task` (`task_id`),
+    KEY `idx_time_entries_user_started` (`user_id`, `started_at`)
+);
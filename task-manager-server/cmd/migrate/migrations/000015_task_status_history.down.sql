@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS `task_status_history`;
+
+ALTER TABLE `tasks`
+    DROP COLUMN `created_at`;
@@ -0,0 +1,17 @@
+ALTER TABLE `tasks`
+    ADD COLUMN `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+CREATE TABLE `task_status_history` (
+    `history_id` INT PRIMARY KEY AUTO_INCREMENT,
+    `task_id` INT NOT NULL,
+    `status_id` INT,
+    `entered_at` DATETIME NOT NULL,
+    `left_at` DATETIME,
+    FOREIGN KEY (`task_id`) REFERENCES `tasks`(`task_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    FOREIGN KEY (`status_id`) REFERENCES `status_map`(`status_id`) ON DELETE SET NULL ON UPDATE CASCADE,
+    KEY `idx_status_history_task` (`task_id`, `left_at`),
+    KEY `idx_status_history_status` (`status_id`, `entered_at`)
+);
+
+INSERT INTO `task_status_history` (`task_id`, `status_id`, `entered_at`)
+SELECT `task_id`, `status_id`, `created_at` FROM `tasks`;
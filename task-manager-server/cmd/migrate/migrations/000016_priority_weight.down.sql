@@ -0,0 +1,6 @@
+ALTER TABLE `status_map`
+    DROP COLUMN `is_blocked`,
+    DROP COLUMN `is_final`;
+
+ALTER TABLE `priority_map`
+    DROP COLUMN `weight`;
@@ -0,0 +1,14 @@
+ALTER TABLE `priority_map`
+    ADD COLUMN `weight` INT NOT NULL DEFAULT 0;
+
+ALTER TABLE `status_map`
+    ADD COLUMN `is_final` BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN `is_blocked` BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- status 1 is the one FinishTask moves tasks to
+UPDATE `status_map` SET `is_final` = TRUE WHERE `status_id` = 1;
+
+-- keep the old ordering: a lower priority_id used to mean more important
+UPDATE `priority_map` p
+JOIN (SELECT MAX(`priority_id`) AS `max_id` FROM `priority_map`) m
+SET p.`weight` = (m.`max_id` - p.`priority_id` + 1) * 10;
@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS `groups_priorities`;
+DROP TABLE IF EXISTS `users_priorities`;
+DROP TABLE IF EXISTS `groups_statuses`;
+DROP TABLE IF EXISTS `users_statuses`;
+
+ALTER TABLE `priority_map`
+    DROP COLUMN `position`;
+
+ALTER TABLE `status_map`
+    DROP COLUMN `position`,
+    DROP COLUMN `color`;
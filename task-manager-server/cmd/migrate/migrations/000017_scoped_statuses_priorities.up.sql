@@ -0,0 +1,45 @@
+ALTER TABLE `status_map`
+    ADD COLUMN `color` VARCHAR(20),
+    ADD COLUMN `position` INT NOT NULL DEFAULT 0;
+
+ALTER TABLE `priority_map`
+    ADD COLUMN `position` INT NOT NULL DEFAULT 0;
+
+UPDATE `status_map` SET `position` = `status_id`;
+UPDATE `priority_map` SET `position` = `priority_id`;
+
+CREATE TABLE `users_statuses` (
+    `users_statuses_id` INT PRIMARY KEY AUTO_INCREMENT,
+    `user_id` INT NOT NULL,
+    `status_id` INT NOT NULL,
+    FOREIGN KEY (`user_id`) REFERENCES `users`(`user_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    FOREIGN KEY (`status_id`) REFERENCES `status_map`(`status_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    UNIQUE KEY `unique_user_status` (`user_id`, `status_id`)
+);
+
+CREATE TABLE `groups_statuses` (
+    `groups_statuses_id` INT PRIMARY KEY AUTO_INCREMENT,
+    `group_id` INT NOT NULL,
+    `status_id` INT NOT NULL,
+    FOREIGN KEY (`group_id`) REFERENCES `groups`(`group_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    FOREIGN KEY (`status_id`) REFERENCES `status_map`(`status_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    UNIQUE KEY `unique_group_status` (`group_id`, `status_id`)
+);
+
+CREATE TABLE `users_priorities` (
+    `users_priorities_id` INT PRIMARY KEY AUTO_INCREMENT,
+    `user_id` INT NOT NULL,
+    `priority_id` INT NOT NULL,
+    FOREIGN KEY (`user_id`) REFERENCES `users`(`user_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    FOREIGN KEY (`priority_id`) REFERENCES `priority_map`(`priority_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    UNIQUE KEY `unique_user_priority` (`user_id`, `priority_id`)
+);
+
+CREATE TABLE `groups_priorities` (
+    `groups_priorities_id` INT PRIMARY KEY AUTO_INCREMENT,
+    `group_id` INT NOT NULL,
+    `priority_id` INT NOT NULL,
+    FOREIGN KEY (`group_id`) REFERENCES `groups`(`group_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    FOREIGN KEY (`priority_id`) REFERENCES `priority_map`(`priority_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    UNIQUE KEY `unique_group_priority` (`group_id`, `priority_id`)
+);
@@ -0,0 +1,20 @@
+CREATE TABLE `labels` (
+    `label_id` INT PRIMARY KEY AUTO_INCREMENT,
+    `label_name` VARCHAR(50) NOT NULL,
+    `color` VARCHAR(20),
+    `user_id` INT,
+    `group_id` INT,
+    FOREIGN KEY (`user_id`) REFERENCES `users`(`user_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    FOREIGN KEY (`group_id`) REFERENCES `groups`(`group_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    UNIQUE KEY `unique_user_label` (`user_id`, `label_name`),
+    UNIQUE KEY `unique_group_label` (`group_id`, `label_name`)
+);
+
+CREATE TABLE `task_labels` (
+    `task_id` INT NOT NULL,
+    `label_id` INT NOT NULL,
+    PRIMARY KEY (`task_id`, `label_id`),
+    FOREIGN KEY (`task_id`) REFERENCES `tasks`(`task_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    FOREIGN KEY (`label_id`) REFERENCES `labels`(`label_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    KEY `idx_task_labels_label` (`label_id`)
+);
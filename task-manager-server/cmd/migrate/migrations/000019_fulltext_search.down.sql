@@ -0,0 +1,8 @@
+ALTER TABLE `comments`
+    DROP INDEX `ft_comments_text`;
+
+ALTER TABLE `chats`
+    DROP INDEX `ft_chats_name`;
+
+ALTER TABLE `tasks`
+    DROP INDEX `ft_tasks_name_description`;
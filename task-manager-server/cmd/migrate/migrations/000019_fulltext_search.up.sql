@@ -0,0 +1,8 @@
+ALTER TABLE `tasks`
+    ADD FULLTEXT INDEX `ft_tasks_name_description` (`task_name`, `task_description`);
+
+ALTER TABLE `chats`
+    ADD FULLTEXT INDEX `ft_chats_name` (`chat_name`);
+
+ALTER TABLE `comments`
+    ADD FULLTEXT INDEX `ft_comments_text` (`comment_text`);
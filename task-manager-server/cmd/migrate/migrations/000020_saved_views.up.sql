@@ -0,0 +1,13 @@
+CREATE TABLE `saved_views` (
+    `view_id` INT PRIMARY KEY AUTO_INCREMENT,
+    `user_id` INT NOT NULL,
+    `group_id` INT,
+    `view_name` VARCHAR(100) NOT NULL,
+    `filter` JSON NOT NULL,
+    `sort` VARCHAR(20) NOT NULL,
+    `group_by` VARCHAR(20),
+    `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (`user_id`) REFERENCES `users`(`user_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    FOREIGN KEY (`group_id`) REFERENCES `groups`(`group_id`) ON DELETE SET NULL ON UPDATE CASCADE,
+    UNIQUE KEY `unique_user_view` (`user_id`, `view_name`)
+);
@@ -0,0 +1,14 @@
+CREATE TABLE `task_positions` (
+    `position_id` INT PRIMARY KEY AUTO_INCREMENT,
+    `task_id` INT NOT NULL,
+    `user_id` INT,
+    `group_id` INT,
+    `sort_rank` VARCHAR(64) CHARACTER SET ascii COLLATE ascii_bin NOT NULL,
+    FOREIGN KEY (`task_id`) REFERENCES `tasks`(`task_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    FOREIGN KEY (`user_id`) REFERENCES `users`(`user_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    FOREIGN KEY (`group_id`) REFERENCES `groups`(`group_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    UNIQUE KEY `unique_user_task_position` (`task_id`, `user_id`),
+    UNIQUE KEY `unique_group_task_position` (`task_id`, `group_id`),
+    KEY `idx_task_positions_user` (`user_id`, `sort_rank`),
+    KEY `idx_task_positions_group` (`group_id`, `sort_rank`)
+);
@@ -0,0 +1,12 @@
+CREATE TABLE `checklist_items` (
+    `item_id` INT PRIMARY KEY AUTO_INCREMENT,
+    `task_id` INT NOT NULL,
+    `item_text` VARCHAR(500) NOT NULL,
+    `position` INT NOT NULL DEFAULT 0,
+    `is_checked` BOOLEAN NOT NULL DEFAULT FALSE,
+    `checked_by` INT,
+    `checked_at` DATETIME,
+    FOREIGN KEY (`task_id`) REFERENCES `tasks`(`task_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    FOREIGN KEY (`checked_by`) REFERENCES `users`(`user_id`) ON DELETE SET NULL ON UPDATE CASCADE,
+    KEY `idx_checklist_items_task` (`task_id`, `position`)
+);
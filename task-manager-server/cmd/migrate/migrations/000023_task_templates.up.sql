@@ -0,0 +1,12 @@
+CREATE TABLE `task_templates` (
+    `template_id` INT PRIMARY KEY AUTO_INCREMENT,
+    `template_name` VARCHAR(100) NOT NULL,
+    `user_id` INT,
+    `group_id` INT,
+    `task` JSON NOT NULL,
+    `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (`user_id`) REFERENCES `users`(`user_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    FOREIGN KEY (`group_id`) REFERENCES `groups`(`group_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    UNIQUE KEY `unique_user_template` (`user_id`, `template_name`),
+    UNIQUE KEY `unique_group_template` (`group_id`, `template_name`)
+);
@@ -0,0 +1,10 @@
+CREATE TABLE `task_watchers` (
+    `task_id` INT NOT NULL,
+    `user_id` INT NOT NULL,
+    `reason` VARCHAR(20) NOT NULL,
+    `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (`task_id`, `user_id`),
+    FOREIGN KEY (`task_id`) REFERENCES `tasks`(`task_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    FOREIGN KEY (`user_id`) REFERENCES `users`(`user_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    KEY `idx_task_watchers_user` (`user_id`)
+);
@@ -0,0 +1,29 @@
+CREATE TABLE `webhooks` (
+    `webhook_id` INT PRIMARY KEY AUTO_INCREMENT,
+    `group_id` INT NOT NULL,
+    `url` VARCHAR(2000) NOT NULL,
+    `secret` VARCHAR(128) NOT NULL,
+    `events` JSON NOT NULL,
+    `is_active` BOOLEAN NOT NULL DEFAULT TRUE,
+    `created_by` INT,
+    `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (`group_id`) REFERENCES `groups`(`group_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    FOREIGN KEY (`created_by`) REFERENCES `users`(`user_id`) ON DELETE SET NULL ON UPDATE CASCADE
+);
+
+CREATE TABLE `webhook_deliveries` (
+    `delivery_id` INT PRIMARY KEY AUTO_INCREMENT,
+    `webhook_id` INT NOT NULL,
+    `event_type` VARCHAR(50) NOT NULL,
+    `payload` MEDIUMTEXT NOT NULL,
+    `status` VARCHAR(20) NOT NULL DEFAULT 'pending',
+    `attempts` INT NOT NULL DEFAULT 0,
+    `next_attempt_at` DATETIME NOT NULL,
+    `last_attempt_at` DATETIME,
+    `response_code` INT,
+    `error` TEXT,
+    `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (`webhook_id`) REFERENCES `webhooks`(`webhook_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    KEY `idx_webhook_deliveries_due` (`status`, `next_attempt_at`),
+    KEY `idx_webhook_deliveries_webhook` (`webhook_id`, `created_at`)
+);
@@ -0,0 +1,15 @@
+CREATE TABLE `api_tokens` (
+    `token_id` INT PRIMARY KEY AUTO_INCREMENT,
+    `user_id` INT NOT NULL,
+    `token_name` VARCHAR(100) NOT NULL,
+    `token_hash` CHAR(64) NOT NULL,
+    `token_prefix` VARCHAR(16) NOT NULL,
+    `scopes` JSON NOT NULL,
+    `expires_at` DATETIME,
+    `last_used_at` DATETIME,
+    `revoked_at` DATETIME,
+    `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (`user_id`) REFERENCES `users`(`user_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    UNIQUE KEY `unique_token_hash` (`token_hash`),
+    KEY `idx_api_tokens_user` (`user_id`)
+);
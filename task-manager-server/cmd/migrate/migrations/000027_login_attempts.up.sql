@@ -0,0 +1,12 @@
+CREATE TABLE `login_attempts` (
+    `attempt_id` INT PRIMARY KEY AUTO_INCREMENT,
+    `phone` VARCHAR(15) NOT NULL,
+    `user_id` INT,
+    `ip` VARCHAR(45) NOT NULL,
+    `success` BOOLEAN NOT NULL,
+    `reason` VARCHAR(20),
+    `created_at` DATETIME NOT NULL,
+    FOREIGN KEY (`user_id`) REFERENCES `users`(`user_id`) ON DELETE SET NULL ON UPDATE CASCADE,
+    KEY `idx_login_attempts_phone` (`phone`, `created_at`),
+    KEY `idx_login_attempts_ip` (`ip`, `created_at`)
+);
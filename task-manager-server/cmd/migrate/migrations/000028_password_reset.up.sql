@@ -0,0 +1,13 @@
+ALTER TABLE `users`
+    ADD COLUMN `token_version` INT NOT NULL DEFAULT 0;
+
+CREATE TABLE `password_resets` (
+    `reset_id` INT PRIMARY KEY AUTO_INCREMENT,
+    `user_id` INT NOT NULL,
+    `code_hash` CHAR(64) NOT NULL,
+    `expires_at` DATETIME NOT NULL,
+    `used_at` DATETIME,
+    `created_at` DATETIME NOT NULL,
+    FOREIGN KEY (`user_id`) REFERENCES `users`(`user_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    KEY `idx_password_resets_user` (`user_id`, `used_at`)
+);
@@ -0,0 +1,12 @@
+DELETE FROM `comments` WHERE `sender_id` IS NULL;
+
+ALTER TABLE `comments`
+    DROP FOREIGN KEY `fk_comments_sender`;
+ALTER TABLE `comments`
+    MODIFY `sender_id` INT NOT NULL,
+    ADD CONSTRAINT `comments_ibfk_2` FOREIGN KEY (`sender_id`) REFERENCES `users`(`user_id`) ON UPDATE CASCADE;
+
+ALTER TABLE `users`
+    DROP COLUMN `locale`,
+    DROP COLUMN `timezone`,
+    DROP COLUMN `avatar`;
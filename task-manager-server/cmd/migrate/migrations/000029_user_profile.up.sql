@@ -0,0 +1,11 @@
+ALTER TABLE `users`
+    ADD COLUMN `avatar` VARCHAR(255),
+    ADD COLUMN `timezone` VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    ADD COLUMN `locale` VARCHAR(16) NOT NULL DEFAULT 'en';
+
+-- comments outlive their sender: a deleted account leaves them unsigned
+ALTER TABLE `comments`
+    DROP FOREIGN KEY `comments_ibfk_2`;
+ALTER TABLE `comments`
+    MODIFY `sender_id` INT NULL,
+    ADD CONSTRAINT `fk_comments_sender` FOREIGN KEY (`sender_id`) REFERENCES `users`(`user_id`) ON DELETE SET NULL ON UPDATE CASCADE;
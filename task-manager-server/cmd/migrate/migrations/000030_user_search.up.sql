@@ -0,0 +1,3 @@
+ALTER TABLE `users`
+    ADD COLUMN `searchable` BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD KEY `idx_users_name` (`name`);
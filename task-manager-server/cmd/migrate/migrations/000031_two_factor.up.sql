@@ -0,0 +1,17 @@
+ALTER TABLE `users`
+    ADD COLUMN `totp_secret` VARCHAR(64),
+    ADD COLUMN `totp_enabled` BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN `totp_last_step` BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE `recovery_codes` (
+    `code_id` INT PRIMARY KEY AUTO_INCREMENT,
+    `user_id` INT NOT NULL,
+    `code_hash` CHAR(64) NOT NULL,
+    `used_at` DATETIME,
+    `created_at` DATETIME NOT NULL,
+    FOREIGN KEY (`user_id`) REFERENCES `users`(`user_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    KEY `idx_recovery_codes_user` (`user_id`, `code_hash`)
+);
+
+ALTER TABLE `groups`
+    ADD COLUMN `require_2fa` BOOLEAN NOT NULL DEFAULT FALSE;
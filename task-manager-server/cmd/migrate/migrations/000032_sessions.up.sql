@@ -0,0 +1,12 @@
+CREATE TABLE `sessions` (
+    `session_id` INT PRIMARY KEY AUTO_INCREMENT,
+    `user_id` INT NOT NULL,
+    `user_agent` VARCHAR(255) NOT NULL DEFAULT '',
+    `ip` VARCHAR(45) NOT NULL DEFAULT '',
+    `created_at` DATETIME NOT NULL,
+    `last_seen_at` DATETIME NOT NULL,
+    `expires_at` DATETIME NOT NULL,
+    `revoked_at` DATETIME,
+    FOREIGN KEY (`user_id`) REFERENCES `users`(`user_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    KEY `idx_sessions_user` (`user_id`, `revoked_at`)
+);
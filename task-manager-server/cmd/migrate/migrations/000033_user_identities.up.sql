@@ -0,0 +1,9 @@
+CREATE TABLE `user_identities` (
+    `identity_id` INT PRIMARY KEY AUTO_INCREMENT,
+    `user_id` INT NOT NULL,
+    `issuer` VARCHAR(255) NOT NULL,
+    `subject` VARCHAR(255) NOT NULL,
+    `created_at` DATETIME NOT NULL,
+    FOREIGN KEY (`user_id`) REFERENCES `users`(`user_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    UNIQUE KEY `uq_user_identities_subject` (`issuer`, `subject`)
+);
@@ -0,0 +1,11 @@
+UPDATE `login_attempts` SET `login` = LEFT(`login`, 15);
+ALTER TABLE `login_attempts`
+    RENAME INDEX `idx_login_attempts_login` TO `idx_login_attempts_phone`,
+    CHANGE COLUMN `login` `phone` VARCHAR(15) NOT NULL;
+
+DROP TABLE IF EXISTS `email_verifications`;
+
+ALTER TABLE `users`
+    DROP INDEX `uq_users_email`,
+    DROP COLUMN `contact_visibility`,
+    DROP COLUMN `email`;
@@ -0,0 +1,20 @@
+ALTER TABLE `users`
+    ADD COLUMN `email` VARCHAR(254),
+    ADD COLUMN `contact_visibility` VARCHAR(10) NOT NULL DEFAULT 'phone',
+    ADD UNIQUE KEY `uq_users_email` (`email`);
+
+CREATE TABLE `email_verifications` (
+    `verification_id` INT PRIMARY KEY AUTO_INCREMENT,
+    `user_id` INT NOT NULL,
+    `email` VARCHAR(254) NOT NULL,
+    `code_hash` CHAR(64) NOT NULL,
+    `expires_at` DATETIME NOT NULL,
+    `used_at` DATETIME,
+    `created_at` DATETIME NOT NULL,
+    FOREIGN KEY (`user_id`) REFERENCES `users`(`user_id`) ON DELETE CASCADE ON UPDATE CASCADE,
+    KEY `idx_email_verifications_user` (`user_id`, `used_at`)
+);
+
+ALTER TABLE `login_attempts`
+    CHANGE COLUMN `phone` `login` VARCHAR(254) NOT NULL,
+    RENAME INDEX `idx_login_attempts_phone` TO `idx_login_attempts_login`;
@@ -17,6 +17,21 @@ type Config struct {
 	DBName                  string
 	JWTExpirastionInSeconds int64
 	JWTSecret               string
+	RankRebalanceInSeconds  int64
+	WebhookPollInSeconds    int64
+	RateLimitPerMinute      int64
+	LoginMaxFailures        int64
+	NotifySender            string
+	NotifyFile              string
+	EmailSender             string
+	EmailFile               string
+	UploadDir               string
+	OIDCIssuer              string
+	OIDCClientID            string
+	OIDCClientSecret        string
+	OIDCRedirectURL         string
+	OIDCScopes              string
+	OIDCAutoCreate          bool
 }
 
 var Envs = initConfig()
@@ -32,6 +47,21 @@ func initConfig() Config {
 		DBName:                  getEnv("DB_NAME", "plane_task_db"),
 		JWTExpirastionInSeconds: getEnvAsInt("JWT_EXP", 3600*24*7),
 		JWTSecret:               getEnv("JWT_SECRET", "its secret or no"),
+		RankRebalanceInSeconds:  getEnvAsPositiveInt("RANK_REBALANCE_INTERVAL", 3600),
+		WebhookPollInSeconds:    getEnvAsPositiveInt("WEBHOOK_POLL_INTERVAL", 5),
+		RateLimitPerMinute:      getEnvAsInt("RATE_LIMIT_PER_MINUTE", 300),
+		LoginMaxFailures:        getEnvAsInt("LOGIN_MAX_FAILURES", 5),
+		NotifySender:            getEnv("NOTIFY_SENDER", "log"),
+		NotifyFile:              getEnv("NOTIFY_FILE", "messages.txt"),
+		EmailSender:             getEnv("EMAIL_SENDER", "log"),
+		EmailFile:               getEnv("EMAIL_FILE", "emails.txt"),
+		UploadDir:               getEnv("UPLOAD_DIR", "uploads"),
+		OIDCIssuer:              getEnv("OIDC_ISSUER", ""),
+		OIDCClientID:            getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret:        getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:         getEnv("OIDC_REDIRECT_URL", ""),
+		OIDCScopes:              getEnv("OIDC_SCOPES", "openid profile phone email"),
+		OIDCAutoCreate:          getEnvAsBool("OIDC_AUTO_CREATE", true),
 	}
 }
 
@@ -54,3 +84,24 @@ func getEnvAsInt(key string, fallback int64) int64 {
 
 	return fallback
 }
+
+// getEnvAsPositiveInt is getEnvAsInt for intervals, which must be above
+// zero: anything else falls back.
+func getEnvAsPositiveInt(key string, fallback int64) int64 {
+	if i := getEnvAsInt(key, fallback); i > 0 {
+		return i
+	}
+	return fallback
+}
+
+func getEnvAsBool(key string, fallback bool) bool {
+	if value, ok := os.LookupEnv(key); ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fallback
+		}
+		return b
+	}
+
+	return fallback
+}
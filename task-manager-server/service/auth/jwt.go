@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/SibHelly/task-manager-server/config"
@@ -16,14 +17,28 @@ import (
 
 type contextKey string
 
-const UserKey contextKey = "userID"
+const (
+	UserKey    contextKey = "userID"
+	SessionKey contextKey = "sessionID"
+)
+
+// A challenge token proves the password was right while the second factor
+// is still to come. It is short-lived and WithJWTAuth does not accept it.
+const (
+	challengePurpose = "2fa"
+	challengeTTL     = 5 * time.Minute
+)
 
-func CreateJWT(secret []byte, userID int) (string, error) {
+// CreateJWT signs a session token. The token stops working once the user's
+// token version moves past tokenVersion, or the session is revoked.
+func CreateJWT(secret []byte, userID, tokenVersion, sessionID int) (string, error) {
 	expiration := time.Second * time.Duration(config.Envs.JWTExpirastionInSeconds)
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userID":    strconv.Itoa(userID),
-		"expiredAt": time.Now().Add(expiration).Unix(),
+		"userID":       strconv.Itoa(userID),
+		"tokenVersion": tokenVersion,
+		"sessionID":    sessionID,
+		"expiredAt":    time.Now().Add(expiration).Unix(),
 	})
 
 	tokenString, err := token.SignedString(secret)
@@ -34,43 +49,95 @@ func CreateJWT(secret []byte, userID int) (string, error) {
 	return tokenString, nil
 }
 
+// CreateChallengeJWT signs the token handed out between the password and
+// the second factor of a login.
+func CreateChallengeJWT(secret []byte, userID, tokenVersion int) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userID":       strconv.Itoa(userID),
+		"tokenVersion": tokenVersion,
+		"purpose":      challengePurpose,
+		"expiredAt":    time.Now().Add(challengeTTL).Unix(),
+	})
+
+	return token.SignedString(secret)
+}
+
+// ParseChallengeJWT returns the user and token version of a challenge token
+// that is valid and not expired.
+func ParseChallengeJWT(tokenString string) (int, int, error) {
+	token, err := validateJWT(tokenString)
+	if err != nil || !token.Valid {
+		return 0, 0, fmt.Errorf("invalid challenge token")
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	if claims["purpose"] != challengePurpose {
+		return 0, 0, fmt.Errorf("invalid challenge token")
+	}
+	if exp, ok := claims["expiredAt"].(float64); !ok || time.Now().Unix() > int64(exp) {
+		return 0, 0, fmt.Errorf("challenge token expired, log in again")
+	}
+
+	str, _ := claims["userID"].(string)
+	userID, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid challenge token")
+	}
+	version, _ := claims["tokenVersion"].(float64)
+
+	return userID, int(version), nil
+}
+
+// WithJWTAuth lets the request through with a valid JWT or an API token
+// whose scopes cover it.
 func WithJWTAuth(handlerFunc http.HandlerFunc, store types.UserStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		tokenString := utils.GetTokenFromRequest(r)
+		tokenString := strings.TrimPrefix(utils.GetTokenFromRequest(r), "Bearer ")
 
-		token, err := validateJWT(tokenString)
-		if err != nil {
-			log.Printf("failed to validate token: %v", err)
-			permissionDenied(w)
-			return
+		var userID, sessionID int
+		version := -1
+		if IsAPIToken(tokenString) {
+			id, err := userFromAPIToken(tokenString, r, store)
+			if err != nil {
+				log.Printf("failed to validate api token: %v", err)
+				permissionDenied(w)
+				return
+			}
+			userID = id
+		} else {
+			c, ok := userFromJWT(tokenString)
+			if !ok {
+				permissionDenied(w)
+				return
+			}
+			userID, version, sessionID = c.userID, c.version, c.sessionID
 		}
 
-		if !token.Valid {
-			log.Println("invalid token")
+		u, err := store.GetUserById(userID)
+		if err != nil {
+			log.Printf("failed to get user by id: %v", err)
 			permissionDenied(w)
 			return
 		}
 
-		claims := token.Claims.(jwt.MapClaims)
-		str := claims["userID"].(string)
-
-		userID, err := strconv.Atoi(str)
-		if err != nil {
-			log.Printf("failed to convert userID to int: %v", err)
+		if version >= 0 && version != u.TokenVersion {
+			log.Printf("token of user %d is from before a sign out", u.ID)
 			permissionDenied(w)
 			return
 		}
 
-		u, err := store.GetUserById(userID)
-		if err != nil {
-			log.Printf("failed to get user by id: %v", err)
-			permissionDenied(w)
-			return
+		if sessionID != 0 {
+			if err := checkSession(store, sessionID, u.ID); err != nil {
+				log.Printf("session %d of user %d: %v", sessionID, u.ID, err)
+				permissionDenied(w)
+				return
+			}
 		}
 
 		// Add the user to the context
 		ctx := r.Context()
 		ctx = context.WithValue(ctx, UserKey, u.ID)
+		ctx = context.WithValue(ctx, SessionKey, sessionID)
 		r = r.WithContext(ctx)
 
 		// Call the function if the token is valid
@@ -78,6 +145,88 @@ func WithJWTAuth(handlerFunc http.HandlerFunc, store types.UserStore) http.Handl
 	}
 }
 
+// sessionClaims is what a session JWT says about its holder.
+type sessionClaims struct {
+	userID    int
+	version   int
+	sessionID int
+}
+
+// userFromJWT returns the claims of a valid session JWT. Tokens issued
+// before versions existed count as version 0; tokens without a session are
+// refused, since they could not be revoked.
+func userFromJWT(tokenString string) (sessionClaims, bool) {
+	var c sessionClaims
+	token, err := validateJWT(tokenString)
+	if err != nil {
+		log.Printf("failed to validate token: %v", err)
+		return c, false
+	}
+
+	if !token.Valid {
+		log.Println("invalid token")
+		return c, false
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	if _, ok := claims["purpose"]; ok {
+		log.Println("token is not a session token")
+		return c, false
+	}
+
+	str, ok := claims["userID"].(string)
+	if !ok {
+		log.Println("token has no userID")
+		return c, false
+	}
+
+	c.userID, err = strconv.Atoi(str)
+	if err != nil {
+		log.Printf("failed to convert userID to int: %v", err)
+		return c, false
+	}
+
+	if v, ok := claims["tokenVersion"].(float64); ok {
+		c.version = int(v)
+	}
+
+	id, ok := claims["sessionID"].(float64)
+	if !ok || id <= 0 {
+		log.Println("token has no session")
+		return c, false
+	}
+	c.sessionID = int(id)
+
+	return c, true
+}
+
+// checkSession makes sure the session is the user's, not revoked and not
+// expired, and records that it was seen, at most once a minute.
+func checkSession(store types.UserStore, sessionID, userID int) error {
+	s, err := store.GetSession(sessionID)
+	if err != nil {
+		return err
+	}
+	if s.UserID != userID {
+		return fmt.Errorf("session belongs to another user")
+	}
+	if s.RevokedAt != nil {
+		return fmt.Errorf("session revoked")
+	}
+
+	now := time.Now().UTC()
+	if !now.Before(s.ExpiresAt) {
+		return fmt.Errorf("session expired")
+	}
+
+	if now.Sub(s.LastSeenAt) >= tokenTouchInterval {
+		if err := store.TouchSession(s.ID, now); err != nil {
+			log.Printf("failed to touch session %d: %v", s.ID, err)
+		}
+	}
+	return nil
+}
+
 func validateJWT(tokenString string) (*jwt.Token, error) {
 	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -92,6 +241,13 @@ func permissionDenied(w http.ResponseWriter) {
 	utils.WriteError(w, http.StatusForbidden, fmt.Errorf("permission denied"))
 }
 
+// GetSessionIDFromContext returns the session of the request, or 0 when it
+// came with an API token.
+func GetSessionIDFromContext(ctx context.Context) int {
+	sessionID, _ := ctx.Value(SessionKey).(int)
+	return sessionID
+}
+
 func GetUserIDFromContext(ctx context.Context) int {
 	userID, ok := ctx.Value(UserKey).(int)
 	if !ok {
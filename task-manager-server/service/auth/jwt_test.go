@@ -1,13 +1,19 @@
 package auth
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/SibHelly/task-manager-server/config"
+	"github.com/SibHelly/task-manager-server/types"
 )
 
 func TestCreateJWT(t *testing.T) {
 	secret := []byte("secret")
 
-	token, err := CreateJWT(secret, 1)
+	token, err := CreateJWT(secret, 1, 0, 1)
 	if err != nil {
 		t.Errorf("error creating JWT: %v", err)
 	}
@@ -16,3 +22,81 @@ func TestCreateJWT(t *testing.T) {
 		t.Error("expected token to be not empty")
 	}
 }
+
+func TestChallengeJWT(t *testing.T) {
+	secret := []byte(config.Envs.JWTSecret)
+
+	challenge, err := CreateChallengeJWT(secret, 7, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userID, version, err := ParseChallengeJWT(challenge)
+	if err != nil || userID != 7 || version != 2 {
+		t.Errorf("ParseChallengeJWT = %d, %d, %v", userID, version, err)
+	}
+	if _, ok := userFromJWT(challenge); ok {
+		t.Error("challenge token should not work as a session token")
+	}
+
+	session, err := CreateJWT(secret, 7, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ParseChallengeJWT(session); err == nil {
+		t.Error("session token should not work as a challenge token")
+	}
+}
+
+func TestWithJWTAuthSession(t *testing.T) {
+	secret := []byte(config.Envs.JWTSecret)
+	now := time.Now().UTC()
+	revoked := now.Add(-time.Minute)
+	store := &tokenStore{sessions: map[int]*types.Session{
+		1: {ID: 1, UserID: 10, LastSeenAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour)},
+		2: {ID: 2, UserID: 10, LastSeenAt: now, ExpiresAt: now.Add(time.Hour), RevokedAt: &revoked},
+		3: {ID: 3, UserID: 10, LastSeenAt: now, ExpiresAt: now.Add(-time.Second)},
+		4: {ID: 4, UserID: 11, LastSeenAt: now, ExpiresAt: now.Add(time.Hour)},
+	}}
+
+	tests := []struct {
+		name      string
+		sessionID int
+		want      int
+	}{
+		{"active", 1, http.StatusOK},
+		{"revoked", 2, http.StatusForbidden},
+		{"expired", 3, http.StatusForbidden},
+		{"someone else's", 4, http.StatusForbidden},
+		{"unknown", 5, http.StatusForbidden},
+		{"none", 0, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		token, err := CreateJWT(secret, 10, 0, tt.sessionID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var gotSession int
+		h := WithJWTAuth(func(w http.ResponseWriter, r *http.Request) {
+			gotSession = GetSessionIDFromContext(r.Context())
+		}, store)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/tasks", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		h(rr, req)
+
+		if rr.Code != tt.want {
+			t.Errorf("%s session: status %d, want %d", tt.name, rr.Code, tt.want)
+		}
+		if tt.want == http.StatusOK && gotSession != tt.sessionID {
+			t.Errorf("%s session: session %d in context", tt.name, gotSession)
+		}
+	}
+
+	if !store.sessions[1].LastSeenAt.After(now.Add(-time.Minute)) {
+		t.Error("last use of the session was not recorded")
+	}
+}
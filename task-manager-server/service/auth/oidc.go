@@ -0,0 +1,348 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SibHelly/task-manager-server/types"
+	"github.com/golang-jwt/jwt"
+)
+
+// A flow token carries the state, nonce and PKCE verifier of one OIDC login
+// from its start to the callback, so the server keeps nothing in between.
+const (
+	oidcFlowPurpose = "oidc"
+	oidcFlowTTL     = 10 * time.Minute
+	jwksRefetchWait = time.Minute
+)
+
+// OIDCConfig is the client registration at the provider.
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// OIDCProvider logs users in with an OpenID Connect provider, using the
+// authorization code flow with PKCE. The discovery document and signing
+// keys are fetched on first use and cached.
+type OIDCProvider struct {
+	cfg    OIDCConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]*rsa.PublicKey
+	keysAt    time.Time
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewOIDCProvider talks to the provider through client, or through a client
+// with a short timeout when it is nil.
+func NewOIDCProvider(cfg OIDCConfig, client *http.Client) *OIDCProvider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid"}
+	}
+	return &OIDCProvider{cfg: cfg, client: client}
+}
+
+func (p *OIDCProvider) Issuer() string {
+	return p.cfg.Issuer
+}
+
+func (p *OIDCProvider) AuthURL(state, nonce, codeChallenge string) (string, error) {
+	d, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.cfg.RedirectURL)
+	q.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange redeems the code at the token endpoint and verifies the ID token
+// it returns: signature, issuer, audience, expiry and nonce.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*types.Identity, error) {
+	d, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("client_id", p.cfg.ClientID)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint answered %d: %s", resp.StatusCode, body)
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, fmt.Errorf("token endpoint: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("token endpoint returned no id_token")
+	}
+
+	return p.verifyIDToken(tokens.IDToken, nonce)
+}
+
+func (p *OIDCProvider) verifyIDToken(raw, nonce string) (*types.Identity, error) {
+	token, err := jwt.Parse(raw, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.key(kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	if claims["iss"] != p.cfg.Issuer {
+		return nil, fmt.Errorf("id_token is from another issuer")
+	}
+	if !claims.VerifyAudience(p.cfg.ClientID, true) {
+		return nil, fmt.Errorf("id_token is for another client")
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, fmt.Errorf("id_token has no expiry")
+	}
+	if claims["nonce"] != nonce {
+		return nil, fmt.Errorf("id_token nonce does not match")
+	}
+
+	id := &types.Identity{Issuer: p.cfg.Issuer}
+	id.Subject, _ = claims["sub"].(string)
+	if id.Subject == "" {
+		return nil, fmt.Errorf("id_token has no subject")
+	}
+	id.Name, _ = claims["name"].(string)
+	if id.Name == "" {
+		id.Name, _ = claims["preferred_username"].(string)
+	}
+	id.Phone, _ = claims["phone_number"].(string)
+	id.PhoneVerified, _ = claims["phone_number_verified"].(bool)
+	id.Email, _ = claims["email"].(string)
+	id.EmailVerified, _ = claims["email_verified"].(bool)
+
+	return id, nil
+}
+
+func (p *OIDCProvider) discover() (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	d := new(oidcDiscovery)
+	if err := p.getJSON(strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", d); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if d.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer is %q, want %q", d.Issuer, p.cfg.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc discovery: endpoints missing")
+	}
+
+	p.discovery = d
+	return d, nil
+}
+
+// key returns the signing key kid, fetching the key set again when the
+// provider may have rotated its keys.
+func (p *OIDCProvider) key(kid string) (*rsa.PublicKey, error) {
+	d, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if k, ok := p.keys[kid]; ok {
+		return k, nil
+	}
+	if p.keys != nil && time.Since(p.keysAt) < jwksRefetchWait {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(d.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("oidc keys: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	p.keys, p.keysAt = keys, time.Now()
+
+	k, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return k, nil
+}
+
+func (p *OIDCProvider) getJSON(url string, v interface{}) error {
+	resp, err := p.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// OIDCFlow is what the callback of a login needs from its start.
+type OIDCFlow struct {
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+// NewOIDCFlow starts a login: it makes the state, nonce and PKCE verifier,
+// and returns them with the signed flow token that carries them to the
+// callback, and the PKCE challenge for the provider.
+func NewOIDCFlow(secret []byte) (OIDCFlow, string, string, error) {
+	var f OIDCFlow
+	for _, s := range []*string{&f.State, &f.Nonce, &f.Verifier} {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return f, "", "", err
+		}
+		*s = base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"purpose":   oidcFlowPurpose,
+		"state":     f.State,
+		"nonce":     f.Nonce,
+		"verifier":  f.Verifier,
+		"expiredAt": time.Now().Add(oidcFlowTTL).Unix(),
+	})
+	signed, err := token.SignedString(secret)
+	if err != nil {
+		return f, "", "", err
+	}
+
+	return f, signed, PKCEChallenge(f.Verifier), nil
+}
+
+// ParseOIDCFlow returns the flow of a valid, unexpired flow token.
+func ParseOIDCFlow(tokenString string) (OIDCFlow, error) {
+	var f OIDCFlow
+	token, err := validateJWT(tokenString)
+	if err != nil || !token.Valid {
+		return f, fmt.Errorf("invalid login flow")
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	if claims["purpose"] != oidcFlowPurpose {
+		return f, fmt.Errorf("invalid login flow")
+	}
+	if exp, ok := claims["expiredAt"].(float64); !ok || time.Now().Unix() > int64(exp) {
+		return f, fmt.Errorf("login flow expired, start again")
+	}
+
+	f.State, _ = claims["state"].(string)
+	f.Nonce, _ = claims["nonce"].(string)
+	f.Verifier, _ = claims["verifier"].(string)
+	if f.State == "" || f.Nonce == "" || f.Verifier == "" {
+		return f, fmt.Errorf("invalid login flow")
+	}
+	return f, nil
+}
+
+// PKCEChallenge is the S256 code challenge of the verifier (RFC 7636).
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
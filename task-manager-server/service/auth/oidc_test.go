@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SibHelly/task-manager-server/config"
+	"github.com/golang-jwt/jwt"
+)
+
+// mockIssuer is a local OIDC provider. Codes are handed out with issue, as
+// if the user had logged in at the provider.
+type mockIssuer struct {
+	srv *httptest.Server
+	key *rsa.PrivateKey
+	kid string
+
+	mu    sync.Mutex
+	codes map[string]mockGrant
+}
+
+type mockGrant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{key: key, kid: "k1", codes: make(map[string]mockGrant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.srv.URL,
+			"authorization_endpoint": m.srv.URL + "/authorize",
+			"token_endpoint":         m.srv.URL + "/token",
+			"jwks_uri":               m.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"kid": m.kid,
+			"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "app" || secret != "s3cret" || r.FormValue("grant_type") != "authorization_code" ||
+			r.FormValue("redirect_uri") != "http://localhost:3000/sso" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+
+		m.mu.Lock()
+		grant, ok := m.codes[r.FormValue("code")]
+		delete(m.codes, r.FormValue("code"))
+		m.mu.Unlock()
+		if !ok || PKCEChallenge(r.FormValue("code_verifier")) != grant.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "at",
+			"token_type":   "Bearer",
+			"id_token":     m.sign(t, grant.claims, m.key, m.kid),
+		})
+	})
+	m.srv = httptest.NewServer(mux)
+	t.Cleanup(m.srv.Close)
+	return m
+}
+
+// issue hands out a code for an ID token with the standard claims plus
+// extra; extra may override them.
+func (m *mockIssuer) issue(code, challenge, nonce string, extra jwt.MapClaims) {
+	claims := jwt.MapClaims{
+		"iss":   m.srv.URL,
+		"aud":   "app",
+		"sub":   "u-123",
+		"nonce": nonce,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+
+	m.mu.Lock()
+	m.codes[code] = mockGrant{challenge: challenge, claims: claims}
+	m.mu.Unlock()
+}
+
+func (m *mockIssuer) sign(t *testing.T, claims jwt.MapClaims, key *rsa.PrivateKey, kid string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestOIDCLogin(t *testing.T) {
+	issuer := newMockIssuer(t)
+	p := NewOIDCProvider(OIDCConfig{
+		Issuer:       issuer.srv.URL,
+		ClientID:     "app",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://localhost:3000/sso",
+		Scopes:       []string{"openid", "phone"},
+	}, issuer.srv.Client())
+
+	flow, flowToken, challenge, err := NewOIDCFlow([]byte(config.Envs.JWTSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authURL, err := p.AuthURL(flow.State, flow.Nonce, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if u.Path != "/authorize" || q.Get("client_id") != "app" || q.Get("state") != flow.State ||
+		q.Get("code_challenge") != challenge || q.Get("code_challenge_method") != "S256" || q.Get("scope") != "openid phone" {
+		t.Errorf("unexpected auth URL %s", authURL)
+	}
+
+	parsed, err := ParseOIDCFlow(flowToken)
+	if err != nil || parsed != flow {
+		t.Fatalf("ParseOIDCFlow = %+v, %v", parsed, err)
+	}
+
+	issuer.issue("good", challenge, flow.Nonce, jwt.MapClaims{
+		"aud":                   []string{"other", "app"},
+		"name":                  "Alice",
+		"phone_number":          "+79991234567",
+		"phone_number_verified": true,
+	})
+	id, err := p.Exchange(context.Background(), "good", flow.Verifier, flow.Nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Issuer != issuer.srv.URL || id.Subject != "u-123" || id.Name != "Alice" || id.Phone != "+79991234567" || !id.PhoneVerified {
+		t.Errorf("unexpected identity %+v", id)
+	}
+
+	if _, err := p.Exchange(context.Background(), "good", flow.Verifier, flow.Nonce); err == nil {
+		t.Error("a code should work once")
+	}
+
+	bad := []struct {
+		name     string
+		verifier string
+		nonce    string
+		claims   jwt.MapClaims
+	}{
+		{"wrong verifier", "not-the-verifier", flow.Nonce, nil},
+		{"wrong nonce", flow.Verifier, "other-nonce", nil},
+		{"other audience", flow.Verifier, flow.Nonce, jwt.MapClaims{"aud": "someone-else"}},
+		{"other issuer", flow.Verifier, flow.Nonce, jwt.MapClaims{"iss": "https://evil.example"}},
+		{"expired", flow.Verifier, flow.Nonce, jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}},
+	}
+	for _, b := range bad {
+		issuer.issue(b.name, challenge, flow.Nonce, b.claims)
+		if _, err := p.Exchange(context.Background(), b.name, b.verifier, b.nonce); err == nil {
+			t.Errorf("%s: exchange should fail", b.name)
+		}
+	}
+}
+
+func TestOIDCRejectsForeignKey(t *testing.T) {
+	issuer := newMockIssuer(t)
+	p := NewOIDCProvider(OIDCConfig{Issuer: issuer.srv.URL, ClientID: "app"}, issuer.srv.Client())
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := jwt.MapClaims{"iss": issuer.srv.URL, "aud": "app", "sub": "x", "nonce": "n",
+		"exp": time.Now().Add(time.Minute).Unix()}
+
+	if _, err := p.verifyIDToken(issuer.sign(t, claims, other, issuer.kid), "n"); err == nil {
+		t.Error("token signed with another key should fail")
+	}
+	if _, err := p.verifyIDToken(issuer.sign(t, claims, other, "k2"), "n"); err == nil {
+		t.Error("token with an unknown key ID should fail")
+	}
+	if _, err := p.verifyIDToken(issuer.sign(t, claims, issuer.key, issuer.kid), "n"); err != nil {
+		t.Errorf("token signed by the issuer: %v", err)
+	}
+}
+
+func TestOIDCFlowIsNotASession(t *testing.T) {
+	secret := []byte(config.Envs.JWTSecret)
+	_, flowToken, _, err := NewOIDCFlow(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := userFromJWT(flowToken); ok {
+		t.Error("flow token should not work as a session token")
+	}
+
+	session, err := CreateJWT(secret, 1, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseOIDCFlow(session); err == nil {
+		t.Error("session token should not work as a flow token")
+	}
+}
@@ -1,6 +1,13 @@
 package auth
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
 
 func HashPassword(password string) (string, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -15,3 +22,66 @@ func ComparePasswords(hashed string, plain []byte) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hashed), plain)
 	return err == nil
 }
+
+// Password rules. bcrypt ignores everything past 72 bytes, so longer
+// passwords are refused rather than silently cut.
+const (
+	minPasswordLen   = 8
+	maxPasswordBytes = 72
+	minPersonalLen   = 4
+)
+
+// commonPasswords are refused whatever else they look like.
+var commonPasswords = map[string]bool{
+	"password": true, "password1": true, "password123": true, "12345678": true,
+	"123456789": true, "1234567890": true, "qwerty123": true, "qwertyuiop": true,
+	"iloveyou": true, "admin123": true, "letmein1": true, "abc12345": true,
+	"11111111": true, "00000000": true, "1q2w3e4r": true, "passw0rd": true,
+}
+
+// ValidatePassword checks that a new password is strong enough: long
+// enough, mixing at least two of letters, digits and other characters, not
+// a common password and not containing the personal values given, like the
+// user's name or phone.
+func ValidatePassword(password string, personal ...string) error {
+	if utf8.RuneCountInString(password) < minPasswordLen {
+		return fmt.Errorf("password must be at least %d characters", minPasswordLen)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("password must be at most %d bytes", maxPasswordBytes)
+	}
+
+	var letters, digits, others bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			letters = true
+		case unicode.IsDigit(r):
+			digits = true
+		default:
+			others = true
+		}
+	}
+	kinds := 0
+	for _, ok := range []bool{letters, digits, others} {
+		if ok {
+			kinds++
+		}
+	}
+	if kinds < 2 {
+		return fmt.Errorf("password must mix letters, digits or other characters")
+	}
+
+	lower := strings.ToLower(password)
+	if commonPasswords[lower] {
+		return fmt.Errorf("password is too common")
+	}
+	for _, p := range personal {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if utf8.RuneCountInString(p) >= minPersonalLen && strings.Contains(lower, p) {
+			return fmt.Errorf("password must not contain your name or phone")
+		}
+	}
+
+	return nil
+}
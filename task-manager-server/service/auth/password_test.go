@@ -32,3 +32,27 @@ func TestComparePasswords(t *testing.T) {
 		t.Errorf("expected password to not match hash")
 	}
 }
+
+func TestValidatePassword(t *testing.T) {
+	valid := []string{"correct horse", "s3cretpass", "Пароль-длинный", "9f8e7d6c5b!"}
+	for _, p := range valid {
+		if err := ValidatePassword(p, "alice", "79991234567"); err != nil {
+			t.Errorf("ValidatePassword(%q): %v", p, err)
+		}
+	}
+
+	invalid := []string{
+		"short1",
+		"onlyletters",
+		"1234567890123",
+		"Password1",
+		"alice-2024",
+		"x79991234567",
+		"a1" + string(make([]byte, 80)),
+	}
+	for _, p := range invalid {
+		if err := ValidatePassword(p, "alice", "79991234567"); err == nil {
+			t.Errorf("ValidatePassword(%q) should fail", p)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SibHelly/task-manager-server/types"
+)
+
+// API tokens start with APITokenPrefix so they can be told from JWTs.
+const APITokenPrefix = "tm_"
+
+const (
+	apiTokenBytes     = 32
+	apiTokenPrefixLen = 8
+	// A token's last use is only written when it is older than this.
+	tokenTouchInterval = time.Minute
+)
+
+// Scope access levels. Write includes read.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// Resources lists what API tokens can be scoped to.
+var Resources = []string{
+	"tasks", "groups", "chats", "labels", "templates", "views", "search",
+	"time", "stats", "statuses", "priorities", "categories", "webhooks", "account",
+}
+
+// routeResources maps the first segment of a route to its resource. Routes
+// missing here, like token management, can not be used with an API token.
+var routeResources = map[string]string{
+	"tasks":     "tasks",
+	"checklist": "tasks",
+	"group":     "groups",
+	"chats":     "chats",
+	"labels":    "labels",
+	"templates": "templates",
+	"views":     "views",
+	"search":    "search",
+	"time":      "time",
+	"stats":     "stats",
+	"statuses":  "statuses",
+	"priority":  "priorities",
+	"category":  "categories",
+	"webhooks":  "webhooks",
+	"auth":      "account",
+	"check":     "account",
+	"user":      "account",
+}
+
+// NewAPIToken returns a new token, the hash to store and its display prefix.
+func NewAPIToken() (token, hash, prefix string, err error) {
+	b := make([]byte, apiTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+
+	token = APITokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, HashAPIToken(token), token[:len(APITokenPrefix)+apiTokenPrefixLen], nil
+}
+
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, APITokenPrefix)
+}
+
+// ValidScope reports whether the scope names a known resource and access.
+func ValidScope(scope string) bool {
+	resource, access, ok := strings.Cut(scope, ":")
+	if !ok || (access != ScopeRead && access != ScopeWrite) {
+		return false
+	}
+	for _, r := range Resources {
+		if r == resource {
+			return true
+		}
+	}
+	return false
+}
+
+// routeResource returns the resource a request path belongs to, skipping
+// the /api/v1 prefix.
+func routeResource(path string) (string, bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) >= 2 && parts[0] == "api" && parts[1] == "v1" {
+		parts = parts[2:]
+	}
+	if len(parts) == 0 {
+		return "", false
+	}
+	resource, ok := routeResources[parts[0]]
+	return resource, ok
+}
+
+// allowed reports whether the scopes let a token make the request. Reads are
+// GET and HEAD requests, everything else is a write.
+func allowed(scopes []string, r *http.Request) bool {
+	resource, ok := routeResource(r.URL.Path)
+	if !ok {
+		return false
+	}
+
+	need := ScopeWrite
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		need = ScopeRead
+	}
+
+	for _, s := range scopes {
+		res, access, _ := strings.Cut(s, ":")
+		if res != resource {
+			continue
+		}
+		if access == ScopeWrite || access == need {
+			return true
+		}
+	}
+	return false
+}
+
+// userFromAPIToken checks the token and its scopes and returns its user.
+func userFromAPIToken(token string, r *http.Request, store types.UserStore) (int, error) {
+	t, err := store.GetAPITokenByHash(HashAPIToken(token))
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+	if t.RevokedAt != nil {
+		return 0, fmt.Errorf("token %d is revoked", t.ID)
+	}
+	if t.ExpiresAt != nil && !now.Before(*t.ExpiresAt) {
+		return 0, fmt.Errorf("token %d has expired", t.ID)
+	}
+	if !allowed(t.Scopes, r) {
+		return 0, fmt.Errorf("token %d has no scope for %s %s", t.ID, r.Method, r.URL.Path)
+	}
+
+	if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) >= tokenTouchInterval {
+		if err := store.TouchAPIToken(t.ID, now); err != nil {
+			return 0, err
+		}
+	}
+
+	return t.UserID, nil
+}
@@ -0,0 +1,275 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SibHelly/task-manager-server/types"
+)
+
+func TestNewAPIToken(t *testing.T) {
+	token, hash, prefix, err := NewAPIToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsAPIToken(token) {
+		t.Errorf("token %q does not start with %q", token, APITokenPrefix)
+	}
+	if hash != HashAPIToken(token) || len(hash) != 64 {
+		t.Errorf("unexpected hash %q", hash)
+	}
+	if !strings.HasPrefix(token, prefix) || len(prefix) != len(APITokenPrefix)+apiTokenPrefixLen {
+		t.Errorf("unexpected prefix %q of %q", prefix, token)
+	}
+
+	other, _, _, _ := NewAPIToken()
+	if other == token {
+		t.Error("two tokens are the same")
+	}
+}
+
+func TestValidScope(t *testing.T) {
+	for _, s := range []string{"tasks:read", "tasks:write", "webhooks:read"} {
+		if !ValidScope(s) {
+			t.Errorf("%q should be valid", s)
+		}
+	}
+	for _, s := range []string{"", "tasks", "tasks:admin", "tokens:write", ":read"} {
+		if ValidScope(s) {
+			t.Errorf("%q should not be valid", s)
+		}
+	}
+}
+
+func TestWithJWTAuthAPIToken(t *testing.T) {
+	now := time.Now().UTC()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	store := &tokenStore{tokens: map[string]*types.APIToken{
+		"tm_reader":  {ID: 1, UserID: 10, Scopes: []string{"tasks:read"}},
+		"tm_writer":  {ID: 2, UserID: 10, Scopes: []string{"tasks:write", "groups:read"}, ExpiresAt: &future},
+		"tm_revoked": {ID: 3, UserID: 10, Scopes: []string{"tasks:write"}, RevokedAt: &past},
+		"tm_expired": {ID: 4, UserID: 10, Scopes: []string{"tasks:write"}, ExpiresAt: &past},
+	}}
+
+	tests := []struct {
+		token  string
+		method string
+		path   string
+		want   int
+	}{
+		{"tm_reader", http.MethodGet, "/api/v1/tasks", http.StatusOK},
+		{"Bearer tm_reader", http.MethodGet, "/api/v1/checklist/task/3", http.StatusOK},
+		{"tm_reader", http.MethodPost, "/api/v1/tasks/create", http.StatusForbidden},
+		{"tm_reader", http.MethodGet, "/api/v1/group", http.StatusForbidden},
+		{"tm_writer", http.MethodPost, "/api/v1/tasks/create", http.StatusOK},
+		{"tm_writer", http.MethodGet, "/api/v1/group/2/users", http.StatusOK},
+		{"tm_writer", http.MethodDelete, "/api/v1/group/2", http.StatusForbidden},
+		{"tm_writer", http.MethodPost, "/api/v1/tokens", http.StatusForbidden},
+		{"tm_revoked", http.MethodGet, "/api/v1/tasks", http.StatusForbidden},
+		{"tm_expired", http.MethodGet, "/api/v1/tasks", http.StatusForbidden},
+		{"tm_unknown", http.MethodGet, "/api/v1/tasks", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		var gotUser int
+		h := WithJWTAuth(func(w http.ResponseWriter, r *http.Request) {
+			gotUser = GetUserIDFromContext(r.Context())
+		}, store)
+
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("Authorization", tt.token)
+		rr := httptest.NewRecorder()
+		h(rr, req)
+
+		if rr.Code != tt.want {
+			t.Errorf("%s %s %s: status %d, want %d", tt.token, tt.method, tt.path, rr.Code, tt.want)
+		}
+		if tt.want == http.StatusOK && gotUser != 10 {
+			t.Errorf("%s %s %s: user %d in context", tt.token, tt.method, tt.path, gotUser)
+		}
+	}
+
+	if store.tokens["tm_reader"].LastUsedAt == nil {
+		t.Error("last use of the token was not recorded")
+	}
+}
+
+// tokenStore finds API tokens by hash; the tokens are keyed by their value.
+// It also keeps sessions by ID.
+type tokenStore struct {
+	tokens   map[string]*types.APIToken
+	sessions map[int]*types.Session
+}
+
+func (s *tokenStore) GetAPITokenByHash(hash string) (*types.APIToken, error) {
+	for token, t := range s.tokens {
+		if HashAPIToken(token) == hash {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("token not found")
+}
+
+func (s *tokenStore) TouchAPIToken(tokenID int, at time.Time) error {
+	for _, t := range s.tokens {
+		if t.ID == tokenID {
+			t.LastUsedAt = &at
+		}
+	}
+	return nil
+}
+
+func (s *tokenStore) GetUserById(id int) (*types.User, error) {
+	return &types.User{ID: id}, nil
+}
+
+func (s *tokenStore) GetUserByPhone(phone string) (*types.User, error) {
+	return nil, nil
+}
+
+func (s *tokenStore) GetUserIdByName(name string) (*int, error) {
+	return nil, nil
+}
+
+func (s *tokenStore) CreateUser(user types.User) error {
+	return nil
+}
+
+func (s *tokenStore) UpdateUser(user types.User) error {
+	return nil
+}
+
+func (s *tokenStore) SetAvatar(userID int, avatar string) error {
+	return nil
+}
+
+func (s *tokenStore) DeleteUser(userID int) (*types.AccountDeletion, error) {
+	return nil, nil
+}
+
+func (s *tokenStore) CreateAPIToken(userID int, t types.CreateAPIToken, hash, prefix string) (int, error) {
+	return 0, nil
+}
+
+func (s *tokenStore) GetAPITokens(userID int) ([]types.APIToken, error) {
+	return nil, nil
+}
+
+func (s *tokenStore) RevokeAPIToken(userID, tokenID int) error {
+	return nil
+}
+
+func (s *tokenStore) RecordLoginAttempt(a types.LoginAttempt) error {
+	return nil
+}
+
+func (s *tokenStore) UpdatePassword(userID int, hash string) error {
+	return nil
+}
+
+func (s *tokenStore) CreatePasswordReset(userID int, codeHash string, expiresAt time.Time) error {
+	return nil
+}
+
+func (s *tokenStore) UsePasswordReset(userID int, codeHash string, now time.Time) (bool, error) {
+	return false, nil
+}
+
+func (s *tokenStore) SearchUsers(callerID int, q types.UserSearch) ([]types.UserSearchResult, error) {
+	return nil, nil
+}
+
+func (s *tokenStore) SetTOTPSecret(userID int, secret string) error {
+	return nil
+}
+
+func (s *tokenStore) EnableTOTP(userID int, step int64, recoveryHashes []string) error {
+	return nil
+}
+
+func (s *tokenStore) DisableTOTP(userID int) error {
+	return nil
+}
+
+func (s *tokenStore) UseTOTPStep(userID int, step int64) (bool, error) {
+	return false, nil
+}
+
+func (s *tokenStore) ReplaceRecoveryCodes(userID int, hashes []string) error {
+	return nil
+}
+
+func (s *tokenStore) UseRecoveryCode(userID int, hash string, now time.Time) (bool, error) {
+	return false, nil
+}
+
+func (s *tokenStore) CountRecoveryCodes(userID int) (int, error) {
+	return 0, nil
+}
+
+func (s *tokenStore) TwoFactorRequired(userID int) (bool, error) {
+	return false, nil
+}
+
+func (s *tokenStore) CreateSession(sess types.Session) (int, error) {
+	return 0, nil
+}
+
+func (s *tokenStore) GetSession(sessionID int) (*types.Session, error) {
+	sess, ok := s.sessions[sessionID]
+	if !ok {
+		return nil, fmt.Errorf("session not found")
+	}
+	return sess, nil
+}
+
+func (s *tokenStore) GetSessions(userID int) ([]types.Session, error) {
+	return nil, nil
+}
+
+func (s *tokenStore) TouchSession(sessionID int, at time.Time) error {
+	if sess, ok := s.sessions[sessionID]; ok {
+		sess.LastSeenAt = at
+	}
+	return nil
+}
+
+func (s *tokenStore) RevokeSession(userID, sessionID int) error {
+	return nil
+}
+
+func (s *tokenStore) RevokeOtherSessions(userID, keepID int) (int, error) {
+	return 0, nil
+}
+
+func (s *tokenStore) GetUserByIdentity(issuer, subject string) (*types.User, error) {
+	return nil, fmt.Errorf("user not found")
+}
+
+func (s *tokenStore) LinkIdentity(userID int, issuer, subject string) error {
+	return nil
+}
+
+func (s *tokenStore) CreateOIDCUser(u types.User, issuer, subject string) (int, error) {
+	return 0, nil
+}
+
+func (s *tokenStore) GetUserByEmail(email string) (*types.User, error) {
+	return nil, fmt.Errorf("user not found")
+}
+
+func (s *tokenStore) SetEmail(userID int, email string) error {
+	return nil
+}
+
+func (s *tokenStore) CreateEmailVerification(userID int, email, codeHash string, expiresAt time.Time) error {
+	return nil
+}
+
+func (s *tokenStore) UseEmailVerification(userID int, codeHash string, now time.Time) (string, error) {
+	return "", nil
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors.
+var rfc6238Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestHOTPRFC6238Vectors(t *testing.T) {
+	key, err := decodeTOTPSecret(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, c := range cases {
+		step := TOTPStep(time.Unix(c.unix, 0))
+		if got := hotp(key, uint64(step), 8); got != c.code {
+			t.Errorf("T=%d: got %s, want %s", c.unix, got, c.code)
+		}
+	}
+
+	code, err := TOTPCode(rfc6238Secret, time.Unix(1234567890, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "005924" {
+		t.Errorf("TOTPCode = %s, want 005924", code)
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step := TOTPStep(now)
+
+	for _, offset := range []int64{-1, 0, 1} {
+		code, _ := TOTPCode(rfc6238Secret, now.Add(time.Duration(offset*totpPeriod)*time.Second))
+		got, ok := ValidateTOTP(rfc6238Secret, code, now, 0)
+		if !ok || got != step+offset {
+			t.Errorf("offset %d: got step %d ok %v", offset, got, ok)
+		}
+	}
+
+	old, _ := TOTPCode(rfc6238Secret, now.Add(-2*totpPeriod*time.Second))
+	if _, ok := ValidateTOTP(rfc6238Secret, old, now, 0); ok {
+		t.Error("code two periods old should be refused")
+	}
+
+	code, _ := TOTPCode(rfc6238Secret, now)
+	if _, ok := ValidateTOTP(rfc6238Secret, code, now, step); ok {
+		t.Error("used code should be refused")
+	}
+	if _, ok := ValidateTOTP("not base32!", code, now, 0); ok {
+		t.Error("broken secret should be refused")
+	}
+}
+
+func TestNewTOTPSecret(t *testing.T) {
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 32 {
+		t.Errorf("secret %q should be 32 characters", secret)
+	}
+
+	uri := TOTPURI("Task Manager", "79991234567", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/Task%20Manager:79991234567?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("unexpected URI %s", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := NewRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[string]bool)
+	for _, c := range codes {
+		if len(c) != 11 || c[5] != '-' || IsTOTPCode(c) {
+			t.Errorf("unexpected code %q", c)
+		}
+		if seen[c] {
+			t.Errorf("duplicate code %q", c)
+		}
+		seen[c] = true
+	}
+
+	if got := NormalizeRecoveryCode(" ABCDE-fghij"); got != "abcdefghij" {
+		t.Errorf("NormalizeRecoveryCode = %q", got)
+	}
+	if !IsTOTPCode("012345") || IsTOTPCode("01234a") || IsTOTPCode("1234567") {
+		t.Error("IsTOTPCode is wrong")
+	}
+}
@@ -12,12 +12,13 @@ import (
 )
 
 type Handler struct {
-	store     types.CategoryStore
-	userStore types.UserStore
+	store      types.CategoryStore
+	groupStore types.GroupStore
+	userStore  types.UserStore
 }
 
-func NewHandler(store types.CategoryStore, userStore types.UserStore) *Handler {
-	return &Handler{store: store, userStore: userStore}
+func NewHandler(store types.CategoryStore, groupStore types.GroupStore, userStore types.UserStore) *Handler {
+	return &Handler{store: store, groupStore: groupStore, userStore: userStore}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
@@ -156,6 +157,7 @@ func (h *Handler) handleGetGroupCategories(w http.ResponseWriter, r *http.Reques
 }
 
 func (h *Handler) handleUpdateCategory(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	str, ok := vars["categoryID"]
 	if !ok {
@@ -169,6 +171,16 @@ func (h *Handler) handleUpdateCategory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	current, err := h.store.GetCategoryByID(categoryID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if !h.canManage(current, userID) {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you can not change this category"))
+		return
+	}
+
 	var create types.CreateCategory
 	if err := utils.ParseJSON(r, &create); err != nil {
 		utils.WriteError(w, http.StatusBadRequest, err)
@@ -189,6 +201,7 @@ func (h *Handler) handleUpdateCategory(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) handleDeleteCategory(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	str, ok := vars["categoryID"]
 	if !ok {
@@ -202,11 +215,74 @@ func (h *Handler) handleDeleteCategory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.store.DeleteCategory(categoryID)
+	current, err := h.store.GetCategoryByID(categoryID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if !h.canManage(current, userID) {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you can not delete this category"))
+		return
+	}
+
+	replaceWith := 0
+	if str := r.URL.Query().Get("replace_with"); str != "" {
+		replaceWith, err = strconv.Atoi(str)
+		if err != nil || replaceWith == categoryID {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid replacement category ID"))
+			return
+		}
+
+		rep, err := h.store.GetCategoryByID(replaceWith)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		same, err := h.store.SameCategoryScope(current.ID, rep.ID)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if !same {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("category: %s is not available here", rep.Name))
+			return
+		}
+	}
+
+	affected, err := h.store.DeleteCategory(categoryID, replaceWith)
+	if err == ErrCategoryInUse {
+		usage, err := h.store.GetCategoryUsage(categoryID)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		utils.WriteJson(w, http.StatusConflict, map[string]interface{}{
+			"error": fmt.Sprintf("category is used by %d tasks, pass replace_with to move them", usage.Tasks),
+			"usage": usage,
+		})
+		return
+	}
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	utils.WriteJson(w, http.StatusOK, "DELETED")
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status":         "DELETED",
+		"affected_tasks": affected,
+	})
+}
+
+// canManage reports whether the user may change the category: their own
+// categories, or those of a group where they are owner or editor.
+func (h *Handler) canManage(c *types.Category, userID int) bool {
+	if c.UserID != 0 {
+		return c.UserID == userID
+	}
+	if c.GroupID != 0 {
+		role, err := h.groupStore.GetUserRole(c.GroupID, userID)
+		return err == nil && (role == "owner" || role == "editor")
+	}
+	return false
 }
@@ -7,6 +7,16 @@ import (
 	"github.com/SibHelly/task-manager-server/types"
 )
 
+const categorySelect = `SELECT c.category_id, c.category_name, c.description, c.color,
+	COALESCE(uc.user_id, 0), COALESCE(gc.group_id, 0)
+	FROM categories c
+	LEFT JOIN users_categories uc ON uc.category_id = c.category_id
+	LEFT JOIN groups_categories gc ON gc.category_id = c.category_id`
+
+// ErrCategoryInUse is returned when a category still used by tasks is
+// deleted without a replacement.
+var ErrCategoryInUse = fmt.Errorf("category is used by tasks")
+
 type Store struct {
 	db *sql.DB
 }
@@ -19,15 +29,11 @@ func (s *Store) GetCategories(ID int, flag bool) ([]types.Category, error) {
 	var query string
 	if flag {
 		query =
-			`SELECT c.*
-        FROM categories c
-        JOIN users_categories uc ON c.category_id = uc.category_id
+			categorySelect + `
         WHERE uc.user_id = ?`
 	} else {
 		query =
-			`SELECT c.*
-        FROM categories c
-        JOIN groups_categories gc ON c.category_id = gc.category_id
+			categorySelect + `
         WHERE gc.group_id = ?`
 	}
 
@@ -54,15 +60,11 @@ func (s *Store) GetCategory(ID int, category_name string, flag bool) (*types.Cat
 	var query string
 	if flag {
 		query =
-			`SELECT c.*
-        FROM categories c
-        JOIN users_categories uc ON c.category_id = uc.category_id
+			categorySelect + `
         WHERE uc.user_id = ? AND c.category_name= ?`
 	} else {
 		query =
-			`SELECT c.*
-        FROM categories c
-        JOIN groups_categories gc ON c.category_id = gc.category_id
+			categorySelect + `
         WHERE gc.group_id = ? AND c.category_name= ?`
 	}
 
@@ -88,15 +90,11 @@ func (s *Store) GetCategoryID(ID int, category_name string, flag bool) (*int, er
 	var query string
 	if flag {
 		query =
-			`SELECT c.*
-        FROM categories c
-        JOIN users_categories uc ON c.category_id = uc.category_id
+			categorySelect + `
         WHERE uc.user_id = ? AND c.category_name= ?`
 	} else {
 		query =
-			`SELECT c.*
-        FROM categories c
-        JOIN groups_categories gc ON c.category_id = gc.category_id
+			categorySelect + `
         WHERE gc.group_id = ? AND c.category_name= ?`
 	}
 
@@ -119,7 +117,7 @@ func (s *Store) GetCategoryID(ID int, category_name string, flag bool) (*int, er
 }
 
 func (s *Store) GetCategoryByID(categoryID int) (*types.Category, error) {
-	rows, err := s.db.Query("SELECT * FROM categories WHERE category_id = ?", categoryID)
+	rows, err := s.db.Query(categorySelect+" WHERE c.category_id = ?", categoryID)
 	if err != nil {
 		return nil, err
 	}
@@ -160,16 +158,91 @@ func (s *Store) CreateCategory(ID int, p types.CreateCategory, flag bool) error
 	return nil
 }
 
-func (s *Store) DeleteCategory(categoryID int) error {
-	_, err := s.db.Exec("DELETE FROM categories WHERE category_id = ?", categoryID)
+// DeleteCategory moves the tasks using the category to replaceWith and
+// removes the category in one transaction. It returns the number of tasks
+// moved. Without a replacement it fails with ErrCategoryInUse while tasks
+// use the category.
+func (s *Store) DeleteCategory(categoryID, replaceWith int) (int64, error) {
+	tx, err := s.db.Begin()
 	if err != nil {
-		return err
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Locking the category keeps tasks from taking it up until we are done.
+	var id int
+	err = tx.QueryRow("SELECT category_id FROM categories WHERE category_id = ? FOR UPDATE", categoryID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("Category not found")
 	}
-	_, err = s.db.Exec("DELETE FROM users_categories WHERE category_id = ?", categoryID)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+
+	var replacement interface{}
+	if replaceWith != 0 {
+		replacement = replaceWith
+	} else {
+		var used bool
+		err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM tasks WHERE category_id = ?)", categoryID).Scan(&used)
+		if err != nil {
+			return 0, err
+		}
+		if used {
+			return 0, ErrCategoryInUse
+		}
+	}
+
+	res, err := tx.Exec("UPDATE tasks SET category_id = ? WHERE category_id = ?", replacement, categoryID)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("DELETE FROM categories WHERE category_id = ?", categoryID)
+	if err != nil {
+		return 0, err
+	}
+
+	return affected, tx.Commit()
+}
+
+func (s *Store) GetCategoryUsage(categoryID int) (*types.TaskUsage, error) {
+	query := `SELECT COUNT(*),
+		COALESCE(SUM(NOT EXISTS (SELECT 1 FROM status_map fs WHERE fs.status_id = t.status_id AND fs.is_final)), 0),
+		COALESCE(SUM(t.parent_task_id IS NOT NULL), 0)
+	FROM tasks t WHERE t.category_id = ?`
+
+	u := new(types.TaskUsage)
+	err := s.db.QueryRow(query, categoryID).Scan(&u.Tasks, &u.OpenTasks, &u.Subtasks)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// SameCategoryScope reports whether both categories belong to the same user
+// or to the same group.
+func (s *Store) SameCategoryScope(categoryID, otherID int) (bool, error) {
+	query := `SELECT EXISTS (
+		SELECT 1 FROM users_categories a
+		JOIN users_categories b ON b.user_id = a.user_id
+		WHERE a.category_id = ? AND b.category_id = ?
+	) OR EXISTS (
+		SELECT 1 FROM groups_categories a
+		JOIN groups_categories b ON b.group_id = a.group_id
+		WHERE a.category_id = ? AND b.category_id = ?
+	)`
+
+	var same bool
+	err := s.db.QueryRow(query, categoryID, otherID, categoryID, otherID).Scan(&same)
+	if err != nil {
+		return false, err
+	}
+	return same, nil
 }
 
 func (s *Store) UpdateCategory(categoryID int, p types.CreateCategory) error {
@@ -188,6 +261,8 @@ func scanRowsIntoCategory(rows *sql.Rows) (*types.Category, error) {
 		&Category.Name,
 		&Category.Description,
 		&Category.Color,
+		&Category.UserID,
+		&Category.GroupID,
 	)
 
 	if err != nil {
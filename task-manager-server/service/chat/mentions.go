@@ -0,0 +1,21 @@
+package chat
+
+import "regexp"
+
+// mentionPattern matches @name, where the name runs until whitespace or
+// punctuation other than '.', '_' and '-'.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_])@([\p{L}\p{N}_.\-]*[\p{L}\p{N}_])`)
+
+// mentions returns the distinct user names mentioned in the text, in the
+// order they first appear.
+func mentions(text string) []string {
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
@@ -0,0 +1,28 @@
+package chat
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMentions(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"no mentions here", []string{}},
+		{"@alice please look", []string{"alice"}},
+		{"cc @alice, @bob.", []string{"alice", "bob"}},
+		{"@alice and @alice again", []string{"alice"}},
+		{"mail me at bob@example.com", []string{}},
+		{"@иван_петров готово", []string{"иван_петров"}},
+		{"(@j.doe-2)", []string{"j.doe-2"}},
+		{"just @ alone", []string{}},
+	}
+
+	for _, tt := range tests {
+		if got := mentions(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("mentions(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
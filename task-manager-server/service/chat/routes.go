@@ -2,10 +2,12 @@ package chat
 
 import (
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 
 	"github.com/SibHelly/task-manager-server/service/auth"
+	"github.com/SibHelly/task-manager-server/service/events"
 	"github.com/SibHelly/task-manager-server/types"
 	"github.com/SibHelly/task-manager-server/utils"
 	"github.com/gorilla/mux"
@@ -15,13 +17,17 @@ type Handler struct {
 	store        types.ChatStore
 	userStore    types.UserStore
 	commentStore types.CommentStore
+	taskStore    types.TasksStore
+	events       types.EventPublisher
 }
 
-func NewHandler(store types.ChatStore, commentStore types.CommentStore, userStore types.UserStore) *Handler {
+func NewHandler(store types.ChatStore, commentStore types.CommentStore, userStore types.UserStore, taskStore types.TasksStore, events types.EventPublisher) *Handler {
 	return &Handler{
 		store:        store,
 		commentStore: commentStore,
 		userStore:    userStore,
+		taskStore:    taskStore,
+		events:       events,
 	}
 }
 
@@ -257,11 +263,56 @@ func (h *Handler) handleSendComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.watchComment(chatID, userID, create.CommentText)
+
 	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
 		"Status": "Comment sended",
 	})
 }
 
+// watchComment makes the sender and every mentioned user who can see the task
+// watch it, then tells the task's recipients about the comment. The comment
+// is already saved, so failures are only logged.
+func (h *Handler) watchComment(chatID, senderID int, text string) {
+	ch, err := h.store.GetChat(chatID)
+	if err != nil {
+		log.Printf("comment in chat %d: %v", chatID, err)
+		return
+	}
+
+	if err := h.taskStore.AddWatcher(ch.TaskID, senderID, types.WatchComment); err != nil {
+		log.Printf("watch task %d: %v", ch.TaskID, err)
+	}
+
+	mentioned := make([]int, 0)
+	for _, name := range mentions(text) {
+		id, err := h.userStore.GetUserIdByName(name)
+		if err != nil || *id == senderID {
+			continue
+		}
+		allowed, err := h.taskStore.CanAccessTask(ch.TaskID, *id)
+		if err != nil || !allowed {
+			continue
+		}
+		if err := h.taskStore.AddWatcher(ch.TaskID, *id, types.WatchMention); err != nil {
+			log.Printf("watch task %d: %v", ch.TaskID, err)
+			continue
+		}
+		mentioned = append(mentioned, *id)
+	}
+
+	events.PublishTask(h.events, h.taskStore, types.Event{
+		Type:    types.EventCommentAdded,
+		TaskID:  ch.TaskID,
+		ActorID: senderID,
+		Data: map[string]interface{}{
+			"chat_id":   chatID,
+			"comment":   text,
+			"mentioned": mentioned,
+		},
+	})
+}
+
 func (h *Handler) handleDeleteComment(w http.ResponseWriter, r *http.Request) {
 
 	vars := mux.Vars(r)
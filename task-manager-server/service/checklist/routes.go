@@ -0,0 +1,243 @@
+package checklist
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/SibHelly/task-manager-server/service/auth"
+	"github.com/SibHelly/task-manager-server/types"
+	"github.com/SibHelly/task-manager-server/utils"
+	"github.com/gorilla/mux"
+)
+
+const maxItemText = 500
+
+type Handler struct {
+	store     types.ChecklistStore
+	taskStore types.TasksStore
+	userStore types.UserStore
+}
+
+func NewHandler(store types.ChecklistStore, taskStore types.TasksStore, userStore types.UserStore) *Handler {
+	return &Handler{store: store, taskStore: taskStore, userStore: userStore}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/checklist/task/{taskID}", auth.WithJWTAuth(h.handleGetItems, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/checklist/task/{taskID}", auth.WithJWTAuth(h.handleCreateItem, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/checklist/task/{taskID}/order", auth.WithJWTAuth(h.handleReorderItems, h.userStore)).Methods(http.MethodPut)
+	router.HandleFunc("/checklist/{itemID}", auth.WithJWTAuth(h.handleUpdateItem, h.userStore)).Methods(http.MethodPut)
+	router.HandleFunc("/checklist/{itemID}", auth.WithJWTAuth(h.handleDeleteItem, h.userStore)).Methods(http.MethodDelete)
+	router.HandleFunc("/checklist/{itemID}/check", auth.WithJWTAuth(h.handleCheckItem, h.userStore)).Methods(http.MethodPut)
+}
+
+func (h *Handler) handleGetItems(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	taskID, ok := h.taskFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	items, err := h.store.GetItems(taskID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Get checklist",
+		"items":  items,
+	})
+}
+
+func (h *Handler) handleCreateItem(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	taskID, ok := h.taskFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	var create types.CreateChecklistItem
+	if err := utils.ParseJSON(r, &create); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := validateText(create.Text); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err := h.store.CreateItem(taskID, strings.TrimSpace(create.Text))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusCreated, map[string]interface{}{
+		"Status": "Checklist item created",
+	})
+}
+
+func (h *Handler) handleReorderItems(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	taskID, ok := h.taskFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	var order types.ReorderChecklist
+	if err := utils.ParseJSON(r, &order); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err := h.store.ReorderItems(taskID, order.ItemIDs)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Checklist reordered",
+	})
+}
+
+func (h *Handler) handleUpdateItem(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	item, ok := h.itemFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	var create types.CreateChecklistItem
+	if err := utils.ParseJSON(r, &create); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := validateText(create.Text); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err := h.store.UpdateItem(item.ID, strings.TrimSpace(create.Text))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Checklist item updated",
+	})
+}
+
+func (h *Handler) handleCheckItem(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	item, ok := h.itemFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	var check types.CheckChecklistItem
+	if err := utils.ParseJSON(r, &check); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err := h.store.SetChecked(item.ID, userID, check.Checked)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Checklist item updated",
+	})
+}
+
+func (h *Handler) handleDeleteItem(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	item, ok := h.itemFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	err := h.store.DeleteItem(item.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Checklist item deleted",
+	})
+}
+
+func validateText(text string) error {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return fmt.Errorf("item text is required")
+	}
+	if len([]rune(text)) > maxItemText {
+		return fmt.Errorf("item text is longer than %d characters", maxItemText)
+	}
+	return nil
+}
+
+func (h *Handler) canAccess(w http.ResponseWriter, taskID, userID int) bool {
+	ok, err := h.taskStore.CanAccessTask(taskID, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return false
+	}
+	if !ok {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you have no access to this task"))
+		return false
+	}
+	return true
+}
+
+// taskFromRequest reads the task ID from the route and checks the user can
+// see the task.
+func (h *Handler) taskFromRequest(w http.ResponseWriter, r *http.Request, userID int) (int, bool) {
+	vars := mux.Vars(r)
+	str, ok := vars["taskID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing task ID"))
+		return 0, false
+	}
+
+	taskID, err := strconv.Atoi(str)
+	if err != nil || taskID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid task ID"))
+		return 0, false
+	}
+
+	return taskID, h.canAccess(w, taskID, userID)
+}
+
+// itemFromRequest loads the item from the route and checks the user can see
+// its task.
+func (h *Handler) itemFromRequest(w http.ResponseWriter, r *http.Request, userID int) (*types.ChecklistItem, bool) {
+	vars := mux.Vars(r)
+	str, ok := vars["itemID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing item ID"))
+		return nil, false
+	}
+
+	itemID, err := strconv.Atoi(str)
+	if err != nil || itemID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid item ID"))
+		return nil, false
+	}
+
+	item, err := h.store.GetItemByID(itemID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return nil, false
+	}
+
+	return item, h.canAccess(w, item.TaskID, userID)
+}
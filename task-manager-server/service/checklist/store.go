@@ -0,0 +1,151 @@
+package checklist
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/SibHelly/task-manager-server/types"
+)
+
+const itemSelect = `SELECT item_id, task_id, item_text, position, is_checked, checked_by, checked_at
+	FROM checklist_items`
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) GetItems(taskID int) ([]types.ChecklistItem, error) {
+	rows, err := s.db.Query(itemSelect+" WHERE task_id = ? ORDER BY position, item_id", taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]types.ChecklistItem, 0)
+	for rows.Next() {
+		item, err := scanRowsIntoItem(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, *item)
+	}
+
+	return items, rows.Err()
+}
+
+func (s *Store) GetItemByID(itemID int) (*types.ChecklistItem, error) {
+	rows, err := s.db.Query(itemSelect+" WHERE item_id = ?", itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	item := new(types.ChecklistItem)
+	for rows.Next() {
+		item, err = scanRowsIntoItem(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if item.ID == 0 {
+		return nil, fmt.Errorf("checklist item not found")
+	}
+	return item, nil
+}
+
+// CreateItem appends an item to the end of the task's checklist.
+func (s *Store) CreateItem(taskID int, text string) error {
+	_, err := s.db.Exec(`INSERT INTO checklist_items (task_id, item_text, position)
+	SELECT ?, ?, COALESCE(MAX(position), 0) + 1 FROM checklist_items WHERE task_id = ?`,
+		taskID, text, taskID)
+	return err
+}
+
+func (s *Store) UpdateItem(itemID int, text string) error {
+	_, err := s.db.Exec("UPDATE checklist_items SET item_text = ? WHERE item_id = ?", text, itemID)
+	return err
+}
+
+// SetChecked checks the item on behalf of the user, or clears the check.
+func (s *Store) SetChecked(itemID, userID int, checked bool) error {
+	if !checked {
+		_, err := s.db.Exec("UPDATE checklist_items SET is_checked = FALSE, checked_by = NULL, checked_at = NULL WHERE item_id = ?", itemID)
+		return err
+	}
+
+	_, err := s.db.Exec("UPDATE checklist_items SET is_checked = TRUE, checked_by = ?, checked_at = ? WHERE item_id = ?",
+		userID, time.Now().UTC(), itemID)
+	return err
+}
+
+// ReorderItems sets the positions of the task's items to their order in
+// itemIDs, in one transaction.
+func (s *Store) ReorderItems(taskID int, itemIDs []int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i, id := range itemIDs {
+		res, err := tx.Exec("UPDATE checklist_items SET position = ? WHERE item_id = ? AND task_id = ?", i+1, id, taskID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			var exists bool
+			err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM checklist_items WHERE item_id = ? AND task_id = ?)", id, taskID).Scan(&exists)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return fmt.Errorf("checklist item %d does not belong to this task", id)
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) DeleteItem(itemID int) error {
+	_, err := s.db.Exec("DELETE FROM checklist_items WHERE item_id = ?", itemID)
+	return err
+}
+
+func scanRowsIntoItem(rows *sql.Rows) (*types.ChecklistItem, error) {
+	item := new(types.ChecklistItem)
+	var (
+		checkedBy sql.NullInt64
+		checkedAt sql.NullTime
+	)
+
+	err := rows.Scan(
+		&item.ID,
+		&item.TaskID,
+		&item.Text,
+		&item.Position,
+		&item.Checked,
+		&checkedBy,
+		&checkedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if checkedBy.Valid {
+		item.CheckedBy = int(checkedBy.Int64)
+	}
+	if checkedAt.Valid {
+		item.CheckedAt = &checkedAt.Time
+	}
+
+	return item, nil
+}
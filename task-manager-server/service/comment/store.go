@@ -32,7 +32,7 @@ func (s *Store) DeleteCommnet(commentID int) error {
 }
 
 func (s *Store) GetComments(chatID int) ([]types.Comment, error) {
-	query := `SELECT * FROM comments WHERE chat_id = ?`
+	query := `SELECT comment_id, chat_id, COALESCE(sender_id, 0), comment_text FROM comments WHERE chat_id = ?`
 	rows, err := s.db.Query(query, chatID)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,41 @@
+package events
+
+import (
+	"log"
+	"sync"
+
+	"github.com/SibHelly/task-manager-server/types"
+)
+
+// Bus hands every published event to all subscribers. Each subscriber runs
+// in its own goroutine so a slow one never holds up a request.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers []func(types.Event)
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+func (b *Bus) Subscribe(fn func(types.Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, fn)
+}
+
+func (b *Bus) Publish(e types.Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, fn := range b.subscribers {
+		go func(fn func(types.Event)) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("event subscriber panicked on %s: %v", e.Type, r)
+				}
+			}()
+			fn(e)
+		}(fn)
+	}
+}
@@ -0,0 +1,46 @@
+package events
+
+import (
+	"log"
+	"time"
+
+	"github.com/SibHelly/task-manager-server/types"
+)
+
+// PublishTask sends a task event to the task's responsible users and
+// watchers. Recipients already set on the event are kept, for tasks that are
+// gone by the time the event goes out. The actor is never told about their
+// own change. A nil publisher drops the event.
+func PublishTask(pub types.EventPublisher, tasks types.TasksStore, e types.Event) {
+	if pub == nil {
+		return
+	}
+
+	if e.Recipients == nil {
+		recipients, err := tasks.GetTaskRecipients(e.TaskID)
+		if err != nil {
+			log.Printf("event %s for task %d: %v", e.Type, e.TaskID, err)
+			return
+		}
+		e.Recipients = recipients
+	}
+	if e.GroupID == 0 {
+		if t, err := tasks.GetTaskByID(e.TaskID); err == nil {
+			e.GroupID = t.Group_id
+		}
+	}
+
+	e.Recipients = withoutUser(e.Recipients, e.ActorID)
+	e.At = time.Now().UTC()
+	pub.Publish(e)
+}
+
+func withoutUser(users []int, userID int) []int {
+	out := make([]int, 0, len(users))
+	for _, u := range users {
+		if u != userID {
+			out = append(out, u)
+		}
+	}
+	return out
+}
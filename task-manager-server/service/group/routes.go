@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/SibHelly/task-manager-server/service/auth"
 	"github.com/SibHelly/task-manager-server/types"
@@ -14,10 +15,11 @@ import (
 type Handler struct {
 	store     types.GroupStore
 	userStore types.UserStore
+	events    types.EventPublisher
 }
 
-func NewHandler(store types.GroupStore, userStore types.UserStore) *Handler {
-	return &Handler{store: store, userStore: userStore}
+func NewHandler(store types.GroupStore, userStore types.UserStore, events types.EventPublisher) *Handler {
+	return &Handler{store: store, userStore: userStore, events: events}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
@@ -36,6 +38,7 @@ func (h *Handler) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc("/group/{groupID}/add", auth.WithJWTAuth(h.handleAddUserToGroup, h.userStore)).Methods(http.MethodPost)
 	router.HandleFunc("/group/{groupID}/delete", auth.WithJWTAuth(h.handleDeleteUserFromGroup, h.userStore)).Methods(http.MethodDelete)
 	router.HandleFunc("/group/{groupID}/users", auth.WithJWTAuth(h.handleGetUsersGroup, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/group/{groupID}/2fa", auth.WithJWTAuth(h.handleRequire2FA, h.userStore)).Methods(http.MethodPut)
 
 }
 
@@ -219,6 +222,7 @@ func (h *Handler) handleGetUserRole(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) handleUpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	str, ok := vars["groupID"]
 	if !ok {
@@ -245,6 +249,8 @@ func (h *Handler) handleUpdateUserRole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.publishMember(types.EventMemberRoleChanged, groupID, userID, user_id, user_role)
+
 	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
 		"group_id": groupID,
 		"user_id":  user_id,
@@ -254,6 +260,7 @@ func (h *Handler) handleUpdateUserRole(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) handleAddUserToGroup(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	str, ok := vars["groupID"]
 	if !ok {
@@ -274,12 +281,32 @@ func (h *Handler) handleAddUserToGroup(w http.ResponseWriter, r *http.Request) {
 	}
 	user_id := create.ID
 	user_role := create.Role
+
+	g, err := h.store.GetGroupByID(groupID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if g.Require2FA {
+		u, err := h.userStore.GetUserById(user_id)
+		if err != nil {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		if !u.TOTPEnabled {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("group requires two-factor authentication, which the user has not turned on"))
+			return
+		}
+	}
+
 	err = h.store.AddUser(user_id, groupID, user_role)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
+	h.publishMember(types.EventMemberAdded, groupID, userID, user_id, user_role)
+
 	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
 		"group_id": groupID,
 		"user_id":  user_id,
@@ -289,6 +316,7 @@ func (h *Handler) handleAddUserToGroup(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) handleDeleteUserFromGroup(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	str, ok := vars["groupID"]
 	if !ok {
@@ -314,6 +342,8 @@ func (h *Handler) handleDeleteUserFromGroup(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	h.publishMember(types.EventMemberRemoved, groupID, userID, user_id, "")
+
 	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
 		"group_id": groupID,
 		"user_id":  user_id,
@@ -348,3 +378,85 @@ func (h *Handler) handleGetUsersGroup(w http.ResponseWriter, r *http.Request) {
 	})
 
 }
+
+// handleRequire2FA lets the group owner require two-factor authentication
+// from every member. The owner must have it on; the answer lists the
+// members who do not, and who lose access until they turn it on.
+func (h *Handler) handleRequire2FA(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	vars := mux.Vars(r)
+	str, ok := vars["groupID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing group ID"))
+		return
+	}
+
+	groupID, err := strconv.Atoi(str)
+	if err != nil || groupID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid group ID"))
+		return
+	}
+
+	var payload types.Require2FAPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	role, err := h.store.GetUserRole(groupID, userID)
+	if err != nil || role != "owner" {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("only the group owner can change this"))
+		return
+	}
+
+	if payload.Required {
+		u, err := h.userStore.GetUserById(userID)
+		if err != nil {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		if !u.TOTPEnabled {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("turn on two-factor authentication first"))
+			return
+		}
+	}
+
+	if err := h.store.SetRequire2FA(groupID, payload.Required); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	without := make([]types.UsersGroup, 0)
+	if payload.Required {
+		without, err = h.store.GetMembersWithout2FA(groupID)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"group_id":            groupID,
+		"require_2fa":         payload.Required,
+		"members_without_2fa": without,
+		"status":              "Two-factor requirement updated",
+	})
+}
+
+func (h *Handler) publishMember(eventType string, groupID, actorID, memberID int, role string) {
+	if h.events == nil {
+		return
+	}
+
+	data := map[string]interface{}{"user_id": memberID}
+	if role != "" {
+		data["role"] = role
+	}
+	h.events.Publish(types.Event{
+		Type:    eventType,
+		GroupID: groupID,
+		ActorID: actorID,
+		Data:    data,
+		At:      time.Now().UTC(),
+	})
+}
@@ -7,6 +7,8 @@ import (
 	"github.com/SibHelly/task-manager-server/types"
 )
 
+const groupSelect = "SELECT group_id, group_name, group_info, require_2fa FROM `groups`"
+
 type Store struct {
 	db *sql.DB
 }
@@ -37,7 +39,7 @@ func (s *Store) CreateGroup(userID int, g types.CreateGroup) error {
 }
 
 func (s *Store) GetGroupIdByName(name string) (*int, error) {
-	rows, err := s.db.Query("SELECT * FROM `groups` WHERE group_name = ?", name)
+	rows, err := s.db.Query(groupSelect+" WHERE group_name = ?", name)
 	if err != nil {
 		return nil, err
 	}
@@ -74,7 +76,7 @@ func (s *Store) GetGroupOwner(group_id int) (string, error) {
 }
 
 func (s *Store) GetGroupByName(name string) (*types.Group, error) {
-	rows, err := s.db.Query("SELECT * FROM `groups` WHERE group_name = ?", name)
+	rows, err := s.db.Query(groupSelect+" WHERE group_name = ?", name)
 	if err != nil {
 		return nil, err
 	}
@@ -93,7 +95,7 @@ func (s *Store) GetGroupByName(name string) (*types.Group, error) {
 }
 
 func (s *Store) GetGroupByID(group_id int) (*types.Group, error) {
-	rows, err := s.db.Query("SELECT * FROM `groups` WHERE group_id = ?", group_id)
+	rows, err := s.db.Query(groupSelect+" WHERE group_id = ?", group_id)
 	if err != nil {
 		return nil, err
 	}
@@ -113,7 +115,7 @@ func (s *Store) GetGroupByID(group_id int) (*types.Group, error) {
 
 func (s *Store) GetGroups(userID int) ([]types.Group, error) {
 	query := `
-    SELECT g.group_id, g.group_name, g.group_info
+    SELECT g.group_id, g.group_name, g.group_info, g.require_2fa
     FROM ` + "`groups`" + ` g
     JOIN inclusions i ON g.group_id = i.group_id
     WHERE i.user_id = ?`
@@ -192,14 +194,15 @@ func (s *Store) UpdateUserRole(user_id, group_id int, role string) error {
 	return nil
 }
 
+// GetUserRole returns the role of the user in the group. A member without
+// 2FA in a group that requires it has no role, so every role check fails
+// for them.
 func (s *Store) GetUserRole(group_id, user_id int) (string, error) {
 
 	query := `SELECT i.role 
-    FROM users u 
-    JOIN inclusions i ON u.user_id = i.user_id 
-    JOIN ` + "`groups`" + ` g ON i.group_id = g.group_id 
-    WHERE i.user_id = ? AND g.group_id = ?`
-	row := s.db.QueryRow(query, user_id, group_id)
+    FROM inclusions i 
+    WHERE i.user_id = ? AND i.group_id = ? AND ` + types.MemberCond("i.group_id")
+	row := s.db.QueryRow(query, user_id, group_id, user_id)
 
 	var role string
 	err := row.Scan(&role)
@@ -211,9 +214,16 @@ func (s *Store) GetUserRole(group_id, user_id int) (string, error) {
 
 }
 
+// memberColumns are the columns scanRowsIntoGroupUsers reads. Contacts the
+// member hides come back empty.
+const memberColumns = `u.user_id, u.name,
+	CASE WHEN u.contact_visibility IN ('phone', 'both') THEN COALESCE(u.phone, '') ELSE '' END,
+	CASE WHEN u.contact_visibility IN ('email', 'both') THEN COALESCE(u.email, '') ELSE '' END,
+	i.role`
+
 func (s *Store) GetUsers(group_id int) ([]types.UsersGroup, error) {
 	query := `
-		SELECT u.user_id, u.name, u.phone, i.role 
+		SELECT ` + memberColumns + `
 		FROM users u
 		JOIN inclusions i ON u.user_id = i.user_id
 		WHERE i.group_id = ?`
@@ -244,10 +254,38 @@ func (s *Store) DeleteUser(user_id, group_id int) error {
 	return nil
 }
 
+func (s *Store) SetRequire2FA(group_id int, required bool) error {
+	_, err := s.db.Exec("UPDATE `groups` SET require_2fa = ? WHERE group_id = ?", required, group_id)
+	return err
+}
+
+func (s *Store) GetMembersWithout2FA(group_id int) ([]types.UsersGroup, error) {
+	query := `
+		SELECT ` + memberColumns + `
+		FROM users u
+		JOIN inclusions i ON u.user_id = i.user_id
+		WHERE i.group_id = ? AND NOT u.totp_enabled`
+	rows, err := s.db.Query(query, group_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]types.UsersGroup, 0)
+	for rows.Next() {
+		u, err := scanRowsIntoGroupUsers(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *u)
+	}
+	return users, rows.Err()
+}
+
 func scanRowsIntoGroups(rows *sql.Rows) (*types.Group, error) {
 	g := new(types.Group)
 
-	err := rows.Scan(&g.ID, &g.Name, &g.Info)
+	err := rows.Scan(&g.ID, &g.Name, &g.Info, &g.Require2FA)
 
 	if err != nil {
 		return nil, err
@@ -259,7 +297,7 @@ func scanRowsIntoGroups(rows *sql.Rows) (*types.Group, error) {
 func scanRowsIntoGroupUsers(rows *sql.Rows) (*types.UsersGroup, error) {
 	u := new(types.UsersGroup)
 
-	err := rows.Scan(&u.ID, &u.Name, &u.Phone, &u.Role)
+	err := rows.Scan(&u.ID, &u.Name, &u.Phone, &u.Email, &u.Role)
 
 	if err != nil {
 		return nil, err
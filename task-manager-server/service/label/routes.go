@@ -0,0 +1,422 @@
+package label
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/SibHelly/task-manager-server/service/auth"
+	"github.com/SibHelly/task-manager-server/types"
+	"github.com/SibHelly/task-manager-server/utils"
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store      types.LabelStore
+	taskStore  types.TasksStore
+	groupStore types.GroupStore
+	userStore  types.UserStore
+}
+
+func NewHandler(store types.LabelStore, taskStore types.TasksStore, groupStore types.GroupStore, userStore types.UserStore) *Handler {
+	return &Handler{store: store, taskStore: taskStore, groupStore: groupStore, userStore: userStore}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/labels", auth.WithJWTAuth(h.handleGetLabels, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/labels", auth.WithJWTAuth(h.handleCreateLabel, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/labels/group/{groupID}", auth.WithJWTAuth(h.handleGetGroupLabels, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/labels/group/{groupID}", auth.WithJWTAuth(h.handleCreateGroupLabel, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/labels/merge", auth.WithJWTAuth(h.handleMergeLabels, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/labels/task/{taskID}", auth.WithJWTAuth(h.handleGetTaskLabels, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/labels/task/{taskID}", auth.WithJWTAuth(h.handleAttachLabels, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/labels/task/{taskID}/{labelID}", auth.WithJWTAuth(h.handleDetachLabel, h.userStore)).Methods(http.MethodDelete)
+	router.HandleFunc("/labels/{labelID}", auth.WithJWTAuth(h.handleUpdateLabel, h.userStore)).Methods(http.MethodPut)
+	router.HandleFunc("/labels/{labelID}", auth.WithJWTAuth(h.handleDeleteLabel, h.userStore)).Methods(http.MethodDelete)
+}
+
+func (h *Handler) handleGetLabels(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	labels, err := h.store.GetLabels(userID, true)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, labels)
+}
+
+func (h *Handler) handleCreateLabel(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	var create types.CreateLabel
+	if err := utils.ParseJSON(r, &create); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if create.Name == "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("label name is required"))
+		return
+	}
+
+	_, err := h.store.GetLabel(userID, create.Name, true)
+	if err == nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("label: %s already exists", create.Name))
+		return
+	}
+
+	err = h.store.CreateLabel(userID, create, true)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusCreated, "Label created")
+}
+
+func (h *Handler) handleGetGroupLabels(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	vars := mux.Vars(r)
+	str, ok := vars["groupID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing group ID"))
+		return
+	}
+
+	groupID, err := strconv.Atoi(str)
+	if err != nil || groupID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid group ID"))
+		return
+	}
+
+	_, err = h.groupStore.GetUserRole(groupID, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you are not a member of this group"))
+		return
+	}
+
+	labels, err := h.store.GetLabels(groupID, false)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, labels)
+}
+
+func (h *Handler) handleCreateGroupLabel(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	vars := mux.Vars(r)
+	str, ok := vars["groupID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing group ID"))
+		return
+	}
+
+	groupID, err := strconv.Atoi(str)
+	if err != nil || groupID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid group ID"))
+		return
+	}
+
+	if !h.canManageGroup(groupID, userID) {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("only group owners and editors can add labels"))
+		return
+	}
+
+	var create types.CreateLabel
+	if err := utils.ParseJSON(r, &create); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if create.Name == "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("label name is required"))
+		return
+	}
+
+	_, err = h.store.GetLabel(groupID, create.Name, false)
+	if err == nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("label: %s already exists", create.Name))
+		return
+	}
+
+	err = h.store.CreateLabel(groupID, create, false)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusCreated, "Label created")
+}
+
+func (h *Handler) handleUpdateLabel(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	vars := mux.Vars(r)
+	str, ok := vars["labelID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing label ID"))
+		return
+	}
+
+	labelID, err := strconv.Atoi(str)
+	if err != nil || labelID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid label ID"))
+		return
+	}
+
+	current, err := h.store.GetLabelByID(labelID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if !h.canManage(current, userID) {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you can not change this label"))
+		return
+	}
+
+	var create types.CreateLabel
+	if err := utils.ParseJSON(r, &create); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if create.Name == "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("label name is required"))
+		return
+	}
+
+	scopeID, flag := scopeOf(current)
+	l, err := h.store.GetLabel(scopeID, create.Name, flag)
+	if err == nil && l.ID != labelID {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("label: %s already exists, merge them instead", create.Name))
+		return
+	}
+
+	err = h.store.UpdateLabel(labelID, create)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, "Label updated")
+}
+
+// handleMergeLabels folds the source label into the target one. Both must
+// belong to the same user or group.
+func (h *Handler) handleMergeLabels(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	var merge types.MergeLabels
+	if err := utils.ParseJSON(r, &merge); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if merge.SourceID == 0 || merge.TargetID == 0 || merge.SourceID == merge.TargetID {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("source_id and target_id must be two different labels"))
+		return
+	}
+
+	source, err := h.store.GetLabelByID(merge.SourceID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	target, err := h.store.GetLabelByID(merge.TargetID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if !h.canManage(source, userID) {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you can not change this label"))
+		return
+	}
+	if source.UserID != target.UserID || source.GroupID != target.GroupID {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("label: %s is not available here", target.Name))
+		return
+	}
+
+	affected, err := h.store.MergeLabels(source.ID, target.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status":         "Labels merged",
+		"affected_tasks": affected,
+	})
+}
+
+func (h *Handler) handleDeleteLabel(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	vars := mux.Vars(r)
+	str, ok := vars["labelID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing label ID"))
+		return
+	}
+
+	labelID, err := strconv.Atoi(str)
+	if err != nil || labelID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid label ID"))
+		return
+	}
+
+	current, err := h.store.GetLabelByID(labelID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if !h.canManage(current, userID) {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you can not delete this label"))
+		return
+	}
+
+	err = h.store.DeleteLabel(labelID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, "Label deleted")
+}
+
+func (h *Handler) handleGetTaskLabels(w http.ResponseWriter, r *http.Request) {
+	task, ok := h.taskFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	labels, err := h.store.GetTaskLabels(task.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, labels)
+}
+
+// handleAttachLabels tags a task. Group tasks take the group's labels,
+// personal tasks the labels of the current user.
+func (h *Handler) handleAttachLabels(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	task, ok := h.taskFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var attach types.AttachLabels
+	if err := utils.ParseJSON(r, &attach); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(attach.LabelIDs) == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("label_ids is required"))
+		return
+	}
+
+	for _, id := range attach.LabelIDs {
+		l, err := h.store.GetLabelByID(id)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("label %d not found", id))
+			return
+		}
+		if (task.Group_id != 0 && l.GroupID != task.Group_id) || (task.Group_id == 0 && l.UserID != userID) {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("label: %s is not available for this task", l.Name))
+			return
+		}
+	}
+
+	err := h.store.AttachLabels(task.ID, attach.LabelIDs)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, "Labels attached")
+}
+
+func (h *Handler) handleDetachLabel(w http.ResponseWriter, r *http.Request) {
+	task, ok := h.taskFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	str, ok := mux.Vars(r)["labelID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing label ID"))
+		return
+	}
+
+	labelID, err := strconv.Atoi(str)
+	if err != nil || labelID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid label ID"))
+		return
+	}
+
+	err = h.store.DetachLabel(task.ID, labelID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, "Label detached")
+}
+
+// taskFromRequest loads the task named by the {taskID} path variable and
+// checks that the current user can see it. It writes the error response
+// itself and reports whether the handler should go on.
+func (h *Handler) taskFromRequest(w http.ResponseWriter, r *http.Request) (*types.Task, bool) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	str, ok := mux.Vars(r)["taskID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing task ID"))
+		return nil, false
+	}
+
+	taskID, err := strconv.Atoi(str)
+	if err != nil || taskID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid task ID"))
+		return nil, false
+	}
+
+	task, err := h.taskStore.GetTaskByID(taskID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return nil, false
+	}
+
+	allowed, err := h.taskStore.CanAccessTask(taskID, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if !allowed {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you have no access to this task"))
+		return nil, false
+	}
+
+	return task, true
+}
+
+// canManage reports whether the user may change the label: their own
+// labels, or those of a group where they are owner or editor.
+func (h *Handler) canManage(l *types.Label, userID int) bool {
+	if l.GroupID != 0 {
+		return h.canManageGroup(l.GroupID, userID)
+	}
+	return l.UserID == userID
+}
+
+func (h *Handler) canManageGroup(groupID, userID int) bool {
+	role, err := h.groupStore.GetUserRole(groupID, userID)
+	return err == nil && (role == "owner" || role == "editor")
+}
+
+// scopeOf returns the ID and flag of the scope the label lives in.
+func scopeOf(l *types.Label) (int, bool) {
+	if l.GroupID != 0 {
+		return l.GroupID, false
+	}
+	return l.UserID, true
+}
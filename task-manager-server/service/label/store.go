@@ -0,0 +1,218 @@
+package label
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/SibHelly/task-manager-server/types"
+)
+
+const labelSelect = `SELECT l.label_id, l.label_name, COALESCE(l.color, ''),
+	COALESCE(l.user_id, 0), COALESCE(l.group_id, 0)
+	FROM labels l`
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// scopeColumn returns the labels column holding the owner: the user when
+// flag is set, the group otherwise.
+func scopeColumn(flag bool) string {
+	if flag {
+		return "l.user_id"
+	}
+	return "l.group_id"
+}
+
+func (s *Store) GetLabels(ID int, flag bool) ([]types.Label, error) {
+	rows, err := s.db.Query(labelSelect+" WHERE "+scopeColumn(flag)+" = ? ORDER BY l.label_name", ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	labels := make([]types.Label, 0)
+	for rows.Next() {
+		l, err := scanRowsIntoLabel(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		labels = append(labels, *l)
+	}
+
+	return labels, rows.Err()
+}
+
+func (s *Store) GetLabel(ID int, name string, flag bool) (*types.Label, error) {
+	rows, err := s.db.Query(labelSelect+" WHERE "+scopeColumn(flag)+" = ? AND l.label_name = ?", ID, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	l := new(types.Label)
+	for rows.Next() {
+		l, err = scanRowsIntoLabel(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if l.ID == 0 {
+		return nil, fmt.Errorf("label not found")
+	}
+	return l, nil
+}
+
+func (s *Store) GetLabelByID(labelID int) (*types.Label, error) {
+	rows, err := s.db.Query(labelSelect+" WHERE l.label_id = ?", labelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	l := new(types.Label)
+	for rows.Next() {
+		l, err = scanRowsIntoLabel(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if l.ID == 0 {
+		return nil, fmt.Errorf("label not found")
+	}
+	return l, nil
+}
+
+func (s *Store) CreateLabel(ID int, l types.CreateLabel, flag bool) error {
+	query := "INSERT INTO labels (label_name, color, group_id) VALUES (?, ?, ?)"
+	if flag {
+		query = "INSERT INTO labels (label_name, color, user_id) VALUES (?, ?, ?)"
+	}
+
+	_, err := s.db.Exec(query, l.Name, nullIfEmpty(l.Color), ID)
+	return err
+}
+
+func (s *Store) UpdateLabel(labelID int, l types.CreateLabel) error {
+	_, err := s.db.Exec("UPDATE labels SET label_name = ?, color = ? WHERE label_id = ?", l.Name, nullIfEmpty(l.Color), labelID)
+	return err
+}
+
+// MergeLabels moves every task tagged with the source label to the target
+// label and removes the source. It returns the number of tasks that gained
+// the target label.
+func (s *Store) MergeLabels(sourceID, targetID int) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`INSERT IGNORE INTO task_labels (task_id, label_id)
+		SELECT task_id, ? FROM task_labels WHERE label_id = ?`, targetID, sourceID)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("DELETE FROM labels WHERE label_id = ?", sourceID)
+	if err != nil {
+		return 0, err
+	}
+
+	return affected, tx.Commit()
+}
+
+func (s *Store) DeleteLabel(labelID int) error {
+	_, err := s.db.Exec("DELETE FROM labels WHERE label_id = ?", labelID)
+	return err
+}
+
+func (s *Store) GetTaskLabels(taskID int) ([]types.Label, error) {
+	rows, err := s.db.Query(labelSelect+`
+	JOIN task_labels tl ON tl.label_id = l.label_id
+	WHERE tl.task_id = ?
+	ORDER BY l.label_name`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	labels := make([]types.Label, 0)
+	for rows.Next() {
+		l, err := scanRowsIntoLabel(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		labels = append(labels, *l)
+	}
+
+	return labels, rows.Err()
+}
+
+// AttachLabels tags the task with the labels. Labels already on the task
+// are left as they are.
+func (s *Store) AttachLabels(taskID int, labelIDs []int) error {
+	if len(labelIDs) == 0 {
+		return nil
+	}
+
+	values := make([]string, len(labelIDs))
+	args := make([]interface{}, 0, 2*len(labelIDs))
+	for i, id := range labelIDs {
+		values[i] = "(?, ?)"
+		args = append(args, taskID, id)
+	}
+
+	_, err := s.db.Exec("INSERT IGNORE INTO task_labels (task_id, label_id) VALUES "+strings.Join(values, ", "), args...)
+	return err
+}
+
+func (s *Store) DetachLabel(taskID, labelID int) error {
+	res, err := s.db.Exec("DELETE FROM task_labels WHERE task_id = ? AND label_id = ?", taskID, labelID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("label is not attached to this task")
+	}
+	return nil
+}
+
+func scanRowsIntoLabel(rows *sql.Rows) (*types.Label, error) {
+	l := new(types.Label)
+
+	err := rows.Scan(
+		&l.ID,
+		&l.Name,
+		&l.Color,
+		&l.UserID,
+		&l.GroupID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
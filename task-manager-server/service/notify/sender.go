@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/SibHelly/task-manager-server/types"
+)
+
+// LogSender writes messages to the server log.
+type LogSender struct{}
+
+func (LogSender) Send(m types.Message) error {
+	log.Printf("message to %s: %s: %s", m.To, m.Subject, m.Body)
+	return nil
+}
+
+// FileSender appends messages to a file, so local tools and tests can read
+// them back.
+type FileSender struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileSender(path string) *FileSender {
+	return &FileSender{path: path}
+}
+
+func (s *FileSender) Send(m types.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(f, "%s\nTo: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().UTC().Format(time.RFC3339), m.To, m.Subject, m.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// FromConfig returns the sender named by kind: "file" writes to path, and
+// anything else logs.
+func FromConfig(kind, path string) types.MessageSender {
+	if kind == "file" && path != "" {
+		return NewFileSender(path)
+	}
+	return LogSender{}
+}
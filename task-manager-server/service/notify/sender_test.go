@@ -0,0 +1,33 @@
+package notify
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SibHelly/task-manager-server/types"
+)
+
+func TestFileSender(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.txt")
+	s := NewFileSender(path)
+
+	for _, code := range []string{"11112222", "33334444"} {
+		err := s.Send(types.Message{To: "79991234567", Subject: "Password reset", Body: "Your code is " + code})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(b)
+	for _, want := range []string{"To: 79991234567", "Subject: Password reset", "Your code is 11112222", "Your code is 33334444"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("file is missing %q:\n%s", want, out)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/SibHelly/task-manager-server/service/auth"
 	"github.com/SibHelly/task-manager-server/types"
@@ -12,39 +13,81 @@ import (
 )
 
 type Handler struct {
-	store     types.PriorityStore
-	userStore types.UserStore
+	store      types.PriorityStore
+	groupStore types.GroupStore
+	userStore  types.UserStore
 }
 
-func NewHandler(store types.PriorityStore, userStore types.UserStore) *Handler {
-	return &Handler{store: store, userStore: userStore}
+func NewHandler(store types.PriorityStore, groupStore types.GroupStore, userStore types.UserStore) *Handler {
+	return &Handler{store: store, groupStore: groupStore, userStore: userStore}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
-
 	router.HandleFunc("/priority", auth.WithJWTAuth(h.handleGetPriorities, h.userStore)).Methods(http.MethodGet)
 	router.HandleFunc("/priority", auth.WithJWTAuth(h.handleCreatePriority, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/priority/group/{groupID}", auth.WithJWTAuth(h.handleGetGroupPriorities, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/priority/group/{groupID}", auth.WithJWTAuth(h.handleCreateGroupPriority, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/priority/order", auth.WithJWTAuth(h.handleReorderPriorities, h.userStore)).Methods(http.MethodPut)
 	router.HandleFunc("/priority/{priorityID}", auth.WithJWTAuth(h.handleDeletePriority, h.userStore)).Methods(http.MethodDelete)
 	router.HandleFunc("/priority/{priorityID}", auth.WithJWTAuth(h.handleUpdatePriority, h.userStore)).Methods(http.MethodPut)
 }
 
 func (h *Handler) handleCreatePriority(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
 	var create types.CreatePriority
 	if err := utils.ParseJSON(r, &create); err != nil {
 		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	_, err := h.store.GetPriority(create.Name)
+	_, err := h.store.GetPriority(userID, create.Name, true)
 	if err == nil {
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("priority: %s already exists", create.Name))
 		return
 	}
 
-	err = h.store.CreatePriority(types.CreatePriority{
-		Name:  create.Name,
-		Color: create.Color,
-	})
+	err = h.store.CreatePriority(userID, create, true)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusCreated, "Priority created")
+}
+
+func (h *Handler) handleCreateGroupPriority(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	vars := mux.Vars(r)
+	str, ok := vars["groupID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing group ID"))
+		return
+	}
+
+	groupID, err := strconv.Atoi(str)
+	if err != nil || groupID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid group ID"))
+		return
+	}
+
+	if !h.canManageGroup(groupID, userID) {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("only group owners and editors can add priorities"))
+		return
+	}
+
+	var create types.CreatePriority
+	if err := utils.ParseJSON(r, &create); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	_, err = h.store.GetPriority(groupID, create.Name, false)
+	if err == nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("priority: %s already exists", create.Name))
+		return
+	}
+
+	err = h.store.CreatePriority(groupID, create, false)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -54,15 +97,48 @@ func (h *Handler) handleCreatePriority(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) handleGetPriorities(w http.ResponseWriter, r *http.Request) {
-	st, err := h.store.GetPriorities()
+	userID := auth.GetUserIDFromContext(r.Context())
+	p, err := h.store.GetPriorities(userID, true)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, p)
+}
+
+func (h *Handler) handleGetGroupPriorities(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	vars := mux.Vars(r)
+	str, ok := vars["groupID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing group ID"))
+		return
+	}
+
+	groupID, err := strconv.Atoi(str)
+	if err != nil || groupID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid group ID"))
+		return
+	}
+
+	_, err = h.groupStore.GetUserRole(groupID, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you are not a member of this group"))
+		return
+	}
+
+	p, err := h.store.GetPriorities(groupID, false)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
 	}
 
-	utils.WriteJson(w, http.StatusOK, st)
+	utils.WriteJson(w, http.StatusOK, p)
 }
 
 func (h *Handler) handleUpdatePriority(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	str, ok := vars["priorityID"]
 	if !ok {
@@ -76,13 +152,36 @@ func (h *Handler) handleUpdatePriority(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var create types.CreatePriority
+	current, err := h.store.GetPriorityByID(priorityID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if !h.canManage(current, userID) {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you can not change this priority"))
+		return
+	}
+
+	// Fields left out of the request keep their stored values.
+	create := types.CreatePriority{
+		Name:     current.Name,
+		Color:    current.Color,
+		Weight:   current.Weight,
+		Position: current.Position,
+	}
 	if err := utils.ParseJSON(r, &create); err != nil {
 		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
-	_, err = h.store.GetPriority(create.Name)
-	if err == nil {
+	if strings.TrimSpace(create.Name) == "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("priority name must not be empty"))
+		return
+	}
+
+	scopeID, flag := scopeOf(current)
+	p, err := h.store.GetPriority(scopeID, create.Name, flag)
+	if err == nil && p.ID != priorityID {
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("priority: %s already exists", create.Name))
 		return
 	}
@@ -96,7 +195,40 @@ func (h *Handler) handleUpdatePriority(w http.ResponseWriter, r *http.Request) {
 	utils.WriteJson(w, http.StatusOK, "Priority updated")
 }
 
+func (h *Handler) handleReorderPriorities(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	var order types.ReorderPriorities
+	if err := utils.ParseJSON(r, &order); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	for _, id := range order.PriorityIDs {
+		p, err := h.store.GetPriorityByID(id)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("priority %d not found", id))
+			return
+		}
+		if !h.canManage(p, userID) {
+			utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you can not change priority %d", id))
+			return
+		}
+	}
+
+	err := h.store.ReorderPriorities(order.PriorityIDs)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, "Priority updated")
+}
+
+// handleDeletePriority removes a custom priority. Tasks that use it are moved to
+// the priority given in ?replace_with=, which must be a system default or belong
+// to the same user or group.
 func (h *Handler) handleDeletePriority(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	str, ok := vars["priorityID"]
 	if !ok {
@@ -110,11 +242,90 @@ func (h *Handler) handleDeletePriority(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.store.DeletePriority(priorityID)
+	current, err := h.store.GetPriorityByID(priorityID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if !h.canManage(current, userID) {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you can not delete this priority"))
+		return
+	}
+
+	replaceWith := 0
+	if str := r.URL.Query().Get("replace_with"); str != "" {
+		replaceWith, err = strconv.Atoi(str)
+		if err != nil || replaceWith == priorityID {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid replacement priority ID"))
+			return
+		}
+
+		rep, err := h.store.GetPriorityByID(replaceWith)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		if !sameScope(current, rep) {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("priority: %s is not available here", rep.Name))
+			return
+		}
+	}
+
+	affected, err := h.store.DeletePriority(priorityID, replaceWith)
+	if err == ErrPriorityInUse {
+		usage, err := h.store.GetPriorityUsage(priorityID)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		utils.WriteJson(w, http.StatusConflict, map[string]interface{}{
+			"error": fmt.Sprintf("priority is used by %d tasks, pass replace_with to move them", usage.Tasks),
+			"usage": usage,
+		})
+		return
+	}
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	utils.WriteJson(w, http.StatusOK, "Priority deleted")
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status":         "Priority deleted",
+		"affected_tasks": affected,
+	})
+}
+
+// canManage reports whether the user may change the priority: their own
+// priorities, or those of a group where they are owner or editor. System
+// defaults are read-only.
+func (h *Handler) canManage(p *types.Priority, userID int) bool {
+	if p.UserID != 0 {
+		return p.UserID == userID
+	}
+	if p.GroupID != 0 {
+		return h.canManageGroup(p.GroupID, userID)
+	}
+	return false
+}
+
+func (h *Handler) canManageGroup(groupID, userID int) bool {
+	role, err := h.groupStore.GetUserRole(groupID, userID)
+	return err == nil && (role == "owner" || role == "editor")
+}
+
+// scopeOf returns the ID and flag of the scope the priority lives in.
+func scopeOf(p *types.Priority) (int, bool) {
+	if p.GroupID != 0 {
+		return p.GroupID, false
+	}
+	return p.UserID, true
+}
+
+// sameScope reports whether rep is visible wherever p is.
+func sameScope(p, rep *types.Priority) bool {
+	if rep.UserID == 0 && rep.GroupID == 0 {
+		return true
+	}
+	return rep.UserID == p.UserID && rep.GroupID == p.GroupID
 }
@@ -7,6 +7,19 @@ import (
 	"github.com/SibHelly/task-manager-server/types"
 )
 
+const prioritySelect = `SELECT pm.priority_id, pm.priority_name, pm.color, pm.weight, pm.position,
+	COALESCE(up.user_id, 0), COALESCE(gp.group_id, 0)
+	FROM priority_map pm
+	LEFT JOIN users_priorities up ON up.priority_id = pm.priority_id
+	LEFT JOIN groups_priorities gp ON gp.priority_id = pm.priority_id`
+
+// systemCond matches the priorities that belong to nobody: the system defaults.
+const systemCond = "(up.priority_id IS NULL AND gp.priority_id IS NULL)"
+
+// ErrPriorityInUse is returned when a priority still used by tasks is
+// deleted without a replacement.
+var ErrPriorityInUse = fmt.Errorf("priority is used by tasks")
+
 type Store struct {
 	db *sql.DB
 }
@@ -15,8 +28,10 @@ func NewStore(db *sql.DB) *Store {
 	return &Store{db: db}
 }
 
-func (s *Store) GetPriorities() ([]types.Priority, error) {
-	rows, err := s.db.Query("SELECT * FROM priority_map")
+// GetPriorities returns the system defaults together with the priorities of
+// the user (flag set) or of the group.
+func (s *Store) GetPriorities(ID int, flag bool) ([]types.Priority, error) {
+	rows, err := s.db.Query(prioritySelect+" WHERE "+scopeCond(flag)+" ORDER BY pm.position, pm.priority_id", ID)
 	if err != nil {
 		return nil, err
 	}
@@ -35,8 +50,8 @@ func (s *Store) GetPriorities() ([]types.Priority, error) {
 
 }
 
-func (s *Store) GetPriority(priority_name string) (*types.Priority, error) {
-	rows, err := s.db.Query("SELECT * FROM priority_map WHERE priority_name = ?", priority_name)
+func (s *Store) GetPriority(ID int, priority_name string, flag bool) (*types.Priority, error) {
+	rows, err := s.db.Query(prioritySelect+" WHERE "+scopeCond(flag)+" AND pm.priority_name = ?", ID, priority_name)
 	if err != nil {
 		return nil, err
 	}
@@ -55,7 +70,7 @@ func (s *Store) GetPriority(priority_name string) (*types.Priority, error) {
 }
 
 func (s *Store) GetPriorityByID(priorityID int) (*types.Priority, error) {
-	rows, err := s.db.Query("SELECT * FROM priority_map WHERE priority_id = ?", priorityID)
+	rows, err := s.db.Query(prioritySelect+" WHERE pm.priority_id = ?", priorityID)
 	if err != nil {
 		return nil, err
 	}
@@ -73,32 +88,127 @@ func (s *Store) GetPriorityByID(priorityID int) (*types.Priority, error) {
 	return p, nil
 }
 
-func (s *Store) CreatePriority(p types.CreatePriority) error {
-	_, err := s.db.Exec("INSERT INTO priority_map (priority_name, color) VALUES (? , ?)", p.Name, p.Color)
+func (s *Store) CreatePriority(ID int, p types.CreatePriority, flag bool) error {
+	res, err := s.db.Exec(
+		"INSERT INTO priority_map (priority_name, color, weight, position) VALUES (?, ?, ?, ?)",
+		p.Name, p.Color, p.Weight, p.Position,
+	)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if flag {
+		_, err = s.db.Exec("INSERT INTO users_priorities (user_id, priority_id) VALUES (?, ?)", ID, id)
+		if err != nil {
+			return err
+		}
+		return nil
+	}
+	_, err = s.db.Exec("INSERT INTO groups_priorities (group_id, priority_id) VALUES (?, ?)", ID, id)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s *Store) DeletePriority(priorityID int) error {
-	_, err := s.db.Exec("DELETE FROM priority_map WHERE priority_id = ?", priorityID)
+// DeletePriority moves the tasks using the priority to replaceWith and removes
+// the priority in one transaction. It returns the number of tasks moved.
+// Without a replacement it fails with ErrPriorityInUse while tasks use the
+// priority.
+func (s *Store) DeletePriority(priorityID, replaceWith int) (int64, error) {
+	tx, err := s.db.Begin()
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+	defer tx.Rollback()
+
+	// Locking the priority keeps tasks from taking it up until we are done.
+	var id int
+	err = tx.QueryRow("SELECT priority_id FROM priority_map WHERE priority_id = ? FOR UPDATE", priorityID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("priority not found")
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var affected int64
+	if replaceWith == 0 {
+		var used bool
+		err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM tasks WHERE priority_id = ?)", priorityID).Scan(&used)
+		if err != nil {
+			return 0, err
+		}
+		if used {
+			return 0, ErrPriorityInUse
+		}
+	} else {
+		res, err := tx.Exec("UPDATE tasks SET priority_id = ? WHERE priority_id = ?", replaceWith, priorityID)
+		if err != nil {
+			return 0, err
+		}
+		affected, err = res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.Exec("DELETE FROM priority_map WHERE priority_id = ?", priorityID)
+	if err != nil {
+		return 0, err
+	}
+
+	return affected, tx.Commit()
+}
+
+func (s *Store) GetPriorityUsage(priorityID int) (*types.TaskUsage, error) {
+	query := `SELECT COUNT(*),
+		COALESCE(SUM(NOT EXISTS (SELECT 1 FROM status_map fs WHERE fs.status_id = t.status_id AND fs.is_final)), 0),
+		COALESCE(SUM(t.parent_task_id IS NOT NULL), 0)
+	FROM tasks t WHERE t.priority_id = ?`
+
+	u := new(types.TaskUsage)
+	err := s.db.QueryRow(query, priorityID).Scan(&u.Tasks, &u.OpenTasks, &u.Subtasks)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
 }
 
 func (s *Store) UpdatePriority(priorityID int, p types.CreatePriority) error {
-	_, err := s.db.Exec("UPDATE priority_map SET priority_name = ? , color = ? WHERE priority_id = ?", p.Name, p.Color, priorityID)
+	_, err := s.db.Exec(
+		"UPDATE priority_map SET priority_name = ?, color = ?, weight = ?, position = ? WHERE priority_id = ?",
+		p.Name, p.Color, p.Weight, p.Position, priorityID,
+	)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// ReorderPriorities sets the position of each priority to its index in the list.
+func (s *Store) ReorderPriorities(priorityIDs []int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i, id := range priorityIDs {
+		_, err = tx.Exec("UPDATE priority_map SET position = ? WHERE priority_id = ?", i, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
 func (s *Store) GetPriorityIDbyName(name string) (*int, error) {
-	rows, err := s.db.Query("SELECT * FROM priority_map WHERE priority_name = ?", name)
+	rows, err := s.db.Query(prioritySelect+" WHERE pm.priority_name = ?", name)
 	if err != nil {
 		return nil, err
 	}
@@ -118,14 +228,31 @@ func (s *Store) GetPriorityIDbyName(name string) (*int, error) {
 	return &id, nil
 }
 
+func scopeCond(flag bool) string {
+	if flag {
+		return "(up.user_id = ? OR " + systemCond + ")"
+	}
+	return "(gp.group_id = ? OR " + systemCond + ")"
+}
+
 func scanRowsIntoPriority(rows *sql.Rows) (*types.Priority, error) {
 	priority := new(types.Priority)
 
-	err := rows.Scan(&priority.ID, &priority.Name, &priority.Color)
+	var color sql.NullString
+	err := rows.Scan(
+		&priority.ID,
+		&priority.Name,
+		&color,
+		&priority.Weight,
+		&priority.Position,
+		&priority.UserID,
+		&priority.GroupID,
+	)
 
 	if err != nil {
 		return nil, err
 	}
+	priority.Color = color.String
 
 	return priority, nil
 }
@@ -0,0 +1,103 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SibHelly/task-manager-server/types"
+	"github.com/SibHelly/task-manager-server/utils"
+)
+
+// Limiter allows Limit hits per key in every Window.
+type Limiter struct {
+	store  types.RateLimitStore
+	prefix string
+	Limit  int
+	Window time.Duration
+	now    func() time.Time
+}
+
+// Result tells whether a hit was allowed, how many are left in the window
+// and, when it was not, how long until the window ends.
+type Result struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// NewLimiter returns a limiter keeping its counts in store under prefix, so
+// several limiters can share one store.
+func NewLimiter(store types.RateLimitStore, prefix string, limit int, window time.Duration) *Limiter {
+	return &Limiter{
+		store:  store,
+		prefix: prefix,
+		Limit:  limit,
+		Window: window,
+		now:    func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Allow counts a hit for the key.
+func (l *Limiter) Allow(key string) (Result, error) {
+	now := l.now()
+	n, ends, err := l.store.Incr(l.prefix+key, l.Window, now)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if n > l.Limit {
+		return Result{RetryAfter: ends.Sub(now)}, nil
+	}
+	return Result{Allowed: true, Remaining: l.Limit - n}, nil
+}
+
+// Reset forgets the key's hits.
+func (l *Limiter) Reset(key string) error {
+	return l.store.Reset(l.prefix + key)
+}
+
+// Middleware limits requests per client IP. Requests over the limit get 429
+// with a Retry-After header. If the store fails the request goes through.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, err := l.Allow(ClientIP(r))
+		if err != nil {
+			log.Printf("rate limit: %v", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(l.Limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		if !res.Allowed {
+			TooManyRequests(w, res.RetryAfter, fmt.Errorf("too many requests, try again later"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// TooManyRequests writes a 429 answer telling when to retry.
+func TooManyRequests(w http.ResponseWriter, retryAfter time.Duration, err error) {
+	secs := int((retryAfter + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	utils.WriteError(w, http.StatusTooManyRequests, err)
+}
+
+// ClientIP returns the IP the request came from. Forwarding headers are not
+// trusted, since any client can set them.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"time"
+
+	"github.com/SibHelly/task-manager-server/types"
+)
+
+// Lockout locks a key out after Threshold failures within FailureWindow.
+// The first lock lasts BaseLock and every failure after it doubles the
+// next one, up to MaxLock. A success clears the failures.
+type Lockout struct {
+	store         types.RateLimitStore
+	prefix        string
+	Threshold     int
+	FailureWindow time.Duration
+	BaseLock      time.Duration
+	MaxLock       time.Duration
+	now           func() time.Time
+}
+
+func NewLockout(store types.RateLimitStore, prefix string, threshold int, failureWindow, baseLock, maxLock time.Duration) *Lockout {
+	return &Lockout{
+		store:         store,
+		prefix:        prefix,
+		Threshold:     threshold,
+		FailureWindow: failureWindow,
+		BaseLock:      baseLock,
+		MaxLock:       maxLock,
+		now:           func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Locked reports how long the key is still locked out, or 0.
+func (l *Lockout) Locked(key string) (time.Duration, error) {
+	now := l.now()
+	n, ends, err := l.store.Get(l.prefix+"lock:"+key, now)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	return ends.Sub(now), nil
+}
+
+// Fail records a failure and returns how long the key is now locked out, or
+// 0 when it is still under the threshold.
+func (l *Lockout) Fail(key string) (time.Duration, error) {
+	now := l.now()
+	n, _, err := l.store.Incr(l.prefix+"fail:"+key, l.FailureWindow, now)
+	if err != nil || n < l.Threshold {
+		return 0, err
+	}
+
+	d := l.lockFor(n - l.Threshold)
+	if _, _, err := l.store.Incr(l.prefix+"lock:"+key, d, now); err != nil {
+		return 0, err
+	}
+	return d, nil
+}
+
+// Succeed clears the key's failures.
+func (l *Lockout) Succeed(key string) error {
+	return l.store.Reset(l.prefix + "fail:" + key)
+}
+
+// lockFor returns the lock after the given number of failures past the
+// threshold.
+func (l *Lockout) lockFor(over int) time.Duration {
+	d := l.BaseLock
+	for i := 0; i < over; i++ {
+		d *= 2
+		if d >= l.MaxLock {
+			return l.MaxLock
+		}
+	}
+	return d
+}
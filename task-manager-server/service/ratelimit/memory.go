@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepEvery is how many new windows the memory store opens between sweeps
+// of expired ones.
+const sweepEvery = 1024
+
+type window struct {
+	count int
+	ends  time.Time
+}
+
+// MemoryStore keeps the windows in the process. It is the default store.
+type MemoryStore struct {
+	mu      sync.Mutex
+	windows map[string]*window
+	opened  int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{windows: make(map[string]*window)}
+}
+
+func (s *MemoryStore) Incr(key string, length time.Duration, now time.Time) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, ok := s.windows[key]
+	if !ok || !now.Before(w.ends) {
+		s.sweep(now)
+		w = &window{ends: now.Add(length)}
+		s.windows[key] = w
+	}
+	w.count++
+	return w.count, w.ends, nil
+}
+
+func (s *MemoryStore) Get(key string, now time.Time) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, ok := s.windows[key]
+	if !ok || !now.Before(w.ends) {
+		return 0, time.Time{}, nil
+	}
+	return w.count, w.ends, nil
+}
+
+func (s *MemoryStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.windows, key)
+	return nil
+}
+
+// sweep drops expired windows now and then so idle keys do not pile up.
+func (s *MemoryStore) sweep(now time.Time) {
+	s.opened++
+	if s.opened < sweepEvery {
+		return
+	}
+	s.opened = 0
+	for k, w := range s.windows {
+		if !now.Before(w.ends) {
+			delete(s.windows, k)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreWindows(t *testing.T) {
+	s := NewMemoryStore()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 1; i <= 3; i++ {
+		n, ends, _ := s.Incr("k", time.Minute, now.Add(time.Duration(i)*time.Second))
+		if n != i || !ends.Equal(now.Add(time.Second+time.Minute)) {
+			t.Fatalf("hit %d: count %d, window ends %s", i, n, ends)
+		}
+	}
+
+	if n, _, _ := s.Get("k", now.Add(time.Minute)); n != 3 {
+		t.Errorf("Get in the window = %d, want 3", n)
+	}
+	if n, _, _ := s.Get("k", now.Add(time.Minute+time.Second)); n != 0 {
+		t.Errorf("Get after the window = %d, want 0", n)
+	}
+	if n, _, _ := s.Incr("k", time.Minute, now.Add(2*time.Minute)); n != 1 {
+		t.Errorf("first hit of a new window = %d, want 1", n)
+	}
+
+	s.Reset("k")
+	if n, _, _ := s.Get("k", now.Add(2*time.Minute)); n != 0 {
+		t.Errorf("Get after Reset = %d, want 0", n)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter(NewMemoryStore(), "t:", 3, time.Minute)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		res, _ := l.Allow("a")
+		if !res.Allowed || res.Remaining != 2-i {
+			t.Fatalf("hit %d: %+v", i+1, res)
+		}
+	}
+
+	now = now.Add(20 * time.Second)
+	res, _ := l.Allow("a")
+	if res.Allowed || res.RetryAfter != 40*time.Second {
+		t.Errorf("hit over the limit: %+v", res)
+	}
+	if res, _ := l.Allow("b"); !res.Allowed {
+		t.Error("another key was limited")
+	}
+
+	now = now.Add(40 * time.Second)
+	if res, _ := l.Allow("a"); !res.Allowed {
+		t.Error("still limited in the next window")
+	}
+}
+
+func TestLockout(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	l := NewLockout(NewMemoryStore(), "t:", 3, time.Hour, time.Minute, 5*time.Minute)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if d, _ := l.Fail("p"); d != 0 {
+			t.Fatalf("locked after %d failures", i+1)
+		}
+	}
+
+	for i, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute} {
+		d, _ := l.Fail("p")
+		if d != want {
+			t.Fatalf("lock %d = %s, want %s", i+1, d, want)
+		}
+		if left, _ := l.Locked("p"); left != want {
+			t.Fatalf("lock %d: Locked = %s, want %s", i+1, left, want)
+		}
+		now = now.Add(d)
+		if left, _ := l.Locked("p"); left != 0 {
+			t.Fatalf("lock %d did not run out", i+1)
+		}
+	}
+
+	l.Succeed("p")
+	if d, _ := l.Fail("p"); d != 0 {
+		t.Error("a success did not clear the failures")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	l := NewLimiter(NewMemoryStore(), "api:", 2, time.Minute)
+	h := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	codes := make([]int, 0)
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/tasks", nil)
+		req.RemoteAddr = "10.0.0.1:5000"
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		codes = append(codes, rr.Code)
+
+		if i == 2 && rr.Header().Get("Retry-After") == "" {
+			t.Error("429 without Retry-After")
+		}
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("status codes %v", codes)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/tasks", nil)
+	req.RemoteAddr = "10.0.0.2:5000"
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("another client was limited: %d", rr.Code)
+	}
+}
@@ -0,0 +1,118 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// A snippet shows at most snippetWidth runes of the text, starting up to
+// snippetLead runes before the first match.
+const (
+	snippetWidth = 160
+	snippetLead  = 40
+)
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// terms splits the user's query into lower-cased words, dropping everything
+// that is not a letter or a digit, so boolean mode operators can not be
+// injected.
+func terms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !isWordRune(r) })
+
+	seen := make(map[string]bool, len(words))
+	out := make([]string, 0, len(words))
+	for _, w := range words {
+		if !seen[w] {
+			seen[w] = true
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// booleanQuery requires every term, each as a prefix: "+deploy* +api*".
+func booleanQuery(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, t := range terms {
+		parts[i] = "+" + t + "*"
+	}
+	return strings.Join(parts, " ")
+}
+
+// snippet cuts the part of text around the first match and marks every word
+// starting with one of the terms. The result is HTML-escaped.
+func snippet(text string, terms []string) string {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	type span struct{ start, end int }
+	var matches []span
+	for i := 0; i < len(lower); i++ {
+		if i > 0 && isWordRune(lower[i-1]) {
+			continue
+		}
+		if !hasTermAt(lower, i, terms) {
+			continue
+		}
+		end := i
+		for end < len(lower) && isWordRune(lower[end]) {
+			end++
+		}
+		matches = append(matches, span{i, end})
+		i = end
+	}
+
+	from := 0
+	if len(matches) > 0 && matches[0].start > snippetLead {
+		from = matches[0].start - snippetLead
+	}
+	to := from + snippetWidth
+	if to > len(runes) {
+		to = len(runes)
+		from = max(0, to-snippetWidth)
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	pos := from
+	for _, m := range matches {
+		if m.end <= from {
+			continue
+		}
+		if m.start >= to {
+			break
+		}
+		start, end := max(m.start, from), min(m.end, to)
+		b.WriteString(html.EscapeString(string(runes[pos:start])))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(string(runes[start:end])))
+		b.WriteString("</mark>")
+		pos = end
+	}
+	b.WriteString(html.EscapeString(string(runes[pos:to])))
+	if to < len(runes) {
+		b.WriteString("…")
+	}
+
+	return b.String()
+}
+
+// hasTermAt reports whether one of the terms starts at lower[i].
+func hasTermAt(lower []rune, i int, terms []string) bool {
+	for _, t := range terms {
+		tr := []rune(t)
+		if i+len(tr) <= len(lower) && string(lower[i:i+len(tr)]) == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package search
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTerms(t *testing.T) {
+	got := terms(`Deploy +API* "deploy" -(x)`)
+	want := []string{"deploy", "api", "x"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("terms = %v, want %v", got, want)
+	}
+
+	if q := booleanQuery(got); q != "+deploy* +api* +x*" {
+		t.Errorf("booleanQuery = %q", q)
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		terms []string
+		want  string
+	}{
+		{
+			name:  "marks whole words by prefix",
+			text:  "Deployment of the API failed",
+			terms: []string{"deploy", "api"},
+			want:  "<mark>Deployment</mark> of the <mark>API</mark> failed",
+		},
+		{
+			name:  "ignores matches inside words",
+			text:  "rapid api",
+			terms: []string{"api"},
+			want:  "rapid <mark>api</mark>",
+		},
+		{
+			name:  "escapes html",
+			text:  "<b>fix</b> & ship",
+			terms: []string{"fix"},
+			want:  "&lt;b&gt;<mark>fix</mark>&lt;/b&gt; &amp; ship",
+		},
+		{
+			name:  "non latin text",
+			text:  "Исправить отчёт",
+			terms: []string{"отч"},
+			want:  "Исправить <mark>отчёт</mark>",
+		},
+		{
+			name:  "no match",
+			text:  "nothing here",
+			terms: []string{"zzz"},
+			want:  "nothing here",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := snippet(tt.text, tt.terms); got != tt.want {
+				t.Errorf("snippet = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnippetWindow(t *testing.T) {
+	text := strings.Repeat("a ", 100) + "needle" + strings.Repeat(" b", 100)
+	got := snippet(text, []string{"needle"})
+
+	if !strings.HasPrefix(got, "…") || !strings.HasSuffix(got, "…") {
+		t.Errorf("snippet should be cut on both sides: %q", got)
+	}
+	if !strings.Contains(got, "<mark>needle</mark>") {
+		t.Errorf("snippet lost the match: %q", got)
+	}
+	plain := strings.NewReplacer("<mark>", "", "</mark>", "", "…", "").Replace(got)
+	if n := len([]rune(plain)); n != snippetWidth {
+		t.Errorf("snippet has %d runes, want %d", n, snippetWidth)
+	}
+}
@@ -0,0 +1,92 @@
+package search
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/SibHelly/task-manager-server/service/auth"
+	"github.com/SibHelly/task-manager-server/types"
+	"github.com/SibHelly/task-manager-server/utils"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+type Handler struct {
+	engine    types.SearchEngine
+	userStore types.UserStore
+}
+
+func NewHandler(engine types.SearchEngine, userStore types.UserStore) *Handler {
+	return &Handler{engine: engine, userStore: userStore}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/search", auth.WithJWTAuth(h.handleSearch, h.userStore)).Methods(http.MethodGet)
+}
+
+// handleSearch serves ?q= with optional ?type= (comma separated task, chat,
+// comment), ?limit= and ?offset=.
+func (h *Handler) handleSearch(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	query := r.URL.Query()
+
+	q := types.SearchQuery{
+		Text:  strings.TrimSpace(query.Get("q")),
+		Limit: defaultSearchLimit,
+	}
+	if len(terms(q.Text)) == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("q must contain at least one word"))
+		return
+	}
+
+	if str := query.Get("type"); str != "" {
+		for _, t := range strings.Split(str, ",") {
+			t = strings.TrimSpace(t)
+			switch t {
+			case types.SearchTypeTask, types.SearchTypeChat, types.SearchTypeComment:
+				q.Types = append(q.Types, t)
+			default:
+				utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("unknown search type: %s", t))
+				return
+			}
+		}
+	}
+
+	if str := query.Get("limit"); str != "" {
+		l, err := strconv.Atoi(str)
+		if err != nil || l < 1 || l > maxSearchLimit {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxSearchLimit))
+			return
+		}
+		q.Limit = l
+	}
+
+	if str := query.Get("offset"); str != "" {
+		o, err := strconv.Atoi(str)
+		if err != nil || o < 0 {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid offset"))
+			return
+		}
+		q.Offset = o
+	}
+
+	res, err := h.engine.Search(userID, q)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status":  "Search results",
+		"total":   res.Total,
+		"limit":   q.Limit,
+		"offset":  q.Offset,
+		"results": res.Results,
+	})
+}
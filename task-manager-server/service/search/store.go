@@ -0,0 +1,113 @@
+package search
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/SibHelly/task-manager-server/types"
+)
+
+// visibleCond matches the tasks t the user is responsible for or that belong
+// to one of their groups.
+var visibleCond = `(EXISTS (SELECT 1 FROM do_users du WHERE du.task_id = t.task_id AND du.user_id = ?)
+	OR ` + types.MemberCond("t.group_id") + `)`
+
+// Each part selects type, id, task_id, chat_id, title, text and score, named
+// in every part since any of them may come first in the union.
+var searchParts = map[string]string{
+	types.SearchTypeTask: `SELECT 'task' AS type, t.task_id AS id, t.task_id, 0 AS chat_id,
+		t.task_name AS title, COALESCE(t.task_description, '') AS text,
+		MATCH(t.task_name, t.task_description) AGAINST (? IN BOOLEAN MODE) AS score
+	FROM tasks t
+	WHERE MATCH(t.task_name, t.task_description) AGAINST (? IN BOOLEAN MODE) AND ` + visibleCond,
+	types.SearchTypeChat: `SELECT 'chat' AS type, c.chat_id AS id, c.task_id, c.chat_id,
+		c.chat_name AS title, c.chat_name AS text,
+		MATCH(c.chat_name) AGAINST (? IN BOOLEAN MODE) AS score
+	FROM chats c
+	JOIN tasks t ON t.task_id = c.task_id
+	WHERE MATCH(c.chat_name) AGAINST (? IN BOOLEAN MODE) AND ` + visibleCond,
+	types.SearchTypeComment: `SELECT 'comment' AS type, cm.comment_id AS id, c.task_id, c.chat_id,
+		c.chat_name AS title, cm.comment_text AS text,
+		MATCH(cm.comment_text) AGAINST (? IN BOOLEAN MODE) AS score
+	FROM comments cm
+	JOIN chats c ON c.chat_id = cm.chat_id
+	JOIN tasks t ON t.task_id = c.task_id
+	WHERE MATCH(cm.comment_text) AGAINST (? IN BOOLEAN MODE) AND ` + visibleCond,
+}
+
+var searchOrder = []string{types.SearchTypeTask, types.SearchTypeChat, types.SearchTypeComment}
+
+// Store is the MySQL FULLTEXT search engine.
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) Search(userID int, q types.SearchQuery) (*types.SearchResults, error) {
+	words := terms(q.Text)
+	if len(words) == 0 {
+		return nil, fmt.Errorf("search query has no words")
+	}
+	against := booleanQuery(words)
+
+	wanted := make(map[string]bool, len(q.Types))
+	for _, t := range q.Types {
+		wanted[t] = true
+	}
+
+	parts := make([]string, 0, len(searchOrder))
+	args := make([]interface{}, 0, 4*len(searchOrder)+2)
+	for _, t := range searchOrder {
+		if len(wanted) > 0 && !wanted[t] {
+			continue
+		}
+		parts = append(parts, searchParts[t])
+		args = append(args, against, against, userID, userID)
+	}
+
+	query := `SELECT x.type, x.id, x.task_id, x.chat_id, x.title, x.text, x.score, COUNT(*) OVER ()
+	FROM (` + strings.Join(parts, "\nUNION ALL\n") + `) x
+	ORDER BY x.score DESC, x.type, x.id
+	LIMIT ? OFFSET ?`
+	args = append(args, q.Limit, q.Offset)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := &types.SearchResults{Results: make([]types.SearchResult, 0)}
+	for rows.Next() {
+		var r types.SearchResult
+		var text string
+		err := rows.Scan(&r.Type, &r.ID, &r.TaskID, &r.ChatID, &r.Title, &text, &r.Score, &res.Total)
+		if err != nil {
+			return nil, err
+		}
+
+		r.Snippet = snippet(text, words)
+		if r.Type == types.SearchTypeTask && !strings.Contains(r.Snippet, "<mark>") {
+			r.Snippet = snippet(r.Title, words)
+		}
+		res.Results = append(res.Results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// An offset past the end returns no rows and so no window count.
+	if len(res.Results) == 0 && q.Offset > 0 {
+		countQuery := `SELECT COUNT(*) FROM (` + strings.Join(parts, "\nUNION ALL\n") + `) x`
+		err := s.db.QueryRow(countQuery, args[:len(args)-2]...).Scan(&res.Total)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
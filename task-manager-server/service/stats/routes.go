@@ -0,0 +1,141 @@
+package stats
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SibHelly/task-manager-server/service/auth"
+	"github.com/SibHelly/task-manager-server/types"
+	"github.com/SibHelly/task-manager-server/utils"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultWeeks    = 8
+	maxWeeks        = 52
+	maxBurndownDays = 366
+)
+
+type Handler struct {
+	store      types.StatsStore
+	groupStore types.GroupStore
+	userStore  types.UserStore
+}
+
+func NewHandler(store types.StatsStore, groupStore types.GroupStore, userStore types.UserStore) *Handler {
+	return &Handler{store: store, groupStore: groupStore, userStore: userStore}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/stats", auth.WithJWTAuth(h.handleGetUserStats, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/group/{groupID}/stats", auth.WithJWTAuth(h.handleGetGroupStats, h.userStore)).Methods(http.MethodGet)
+}
+
+func (h *Handler) handleGetUserStats(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	q, err := parseStatsQuery(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	st, err := h.store.GetStats(types.StatsScope{UserID: userID}, *q)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Get user stats",
+		"stats":  st,
+	})
+}
+
+func (h *Handler) handleGetGroupStats(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	vars := mux.Vars(r)
+	str, ok := vars["groupID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing group ID"))
+		return
+	}
+
+	groupID, err := strconv.Atoi(str)
+	if err != nil || groupID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid group ID"))
+		return
+	}
+
+	_, err = h.groupStore.GetUserRole(groupID, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you are not a member of this group"))
+		return
+	}
+
+	q, err := parseStatsQuery(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	st, err := h.store.GetStats(types.StatsScope{GroupID: groupID}, *q)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status":   "Get group stats",
+		"group_id": groupID,
+		"stats":    st,
+	})
+}
+
+// parseStatsQuery reads ?weeks= for the completion trend and the inclusive
+// ?from= / ?to= dates (YYYY-MM-DD) for the burndown. The burndown defaults to
+// the last two weeks.
+func parseStatsQuery(r *http.Request) (*types.StatsQuery, error) {
+	params := r.URL.Query()
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	q := &types.StatsQuery{
+		Weeks: defaultWeeks,
+		From:  today.AddDate(0, 0, -13),
+		To:    today,
+	}
+
+	if str := params.Get("weeks"); str != "" {
+		weeks, err := strconv.Atoi(str)
+		if err != nil || weeks < 1 || weeks > maxWeeks {
+			return nil, fmt.Errorf("weeks must be between 1 and %d", maxWeeks)
+		}
+		q.Weeks = weeks
+	}
+
+	if str := params.Get("from"); str != "" {
+		t, err := time.Parse(dateLayout, str)
+		if err != nil {
+			return nil, fmt.Errorf("invalid from date: %s", str)
+		}
+		q.From = t
+	}
+
+	if str := params.Get("to"); str != "" {
+		t, err := time.Parse(dateLayout, str)
+		if err != nil {
+			return nil, fmt.Errorf("invalid to date: %s", str)
+		}
+		q.To = t
+	}
+
+	if q.To.Before(q.From) {
+		return nil, fmt.Errorf("to date is before from date")
+	}
+	if q.To.Sub(q.From) >= maxBurndownDays*24*time.Hour {
+		return nil, fmt.Errorf("date range must not exceed %d days", maxBurndownDays)
+	}
+	q.To = q.To.AddDate(0, 0, 1)
+
+	return q, nil
+}
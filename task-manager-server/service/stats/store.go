@@ -0,0 +1,229 @@
+package stats
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/SibHelly/task-manager-server/types"
+)
+
+const dateLayout = "2006-01-02"
+
+// finalStatuses selects the statuses that mark a task as done.
+const finalStatuses = "(SELECT status_id FROM status_map WHERE is_final)"
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) GetStats(scope types.StatsScope, q types.StatsQuery) (*types.Stats, error) {
+	cond, arg := scopeCond(scope)
+	st := new(types.Stats)
+	var err error
+
+	st.ByStatus, err = s.countBy(`SELECT COALESCE(t.status_id, 0), COALESCE(sm.status, ''), COUNT(*)
+	FROM tasks t LEFT JOIN status_map sm ON sm.status_id = t.status_id
+	WHERE `+cond+`
+	GROUP BY t.status_id, sm.status
+	ORDER BY t.status_id`, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	st.ByPriority, err = s.countBy(`SELECT COALESCE(t.priority_id, 0), COALESCE(pm.priority_name, ''), COUNT(*)
+	FROM tasks t LEFT JOIN priority_map pm ON pm.priority_id = t.priority_id
+	WHERE `+cond+`
+	GROUP BY t.priority_id, pm.priority_name
+	ORDER BY t.priority_id`, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	st.ByCategory, err = s.countBy(`SELECT COALESCE(t.category_id, 0), COALESCE(c.category_name, ''), COUNT(*)
+	FROM tasks t LEFT JOIN categories c ON c.category_id = t.category_id
+	WHERE `+cond+`
+	GROUP BY t.category_id, c.category_name
+	ORDER BY t.category_id`, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT COUNT(*) FROM tasks t
+	WHERE ` + cond + `
+		AND t.end_time < UTC_TIMESTAMP()
+		AND (t.status_id IS NULL OR t.status_id NOT IN ` + finalStatuses + `)`
+	err = s.db.QueryRow(query, arg).Scan(&st.Overdue)
+	if err != nil {
+		return nil, err
+	}
+
+	st.CompletedPerWeek, err = s.completedPerWeek(cond, arg, q.Weeks)
+	if err != nil {
+		return nil, err
+	}
+
+	st.AvgCycleTime, err = s.avgCycleTime(cond, arg, q.Weeks)
+	if err != nil {
+		return nil, err
+	}
+
+	st.Burndown, err = s.burndown(cond, arg, q.From, q.To)
+	if err != nil {
+		return nil, err
+	}
+
+	return st, nil
+}
+
+func (s *Store) countBy(query string, args ...interface{}) ([]types.StatCount, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make([]types.StatCount, 0)
+	for rows.Next() {
+		var c types.StatCount
+		if err := rows.Scan(&c.ID, &c.Name, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+
+	return counts, rows.Err()
+}
+
+// completedPerWeek counts the tasks that entered a final status in each
+// of the last weeks, current week included. Weeks start on Monday.
+func (s *Store) completedPerWeek(cond string, arg interface{}, weeks int) ([]types.WeekCount, error) {
+	start := weekStart(time.Now().UTC()).AddDate(0, 0, -7*(weeks-1))
+
+	query := `SELECT DATE(h.entered_at - INTERVAL WEEKDAY(h.entered_at) DAY), COUNT(DISTINCT h.task_id)
+	FROM task_status_history h
+	JOIN tasks t ON t.task_id = h.task_id
+	WHERE ` + cond + `
+		AND h.status_id IN ` + finalStatuses + `
+		AND h.entered_at >= ?
+	GROUP BY 1`
+	rows, err := s.db.Query(query, arg, start)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var week time.Time
+		var count int
+		if err := rows.Scan(&week, &count); err != nil {
+			return nil, err
+		}
+		counts[week.Format(dateLayout)] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	trend := make([]types.WeekCount, 0, weeks)
+	for i := 0; i < weeks; i++ {
+		day := start.AddDate(0, 0, 7*i).Format(dateLayout)
+		trend = append(trend, types.WeekCount{WeekStart: day, Count: counts[day]})
+	}
+
+	return trend, nil
+}
+
+// avgCycleTime is the average time in hours from the moment a task first
+// entered a working status (or was created, if it never did) until it was
+// finished, over the tasks finished in the last weeks.
+func (s *Store) avgCycleTime(cond string, arg interface{}, weeks int) (float64, error) {
+	start := weekStart(time.Now().UTC()).AddDate(0, 0, -7*(weeks-1))
+
+	query := `SELECT AVG(TIMESTAMPDIFF(SECOND, COALESCE(st.started_at, t.created_at), f.finished_at)) / 3600
+	FROM tasks t
+	JOIN (
+		SELECT task_id, entered_at AS finished_at
+		FROM task_status_history
+		WHERE status_id IN ` + finalStatuses + ` AND left_at IS NULL
+	) f ON f.task_id = t.task_id
+	LEFT JOIN (
+		SELECT task_id, MIN(entered_at) AS started_at
+		FROM task_status_history
+		WHERE status_id IS NOT NULL AND status_id NOT IN ` + finalStatuses + `
+		GROUP BY task_id
+	) st ON st.task_id = t.task_id
+	WHERE ` + cond + `
+		AND f.finished_at >= ?`
+
+	var avg sql.NullFloat64
+	err := s.db.QueryRow(query, arg, start).Scan(&avg)
+	if err != nil {
+		return 0, err
+	}
+
+	return avg.Float64, nil
+}
+
+// burndown returns, for every day in [from, to), how many tasks were still
+// open at the end of the day and how many were finished that day.
+func (s *Store) burndown(cond string, arg interface{}, from, to time.Time) ([]types.BurndownPoint, error) {
+	query := `WITH RECURSIVE days AS (
+		SELECT DATE(?) AS day
+		UNION ALL
+		SELECT day + INTERVAL 1 DAY FROM days WHERE day + INTERVAL 1 DAY < DATE(?)
+	),
+	scope AS (
+		SELECT t.task_id, t.created_at FROM tasks t WHERE ` + cond + `
+	),
+	done AS (
+		SELECT h.task_id, h.entered_at AS done_at
+		FROM task_status_history h
+		JOIN scope ON scope.task_id = h.task_id
+		WHERE h.status_id IN ` + finalStatuses + ` AND h.left_at IS NULL
+	)
+	SELECT d.day,
+		(SELECT COUNT(*) FROM scope
+			LEFT JOIN done ON done.task_id = scope.task_id
+			WHERE scope.created_at < d.day + INTERVAL 1 DAY
+				AND (done.done_at IS NULL OR done.done_at >= d.day + INTERVAL 1 DAY)),
+		(SELECT COUNT(*) FROM done
+			WHERE done.done_at >= d.day AND done.done_at < d.day + INTERVAL 1 DAY)
+	FROM days d
+	ORDER BY d.day`
+	rows, err := s.db.Query(query, from, to, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := make([]types.BurndownPoint, 0)
+	for rows.Next() {
+		var day time.Time
+		var p types.BurndownPoint
+		if err := rows.Scan(&day, &p.Remaining, &p.Completed); err != nil {
+			return nil, err
+		}
+		p.Day = day.Format(dateLayout)
+		points = append(points, p)
+	}
+
+	return points, rows.Err()
+}
+
+func scopeCond(scope types.StatsScope) (string, interface{}) {
+	if scope.GroupID != 0 {
+		return "t.group_id = ?", scope.GroupID
+	}
+	return "t.task_id IN (SELECT du.task_id FROM do_users du WHERE du.user_id = ?)", scope.UserID
+}
+
+func weekStart(t time.Time) time.Time {
+	day := t.Truncate(24 * time.Hour)
+	offset := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -offset)
+}
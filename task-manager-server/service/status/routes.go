@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/SibHelly/task-manager-server/service/auth"
 	"github.com/SibHelly/task-manager-server/types"
@@ -12,22 +13,27 @@ import (
 )
 
 type Handler struct {
-	store     types.StatusStore
-	userStore types.UserStore
+	store      types.StatusStore
+	groupStore types.GroupStore
+	userStore  types.UserStore
 }
 
-func NewHandler(store types.StatusStore, userStore types.UserStore) *Handler {
-	return &Handler{store: store, userStore: userStore}
+func NewHandler(store types.StatusStore, groupStore types.GroupStore, userStore types.UserStore) *Handler {
+	return &Handler{store: store, groupStore: groupStore, userStore: userStore}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc("/statuses", auth.WithJWTAuth(h.handleGetStatuses, h.userStore)).Methods(http.MethodGet)
 	router.HandleFunc("/statuses", auth.WithJWTAuth(h.handleCreateStatus, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/statuses/group/{groupID}", auth.WithJWTAuth(h.handleGetGroupStatuses, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/statuses/group/{groupID}", auth.WithJWTAuth(h.handleCreateGroupStatus, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/statuses/order", auth.WithJWTAuth(h.handleReorderStatuses, h.userStore)).Methods(http.MethodPut)
 	router.HandleFunc("/statuses/{statusID}", auth.WithJWTAuth(h.handleDeleteStatus, h.userStore)).Methods(http.MethodDelete)
 	router.HandleFunc("/statuses/{statusID}", auth.WithJWTAuth(h.handleUpdateStatus, h.userStore)).Methods(http.MethodPut)
 }
 
 func (h *Handler) handleCreateStatus(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
 	var create types.CreateStatus
 	if err := utils.ParseJSON(r, &create); err != nil {
 		utils.WriteError(w, http.StatusBadRequest, err)
@@ -35,15 +41,54 @@ func (h *Handler) handleCreateStatus(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// check this status
-	_, err := h.store.GetStatus(create.Status)
+	_, err := h.store.GetStatus(userID, create.Status, true)
 	if err == nil {
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("status: %s already exists", create.Status))
 		return
 	}
 
-	err = h.store.CreateStatus(types.CreateStatus{
-		Status: create.Status,
-	})
+	err = h.store.CreateStatus(userID, create, true)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusCreated, "Created")
+}
+
+func (h *Handler) handleCreateGroupStatus(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	vars := mux.Vars(r)
+	str, ok := vars["groupID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing group ID"))
+		return
+	}
+
+	groupID, err := strconv.Atoi(str)
+	if err != nil || groupID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid group ID"))
+		return
+	}
+
+	if !h.canManageGroup(groupID, userID) {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("only group owners and editors can add statuses"))
+		return
+	}
+
+	var create types.CreateStatus
+	if err := utils.ParseJSON(r, &create); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	_, err = h.store.GetStatus(groupID, create.Status, false)
+	if err == nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("status: %s already exists", create.Status))
+		return
+	}
+
+	err = h.store.CreateStatus(groupID, create, false)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -53,15 +98,48 @@ func (h *Handler) handleCreateStatus(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) handleGetStatuses(w http.ResponseWriter, r *http.Request) {
-	st, err := h.store.GetStatuses()
+	userID := auth.GetUserIDFromContext(r.Context())
+	st, err := h.store.GetStatuses(userID, true)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, st)
+}
+
+func (h *Handler) handleGetGroupStatuses(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	vars := mux.Vars(r)
+	str, ok := vars["groupID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing group ID"))
+		return
+	}
+
+	groupID, err := strconv.Atoi(str)
+	if err != nil || groupID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid group ID"))
+		return
+	}
+
+	_, err = h.groupStore.GetUserRole(groupID, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you are not a member of this group"))
+		return
+	}
+
+	st, err := h.store.GetStatuses(groupID, false)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
 	}
 
 	utils.WriteJson(w, http.StatusOK, st)
 }
 
 func (h *Handler) handleUpdateStatus(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	str, ok := vars["statusID"]
 	if !ok {
@@ -75,14 +153,37 @@ func (h *Handler) handleUpdateStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var create types.CreateStatus
+	current, err := h.store.GetStatusByID(statusID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if !h.canManage(current, userID) {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you can not change this status"))
+		return
+	}
+
+	// Fields left out of the request keep their stored values.
+	create := types.CreateStatus{
+		Status:    current.Status,
+		IsFinal:   current.IsFinal,
+		IsBlocked: current.IsBlocked,
+		Color:     current.Color,
+		Position:  current.Position,
+	}
 	if err := utils.ParseJSON(r, &create); err != nil {
 		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
+	if strings.TrimSpace(create.Status) == "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("status name must not be empty"))
+		return
+	}
 
-	_, err = h.store.GetStatus(create.Status)
-	if err == nil {
+	scopeID, flag := scopeOf(current)
+	st, err := h.store.GetStatus(scopeID, create.Status, flag)
+	if err == nil && st.ID != statusID {
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("status: %s already exists", create.Status))
 		return
 	}
@@ -96,7 +197,40 @@ func (h *Handler) handleUpdateStatus(w http.ResponseWriter, r *http.Request) {
 	utils.WriteJson(w, http.StatusOK, "UPDATED")
 }
 
+func (h *Handler) handleReorderStatuses(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	var order types.ReorderStatuses
+	if err := utils.ParseJSON(r, &order); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	for _, id := range order.StatusIDs {
+		st, err := h.store.GetStatusByID(id)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("status %d not found", id))
+			return
+		}
+		if !h.canManage(st, userID) {
+			utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you can not change status %d", id))
+			return
+		}
+	}
+
+	err := h.store.ReorderStatuses(order.StatusIDs)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, "UPDATED")
+}
+
+// handleDeleteStatus removes a custom status. Tasks that use it are moved to
+// the status given in ?replace_with=, which must be a system default or belong
+// to the same user or group.
 func (h *Handler) handleDeleteStatus(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	str, ok := vars["statusID"]
 	if !ok {
@@ -110,11 +244,90 @@ func (h *Handler) handleDeleteStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.store.DeleteStatus(statusID)
+	current, err := h.store.GetStatusByID(statusID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if !h.canManage(current, userID) {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you can not delete this status"))
+		return
+	}
+
+	replaceWith := 0
+	if str := r.URL.Query().Get("replace_with"); str != "" {
+		replaceWith, err = strconv.Atoi(str)
+		if err != nil || replaceWith == statusID {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid replacement status ID"))
+			return
+		}
+
+		rep, err := h.store.GetStatusByID(replaceWith)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		if !sameScope(current, rep) {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("status: %s is not available here", rep.Status))
+			return
+		}
+	}
+
+	affected, err := h.store.DeleteStatus(statusID, replaceWith)
+	if err == ErrStatusInUse {
+		usage, err := h.store.GetStatusUsage(statusID)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		utils.WriteJson(w, http.StatusConflict, map[string]interface{}{
+			"error": fmt.Sprintf("status is used by %d tasks, pass replace_with to move them", usage.Tasks),
+			"usage": usage,
+		})
+		return
+	}
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	utils.WriteJson(w, http.StatusOK, "DELETED")
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status":         "DELETED",
+		"affected_tasks": affected,
+	})
+}
+
+// canManage reports whether the user may change the status: their own
+// statuses, or those of a group where they are owner or editor. System
+// defaults are read-only.
+func (h *Handler) canManage(st *types.Status, userID int) bool {
+	if st.UserID != 0 {
+		return st.UserID == userID
+	}
+	if st.GroupID != 0 {
+		return h.canManageGroup(st.GroupID, userID)
+	}
+	return false
+}
+
+func (h *Handler) canManageGroup(groupID, userID int) bool {
+	role, err := h.groupStore.GetUserRole(groupID, userID)
+	return err == nil && (role == "owner" || role == "editor")
+}
+
+// scopeOf returns the ID and flag of the scope the status lives in.
+func scopeOf(st *types.Status) (int, bool) {
+	if st.GroupID != 0 {
+		return st.GroupID, false
+	}
+	return st.UserID, true
+}
+
+// sameScope reports whether rep is visible wherever st is.
+func sameScope(st, rep *types.Status) bool {
+	if rep.UserID == 0 && rep.GroupID == 0 {
+		return true
+	}
+	return rep.UserID == st.UserID && rep.GroupID == st.GroupID
 }
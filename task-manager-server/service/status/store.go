@@ -3,10 +3,24 @@ package status
 import (
 	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/SibHelly/task-manager-server/types"
 )
 
+const statusSelect = `SELECT sm.status_id, sm.status, sm.is_final, sm.is_blocked, sm.color, sm.position,
+	COALESCE(us.user_id, 0), COALESCE(gs.group_id, 0)
+	FROM status_map sm
+	LEFT JOIN users_statuses us ON us.status_id = sm.status_id
+	LEFT JOIN groups_statuses gs ON gs.status_id = sm.status_id`
+
+// systemCond matches the statuses that belong to nobody: the system defaults.
+const systemCond = "(us.status_id IS NULL AND gs.status_id IS NULL)"
+
+// ErrStatusInUse is returned when a status still used by tasks is deleted
+// without a replacement.
+var ErrStatusInUse = fmt.Errorf("status is used by tasks")
+
 type Store struct {
 	db *sql.DB
 }
@@ -15,8 +29,10 @@ func NewStore(db *sql.DB) *Store {
 	return &Store{db: db}
 }
 
-func (s *Store) GetStatuses() ([]types.Status, error) {
-	rows, err := s.db.Query("SELECT * FROM status_map")
+// GetStatuses returns the system defaults together with the statuses of the
+// user (flag set) or of the group.
+func (s *Store) GetStatuses(ID int, flag bool) ([]types.Status, error) {
+	rows, err := s.db.Query(statusSelect+" WHERE "+scopeCond(flag)+" ORDER BY sm.position, sm.status_id", ID)
 	if err != nil {
 		return nil, err
 	}
@@ -35,8 +51,8 @@ func (s *Store) GetStatuses() ([]types.Status, error) {
 
 }
 
-func (s *Store) GetStatus(status string) (*types.Status, error) {
-	rows, err := s.db.Query("SELECT * FROM status_map WHERE status = ?", status)
+func (s *Store) GetStatus(ID int, status string, flag bool) (*types.Status, error) {
+	rows, err := s.db.Query(statusSelect+" WHERE "+scopeCond(flag)+" AND sm.status = ?", ID, status)
 	if err != nil {
 		return nil, err
 	}
@@ -54,7 +70,7 @@ func (s *Store) GetStatus(status string) (*types.Status, error) {
 	return st, nil
 }
 func (s *Store) GetStatusByID(statusID int) (*types.Status, error) {
-	rows, err := s.db.Query("SELECT * FROM status_map WHERE status_id = ?", statusID)
+	rows, err := s.db.Query(statusSelect+" WHERE sm.status_id = ?", statusID)
 	if err != nil {
 		return nil, err
 	}
@@ -73,7 +89,7 @@ func (s *Store) GetStatusByID(statusID int) (*types.Status, error) {
 }
 
 func (s *Store) GetStatusIDbyName(name string) (*int, error) {
-	rows, err := s.db.Query("SELECT * FROM status_map WHERE status = ?", name)
+	rows, err := s.db.Query(statusSelect+" WHERE sm.status = ?", name)
 	if err != nil {
 		return nil, err
 	}
@@ -91,38 +107,163 @@ func (s *Store) GetStatusIDbyName(name string) (*int, error) {
 	return &st.ID, nil
 }
 
-func (s *Store) CreateStatus(st types.CreateStatus) error {
-	_, err := s.db.Exec("INSERT INTO status_map (status) VALUES (?)", st.Status)
+func (s *Store) CreateStatus(ID int, st types.CreateStatus, flag bool) error {
+	res, err := s.db.Exec(
+		"INSERT INTO status_map (status, is_final, is_blocked, color, position) VALUES (?, ?, ?, ?, ?)",
+		st.Status, st.IsFinal, st.IsBlocked, st.Color, st.Position,
+	)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if flag {
+		_, err = s.db.Exec("INSERT INTO users_statuses (user_id, status_id) VALUES (?, ?)", ID, id)
+		if err != nil {
+			return err
+		}
+		return nil
+	}
+	_, err = s.db.Exec("INSERT INTO groups_statuses (group_id, status_id) VALUES (?, ?)", ID, id)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s *Store) DeleteStatus(statusID int) error {
-	_, err := s.db.Exec("DELETE FROM status_map WHERE status_id = ?", statusID)
+// DeleteStatus moves the tasks using the status to replaceWith and removes
+// the status in one transaction. It returns the number of tasks moved.
+// Without a replacement it fails with ErrStatusInUse while tasks use the
+// status.
+func (s *Store) DeleteStatus(statusID, replaceWith int) (int64, error) {
+	tx, err := s.db.Begin()
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+	defer tx.Rollback()
+
+	// Locking the status keeps tasks from taking it up until we are done.
+	var id int
+	err = tx.QueryRow("SELECT status_id FROM status_map WHERE status_id = ? FOR UPDATE", statusID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("status not found")
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var affected int64
+	if replaceWith == 0 {
+		var used bool
+		err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM tasks WHERE status_id = ?)", statusID).Scan(&used)
+		if err != nil {
+			return 0, err
+		}
+		if used {
+			return 0, ErrStatusInUse
+		}
+	} else {
+		now := time.Now().UTC()
+		_, err = tx.Exec(`INSERT INTO task_status_history (task_id, status_id, entered_at)
+			SELECT task_id, ?, ? FROM tasks WHERE status_id = ?`, replaceWith, now, statusID)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.Exec(`UPDATE task_status_history SET left_at = ?
+			WHERE status_id = ? AND left_at IS NULL`, now, statusID)
+		if err != nil {
+			return 0, err
+		}
+
+		res, err := tx.Exec("UPDATE tasks SET status_id = ? WHERE status_id = ?", replaceWith, statusID)
+		if err != nil {
+			return 0, err
+		}
+		affected, err = res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.Exec("DELETE FROM status_map WHERE status_id = ?", statusID)
+	if err != nil {
+		return 0, err
+	}
+
+	return affected, tx.Commit()
+}
+
+func (s *Store) GetStatusUsage(statusID int) (*types.TaskUsage, error) {
+	query := `SELECT COUNT(*),
+		COALESCE(SUM(NOT EXISTS (SELECT 1 FROM status_map fs WHERE fs.status_id = t.status_id AND fs.is_final)), 0),
+		COALESCE(SUM(t.parent_task_id IS NOT NULL), 0)
+	FROM tasks t WHERE t.status_id = ?`
+
+	u := new(types.TaskUsage)
+	err := s.db.QueryRow(query, statusID).Scan(&u.Tasks, &u.OpenTasks, &u.Subtasks)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
 }
 
 func (s *Store) UpdateStatus(statusID int, st types.CreateStatus) error {
-	_, err := s.db.Exec("UPDATE status_map SET status = ? WHERE status_id = ?", st.Status, statusID)
+	_, err := s.db.Exec(
+		"UPDATE status_map SET status = ?, is_final = ?, is_blocked = ?, color = ?, position = ? WHERE status_id = ?",
+		st.Status, st.IsFinal, st.IsBlocked, st.Color, st.Position, statusID,
+	)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// ReorderStatuses sets the position of each status to its index in the list.
+func (s *Store) ReorderStatuses(statusIDs []int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i, id := range statusIDs {
+		_, err = tx.Exec("UPDATE status_map SET position = ? WHERE status_id = ?", i, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func scopeCond(flag bool) string {
+	if flag {
+		return "(us.user_id = ? OR " + systemCond + ")"
+	}
+	return "(gs.group_id = ? OR " + systemCond + ")"
+}
+
 func scanRowsIntoStatus(rows *sql.Rows) (*types.Status, error) {
 	status := new(types.Status)
 
-	err := rows.Scan(&status.ID, &status.Status)
+	var color sql.NullString
+	err := rows.Scan(
+		&status.ID,
+		&status.Status,
+		&status.IsFinal,
+		&status.IsBlocked,
+		&color,
+		&status.Position,
+		&status.UserID,
+		&status.GroupID,
+	)
 
 	if err != nil {
 		return nil, err
 	}
+	status.Color = color.String
 
 	return status, nil
 }
@@ -0,0 +1,201 @@
+package tasks
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/SibHelly/task-manager-server/types"
+)
+
+// maxTaskName is the length of tasks.task_name.
+const maxTaskName = 100
+
+// copyName returns the name of the n-th copy of a task: "name (copy)" for
+// the first, "name (copy 2)" for the second and so on. The original name is
+// cut so the result still fits a task name.
+func copyName(name string, n int) string {
+	suffix := " (copy)"
+	if n > 1 {
+		suffix = " (copy " + strconv.Itoa(n) + ")"
+	}
+
+	base := []rune(name)
+	if room := maxTaskName - len([]rune(suffix)); len(base) > room {
+		base = base[:room]
+	}
+	return string(base) + suffix
+}
+
+// DuplicateTask copies the task with its whole subtask tree, responsible
+// users, checklists and, if asked, its chats and comments. It returns the ID
+// of the new root task.
+func (s *Store) DuplicateTask(taskID int, c types.TaskCopy) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := copyTaskTree(tx, taskID, c.ParentID, c.Name, c)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// copyTaskTree copies one task under parentID, then its subtasks under the
+// copy. An empty name keeps the original one.
+func copyTaskTree(tx *sql.Tx, taskID, parentID int, name string, c types.TaskCopy) (int, error) {
+	res, err := tx.Exec(`INSERT INTO tasks (
+	task_name,
+	task_description,
+	priority_id,
+	status_id,
+	start_time,
+	end_time,
+	attachments,
+	category_id,
+	parent_task_id,
+	group_id,
+	estimate)
+	SELECT IF(? = '', task_name, ?), task_description,
+		IF(?, priority_id, NULL), IF(?, status_id, NULL),
+		start_time + INTERVAL ? DAY, end_time + INTERVAL ? DAY,
+		attachments, IF(?, category_id, NULL), ?, ?, estimate
+	FROM tasks WHERE task_id = ?`,
+		name, name, c.SameScope, c.SameScope, c.OffsetDays, c.OffsetDays, c.SameScope,
+		nullIfZero(parentID), nullIfZero(c.GroupID), taskID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("Task not found")
+	}
+
+	id64, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	id := int(id64)
+
+	var statusID sql.NullInt64
+	if err := tx.QueryRow("SELECT status_id FROM tasks WHERE task_id = ?", id).Scan(&statusID); err != nil {
+		return 0, err
+	}
+	if err := recordStatus(tx, id, int(statusID.Int64)); err != nil {
+		return 0, err
+	}
+
+	if c.Responsible == nil {
+		_, err = tx.Exec("INSERT INTO do_users (user_id, task_id) SELECT user_id, ? FROM do_users WHERE task_id = ?", id, taskID)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		for _, m := range c.Responsible {
+			_, err = tx.Exec("INSERT INTO do_users (user_id, task_id) VALUES (?, ?)", m.ID, id)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO checklist_items (task_id, item_text, position)
+	SELECT ?, item_text, position FROM checklist_items WHERE task_id = ?`, id, taskID)
+	if err != nil {
+		return 0, err
+	}
+
+	if c.SameScope {
+		_, err = tx.Exec("INSERT INTO task_labels (task_id, label_id) SELECT ?, label_id FROM task_labels WHERE task_id = ?", id, taskID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if c.WithChats {
+		if err := copyChats(tx, taskID, id); err != nil {
+			return 0, err
+		}
+	}
+
+	children, err := subtaskIDs(tx, taskID)
+	if err != nil {
+		return 0, err
+	}
+	for _, child := range children {
+		if _, err := copyTaskTree(tx, child, id, "", c); err != nil {
+			return 0, err
+		}
+	}
+
+	return id, nil
+}
+
+func copyChats(tx *sql.Tx, fromTaskID, toTaskID int) error {
+	rows, err := tx.Query("SELECT chat_id, chat_name FROM chats WHERE task_id = ? ORDER BY chat_id", fromTaskID)
+	if err != nil {
+		return err
+	}
+	type chat struct {
+		id   int
+		name string
+	}
+	chats := make([]chat, 0)
+	for rows.Next() {
+		var ch chat
+		if err := rows.Scan(&ch.id, &ch.name); err != nil {
+			rows.Close()
+			return err
+		}
+		chats = append(chats, ch)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, ch := range chats {
+		res, err := tx.Exec("INSERT INTO chats (task_id, chat_name) VALUES (?, ?)", toTaskID, ch.name)
+		if err != nil {
+			return err
+		}
+		chatID, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT INTO comments (chat_id, sender_id, comment_text)
+		SELECT ?, sender_id, comment_text FROM comments WHERE chat_id = ? ORDER BY comment_id`, chatID, ch.id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func subtaskIDs(tx *sql.Tx, taskID int) ([]int, error) {
+	rows, err := tx.Query("SELECT task_id FROM tasks WHERE parent_task_id = ? ORDER BY task_id", taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int, 0)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
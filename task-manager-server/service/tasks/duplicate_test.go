@@ -0,0 +1,35 @@
+package tasks
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCopyName(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		want string
+	}{
+		{"Report", 1, "Report (copy)"},
+		{"Report", 2, "Report (copy 2)"},
+		{"Report (copy)", 1, "Report (copy) (copy)"},
+	}
+	for _, tt := range tests {
+		if got := copyName(tt.name, tt.n); got != tt.want {
+			t.Errorf("copyName(%q, %d) = %q, want %q", tt.name, tt.n, got, tt.want)
+		}
+	}
+
+	long := strings.Repeat("ж", maxTaskName)
+	for _, n := range []int{1, 12, 100} {
+		got := copyName(long, n)
+		if utf8.RuneCountInString(got) != maxTaskName {
+			t.Errorf("copyName of a full name, copy %d, has %d characters", n, utf8.RuneCountInString(got))
+		}
+		if !strings.HasSuffix(got, ")") {
+			t.Errorf("copyName of a full name, copy %d, lost its suffix: %q", n, got)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package tasks
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Board positions are lexicographic ranks: strings of base 36 digits that
+// sort in card order under a binary collation. A new rank can always be
+// found between two others, so moving a card rewrites only that card.
+// Ranks never end in '0', which keeps room below every rank.
+const rankDigits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+const rankBase = len(rankDigits)
+
+// rankWidth is the length evenly spread ranks start from; rebalanceRankLen
+// is the length past which a column is worth rebalancing, and maxRankLen the
+// length the column can store.
+const (
+	rankWidth        = 4
+	rebalanceRankLen = 12
+	maxRankLen       = 64
+)
+
+func rankDigit(c byte) (int, error) {
+	i := strings.IndexByte(rankDigits, c)
+	if i < 0 {
+		return 0, fmt.Errorf("invalid rank digit %q", c)
+	}
+	return i, nil
+}
+
+func validRank(r string) error {
+	if r == "" || r[len(r)-1] == '0' {
+		return fmt.Errorf("invalid rank %q", r)
+	}
+	for i := 0; i < len(r); i++ {
+		if _, err := rankDigit(r[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rankBetween returns a rank sorting after a and before b. An empty a means
+// the start of the column, an empty b its end.
+func rankBetween(a, b string) (string, error) {
+	if a != "" {
+		if err := validRank(a); err != nil {
+			return "", err
+		}
+	}
+	if b != "" {
+		if err := validRank(b); err != nil {
+			return "", err
+		}
+	}
+	if a != "" && b != "" && a >= b {
+		return "", fmt.Errorf("rank %q is not before %q", a, b)
+	}
+
+	var out []byte
+	bounded := b != ""
+	for i := 0; ; i++ {
+		lo := 0
+		if i < len(a) {
+			lo, _ = rankDigit(a[i])
+		}
+		hi := rankBase
+		if bounded && i < len(b) {
+			hi, _ = rankDigit(b[i])
+		}
+
+		if hi-lo > 1 {
+			return string(append(out, rankDigits[(lo+hi)/2])), nil
+		}
+
+		out = append(out, rankDigits[lo])
+		if hi-lo == 1 {
+			// The prefix is now below b whatever follows.
+			bounded = false
+		}
+	}
+}
+
+// spreadRanks returns n ranks spaced evenly over the whole range, for
+// rebalancing a column.
+func spreadRanks(n int) []string {
+	width, space := rankWidth, 1
+	for i := 0; i < width; i++ {
+		space *= rankBase
+	}
+	for space <= 2*(n+1) {
+		width++
+		space *= rankBase
+	}
+	step := space / (n + 1)
+
+	ranks := make([]string, n)
+	for i := range ranks {
+		v := (i + 1) * step
+		digits := make([]byte, width)
+		for j := width - 1; j >= 0; j-- {
+			digits[j] = rankDigits[v%rankBase]
+			v /= rankBase
+		}
+		ranks[i] = strings.TrimRight(string(digits), "0")
+	}
+	return ranks
+}
@@ -0,0 +1,90 @@
+package tasks
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestRankBetween(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"", ""},
+		{"", "1"},
+		{"", "01"},
+		{"1", ""},
+		{"z", ""},
+		{"zz", ""},
+		{"1", "2"},
+		{"1", "11"},
+		{"a", "b"},
+		{"az", "b"},
+		{"0001", "0002"},
+		{"h", "hi"},
+	}
+
+	for _, tt := range tests {
+		got, err := rankBetween(tt.a, tt.b)
+		if err != nil {
+			t.Errorf("rankBetween(%q, %q): %v", tt.a, tt.b, err)
+			continue
+		}
+		if err := validRank(got); err != nil {
+			t.Errorf("rankBetween(%q, %q) = %q: %v", tt.a, tt.b, got, err)
+		}
+		if tt.a != "" && got <= tt.a {
+			t.Errorf("rankBetween(%q, %q) = %q, not after %q", tt.a, tt.b, got, tt.a)
+		}
+		if tt.b != "" && got >= tt.b {
+			t.Errorf("rankBetween(%q, %q) = %q, not before %q", tt.a, tt.b, got, tt.b)
+		}
+	}
+}
+
+func TestRankBetweenErrors(t *testing.T) {
+	for _, tt := range [][2]string{{"b", "a"}, {"a", "a"}, {"a0", ""}, {"A", ""}} {
+		if _, err := rankBetween(tt[0], tt[1]); err == nil {
+			t.Errorf("rankBetween(%q, %q) should fail", tt[0], tt[1])
+		}
+	}
+}
+
+// Inserting repeatedly at the same spot must keep the order and grow the
+// rank slowly.
+func TestRankBetweenRepeated(t *testing.T) {
+	lo, hi := "", ""
+	for i := 0; i < 200; i++ {
+		r, err := rankBetween(lo, hi)
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if i%2 == 0 {
+			lo = r
+		} else {
+			hi = r
+		}
+	}
+	if len(lo) > maxRankLen || len(hi) > maxRankLen {
+		t.Errorf("ranks grew past %d: %q %q", maxRankLen, lo, hi)
+	}
+}
+
+func TestSpreadRanks(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 10, 1000, 100000} {
+		ranks := spreadRanks(n)
+		if len(ranks) != n {
+			t.Fatalf("spreadRanks(%d) returned %d ranks", n, len(ranks))
+		}
+		if !sort.StringsAreSorted(ranks) {
+			t.Errorf("spreadRanks(%d) is not sorted", n)
+		}
+		for i, r := range ranks {
+			if err := validRank(r); err != nil {
+				t.Fatalf("spreadRanks(%d)[%d]: %v", n, i, err)
+			}
+			if i > 0 && ranks[i-1] == r {
+				t.Fatalf("spreadRanks(%d) repeats %q", n, r)
+			}
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/SibHelly/task-manager-server/service/auth"
 	"github.com/SibHelly/task-manager-server/types"
@@ -11,6 +13,12 @@ import (
 	"github.com/gorilla/mux"
 )
 
+const (
+	defaultFocusLimit = 3
+	maxFocusLimit     = 50
+	maxCopyNumber     = 100
+)
+
 type Handler struct {
 	store         types.TasksStore
 	userStore     types.UserStore
@@ -18,6 +26,7 @@ type Handler struct {
 	statusStore   types.StatusStore
 	groupStore    types.GroupStore
 	categoryStore types.CategoryStore
+	events        types.EventPublisher
 }
 
 func NewHandler(
@@ -27,6 +36,7 @@ func NewHandler(
 	statusStore types.StatusStore,
 	groupStore types.GroupStore,
 	categoryStore types.CategoryStore,
+	events types.EventPublisher,
 ) *Handler {
 	return &Handler{
 		store:         store,
@@ -35,6 +45,7 @@ func NewHandler(
 		statusStore:   statusStore,
 		groupStore:    groupStore,
 		categoryStore: categoryStore,
+		events:        events,
 	}
 }
 
@@ -45,6 +56,7 @@ func (h *Handler) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc("/tasks/not-group", auth.WithJWTAuth(h.handleGetTasksUser, h.userStore)).Methods(http.MethodGet)
 	router.HandleFunc("/tasks/most-priority", auth.WithJWTAuth(h.handleGetMostPriorityTasksUser, h.userStore)).Methods(http.MethodGet)
 	router.HandleFunc("/tasks/group/{groupID}", auth.WithJWTAuth(h.handleGetTasksGroup, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/group/{groupID}/workload", auth.WithJWTAuth(h.handleGetGroupWorkload, h.userStore)).Methods(http.MethodGet)
 
 	// create task
 	router.HandleFunc("/tasks/create", auth.WithJWTAuth(h.handleCreateTask, h.userStore)).Methods(http.MethodPost)
@@ -55,12 +67,34 @@ func (h *Handler) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc("/tasks/get/subtasks/{taskID}", auth.WithJWTAuth(h.handleGetSubtasks, h.userStore)).Methods(http.MethodGet)
 	router.HandleFunc("/tasks/update/{taskID}", auth.WithJWTAuth(h.handleUpdateTask, h.userStore)).Methods(http.MethodPut)
 	router.HandleFunc("/tasks/update/status/{taskID}", auth.WithJWTAuth(h.handleUpdateTaskStatus, h.userStore)).Methods(http.MethodPut)
+	router.HandleFunc("/tasks/{taskID}/move", auth.WithJWTAuth(h.handleMoveTask, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/tasks/board", auth.WithJWTAuth(h.handleGetBoard, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/tasks/board/group/{groupID}", auth.WithJWTAuth(h.handleGetGroupBoard, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/tasks/{taskID}/duplicate", auth.WithJWTAuth(h.handleDuplicateTask, h.userStore)).Methods(http.MethodPost)
 	router.HandleFunc("/tasks/delete/{taskID}", auth.WithJWTAuth(h.handleDeleteTask, h.userStore)).Methods(http.MethodDelete)
+
+	// responsible users
+	router.HandleFunc("/tasks/responsible/{taskID}", auth.WithJWTAuth(h.handleGetResponsible, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/tasks/responsible/{taskID}", auth.WithJWTAuth(h.handleAddResponsible, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/tasks/responsible/{taskID}", auth.WithJWTAuth(h.handleReplaceResponsible, h.userStore)).Methods(http.MethodPut)
+	router.HandleFunc("/tasks/responsible/{taskID}", auth.WithJWTAuth(h.handleRemoveResponsible, h.userStore)).Methods(http.MethodDelete)
+
+	// watchers
+	router.HandleFunc("/tasks/watching", auth.WithJWTAuth(h.handleGetWatchedTasks, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/tasks/{taskID}/watchers", auth.WithJWTAuth(h.handleGetWatchers, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/tasks/{taskID}/watchers", auth.WithJWTAuth(h.handleWatchTask, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/tasks/{taskID}/watchers", auth.WithJWTAuth(h.handleUnwatchTask, h.userStore)).Methods(http.MethodDelete)
 }
 
 func (h *Handler) handleGetTasks(w http.ResponseWriter, r *http.Request) {
 	userID := auth.GetUserIDFromContext(r.Context())
-	ts, err := h.store.GetAllTasksUser(userID)
+	filter, err := parseTaskFilter(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ts, err := h.store.GetAllTasksUser(userID, filter)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -74,7 +108,13 @@ func (h *Handler) handleGetTasks(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) handleGetTasksUser(w http.ResponseWriter, r *http.Request) {
 	userID := auth.GetUserIDFromContext(r.Context())
-	ts, err := h.store.GetTasks(userID, true)
+	filter, err := parseTaskFilter(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ts, err := h.store.GetTasks(userID, true, filter)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -88,7 +128,23 @@ func (h *Handler) handleGetTasksUser(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) handleGetMostPriorityTasksUser(w http.ResponseWriter, r *http.Request) {
 	userID := auth.GetUserIDFromContext(r.Context())
-	ts, err := h.store.GetMostPriorityTasks(userID)
+	limit := defaultFocusLimit
+	if str := r.URL.Query().Get("limit"); str != "" {
+		l, err := strconv.Atoi(str)
+		if err != nil || l < 1 || l > maxFocusLimit {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxFocusLimit))
+			return
+		}
+		limit = l
+	}
+
+	filter, err := parseTaskFilter(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ts, err := h.store.GetMostPriorityTasks(userID, limit, filter)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -101,6 +157,7 @@ func (h *Handler) handleGetMostPriorityTasksUser(w http.ResponseWriter, r *http.
 }
 
 func (h *Handler) handleGetTasksGroup(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	str, ok := vars["groupID"]
 	if !ok {
@@ -113,7 +170,19 @@ func (h *Handler) handleGetTasksGroup(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid group ID"))
 		return
 	}
-	ts, err := h.store.GetTasks(groupID, false)
+
+	_, err = h.groupStore.GetUserRole(groupID, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you are not a member of this group"))
+		return
+	}
+
+	filter, err := parseTaskFilter(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	ts, err := h.store.GetTasks(groupID, false, filter)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 	}
@@ -125,31 +194,27 @@ func (h *Handler) handleGetTasksGroup(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) handleFinishTask(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	str, ok := vars["taskID"]
+	userID := auth.GetUserIDFromContext(r.Context())
+	taskID, ok := h.taskFromRequest(w, r, userID)
 	if !ok {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing task ID"))
 		return
 	}
 
-	taskID, err := strconv.Atoi(str)
-	if err != nil || taskID == 0 {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid task ID"))
-		return
-	}
-
-	err = h.store.FinishTask(taskID)
+	err := h.store.FinishTask(taskID)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
+	h.publish(types.Event{Type: types.EventTaskFinished, TaskID: taskID, ActorID: userID})
+
 	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
 		"Status": "Task finished",
 	})
 }
 
 func (h *Handler) handleGetTask(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	str, ok := vars["taskID"]
 	if !ok {
@@ -163,6 +228,16 @@ func (h *Handler) handleGetTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	allowed, err := h.store.CanAccessTask(taskID, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !allowed {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you have no access to this task"))
+		return
+	}
+
 	ts, err := h.store.GetTaskByID(taskID)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
@@ -189,7 +264,13 @@ func (h *Handler) handleGetSubtasks(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ts, err := h.store.GetSubTasks(taskID)
+	filter, err := parseTaskFilter(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ts, err := h.store.GetSubTasks(taskID, filter)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -220,6 +301,10 @@ func (h *Handler) handleCreateTask(w http.ResponseWriter, r *http.Request) {
 		Responsible = append(Responsible, types.ResponsibleUserID{ID: int64(userID)})
 	} else {
 		// fmt.Println("group task")
+		if _, err := h.groupStore.GetUserRole(create.Group_id, userID); err != nil {
+			utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you are not a member of this group"))
+			return
+		}
 		_, err := h.store.GetTaskByName(create.Name, create.Group_id, false)
 		if err == nil {
 			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("Task: %s already exists in this group", create.Name))
@@ -235,7 +320,15 @@ func (h *Handler) handleCreateTask(w http.ResponseWriter, r *http.Request) {
 		}
 
 	}
-	err := h.store.CreateTask(types.CreateTask{
+	if !h.inTaskScope(w, create.Group_id, userID, create.Status_id, create.Priority_id) {
+		return
+	}
+	for _, sub := range create.Subtasks {
+		if !h.inTaskScope(w, create.Group_id, userID, sub.Status_id, sub.Priority_id) {
+			return
+		}
+	}
+	taskID, err := h.store.CreateTask(types.CreateTask{
 		Name:           create.Name,
 		Description:    create.Description,
 		Priority_id:    create.Priority_id,
@@ -248,24 +341,39 @@ func (h *Handler) handleCreateTask(w http.ResponseWriter, r *http.Request) {
 		Responsible:    Responsible,
 		Subtasks:       create.Subtasks,
 		Group_id:       create.Group_id,
+		Estimate:       create.Estimate,
 	})
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
+	h.publish(types.Event{Type: types.EventTaskCreated, TaskID: taskID, GroupID: create.Group_id, ActorID: userID})
+
 	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
-		"Status": "Task created",
+		"Status":  "Task created",
+		"task_id": taskID,
 	})
 }
 
 func (h *Handler) handleCreateSubtask(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
 	var createSubtask types.CreateSubtask
 	if err := utils.ParseJSON(r, &createSubtask); err != nil {
 		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
 
+	allowed, err := h.store.CanAccessTask(createSubtask.Parent_task_id, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !allowed {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you have no access to this task"))
+		return
+	}
+
 	ts, err := h.store.GetTaskByID(createSubtask.Parent_task_id)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
@@ -276,6 +384,9 @@ func (h *Handler) handleCreateSubtask(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("Subtask: %s already exists in this subtasks list", createSubtask.Name))
 		return
 	}
+	if !h.inTaskScope(w, ts.Group_id, userID, createSubtask.Status_id, createSubtask.Priority_id) {
+		return
+	}
 
 	Responsible, err := h.store.GetResponsible(ts.ID)
 	if err != nil {
@@ -283,7 +394,7 @@ func (h *Handler) handleCreateSubtask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.store.AddSubtask(types.CreateTask{
+	subtaskID, err := h.store.AddSubtask(types.CreateTask{
 		Name:           createSubtask.Name,
 		Description:    createSubtask.Description,
 		Priority_id:    createSubtask.Priority_id,
@@ -295,6 +406,7 @@ func (h *Handler) handleCreateSubtask(w http.ResponseWriter, r *http.Request) {
 		Parent_task_id: createSubtask.Parent_task_id,
 		Responsible:    Responsible,
 		Group_id:       ts.Group_id,
+		Estimate:       createSubtask.Estimate,
 	})
 
 	if err != nil {
@@ -303,21 +415,15 @@ func (h *Handler) handleCreateSubtask(w http.ResponseWriter, r *http.Request) {
 	}
 
 	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
-		"Status": "Subtask added",
+		"Status":  "Subtask added",
+		"task_id": subtaskID,
 	})
 }
 
 func (h *Handler) handleUpdateTask(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	str, ok := vars["taskID"]
+	userID := auth.GetUserIDFromContext(r.Context())
+	taskID, ok := h.taskFromRequest(w, r, userID)
 	if !ok {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing task ID"))
-		return
-	}
-
-	taskID, err := strconv.Atoi(str)
-	if err != nil || taskID == 0 {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid task ID"))
 		return
 	}
 
@@ -326,8 +432,17 @@ func (h *Handler) handleUpdateTask(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
+	if update.Group_id != 0 {
+		if _, err := h.groupStore.GetUserRole(update.Group_id, userID); err != nil {
+			utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you are not a member of this group"))
+			return
+		}
+	}
+	if !h.inTaskScope(w, update.Group_id, userID, update.Status_id, update.Priority_id) {
+		return
+	}
 
-	err = h.store.UpdateTask(types.Task{
+	err := h.store.UpdateTask(types.Task{
 		ID:             taskID,
 		Name:           update.Name,
 		Description:    update.Description,
@@ -339,6 +454,7 @@ func (h *Handler) handleUpdateTask(w http.ResponseWriter, r *http.Request) {
 		Category_id:    update.Category_id,
 		Parent_task_id: update.Parent_task_id,
 		Group_id:       update.Group_id,
+		Estimate:       update.Estimate,
 	})
 
 	if err != nil {
@@ -346,6 +462,8 @@ func (h *Handler) handleUpdateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.publish(types.Event{Type: types.EventTaskUpdated, TaskID: taskID, ActorID: userID})
+
 	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
 		"Status": "Task updated",
 	})
@@ -356,6 +474,52 @@ type task_status struct {
 }
 
 func (h *Handler) handleUpdateTaskStatus(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	taskID, ok := h.taskFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	var st task_status
+	if err := utils.ParseJSON(r, &st); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	task, err := h.store.GetTaskByID(taskID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if !h.inTaskScope(w, task.Group_id, userID, st.Id, 0) {
+		return
+	}
+
+	err = h.store.UpdateTaskStatus(taskID, st.Id)
+
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.publish(types.Event{
+		Type:    types.EventTaskStatusChanged,
+		TaskID:  taskID,
+		ActorID: userID,
+		Data:    map[string]interface{}{"status_id": st.Id},
+	})
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Task updated",
+	})
+}
+
+// handleMoveTask drops a card on a board column: it sets the status like
+// handleUpdateTaskStatus and stores the card's place between its neighbors.
+// A group_id in the body moves it on the group board instead of the personal
+// one.
+func (h *Handler) handleMoveTask(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	str, ok := vars["taskID"]
 	if !ok {
@@ -364,30 +528,168 @@ func (h *Handler) handleUpdateTaskStatus(w http.ResponseWriter, r *http.Request)
 	}
 
 	taskID, err := strconv.Atoi(str)
-	if err != nil {
+	if err != nil || taskID == 0 {
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid task ID"))
 		return
 	}
 
-	var st task_status
-	if err := utils.ParseJSON(r, &st); err != nil {
+	var move types.MoveTask
+	if err := utils.ParseJSON(r, &move); err != nil {
 		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
+	if move.PrevTaskID == taskID || move.NextTaskID == taskID {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("a task can not be its own neighbor"))
+		return
+	}
 
-	err = h.store.UpdateTaskStatus(taskID, st.Id)
+	allowed, err := h.store.CanAccessTask(taskID, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !allowed {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you have no access to this task"))
+		return
+	}
+
+	board := types.Board{UserID: userID}
+	if move.GroupID != 0 {
+		if _, err := h.groupStore.GetUserRole(move.GroupID, userID); err != nil {
+			utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you are not a member of this group"))
+			return
+		}
+		board = types.Board{GroupID: move.GroupID}
+	}
+
+	if move.StatusID != 0 {
+		task, err := h.store.GetTaskByID(taskID)
+		if err != nil {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		if !h.inTaskScope(w, task.Group_id, userID, move.StatusID, 0) {
+			return
+		}
+	}
 
+	position, err := h.store.MoveTask(taskID, board, move)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if move.StatusID != 0 {
+		h.publish(types.Event{
+			Type:    types.EventTaskStatusChanged,
+			TaskID:  taskID,
+			ActorID: userID,
+			Data:    map[string]interface{}{"status_id": move.StatusID},
+		})
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status":   "Task moved",
+		"position": position,
+	})
+}
+
+func (h *Handler) handleGetBoard(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	columns, err := h.store.GetBoard(types.Board{UserID: userID})
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
 	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
-		"Status": "Task updated",
+		"Status":  "Get board",
+		"columns": columns,
 	})
 }
 
-func (h *Handler) handleDeleteTask(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) handleGetGroupBoard(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	vars := mux.Vars(r)
+	str, ok := vars["groupID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing group ID"))
+		return
+	}
+
+	groupID, err := strconv.Atoi(str)
+	if err != nil || groupID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid group ID"))
+		return
+	}
+
+	_, err = h.groupStore.GetUserRole(groupID, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you are not a member of this group"))
+		return
+	}
+
+	columns, err := h.store.GetBoard(types.Board{GroupID: groupID})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status":  "Get group board",
+		"columns": columns,
+	})
+}
+
+// inTaskScope checks that the status and priority, when set, are system
+// defaults or belong to the task's scope: the group of a group task, the user
+// otherwise. It writes the error response when they are not.
+func (h *Handler) inTaskScope(w http.ResponseWriter, groupID, userID, statusID, priorityID int) bool {
+	scopeID, flag := userID, true
+	if groupID != 0 {
+		scopeID, flag = groupID, false
+	}
+
+	if statusID != 0 {
+		statuses, err := h.statusStore.GetStatuses(scopeID, flag)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return false
+		}
+		found := false
+		for _, st := range statuses {
+			found = found || st.ID == statusID
+		}
+		if !found {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("status %d is not available here", statusID))
+			return false
+		}
+	}
+
+	if priorityID != 0 {
+		priorities, err := h.priorityStore.GetPriorities(scopeID, flag)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return false
+		}
+		found := false
+		for _, p := range priorities {
+			found = found || p.ID == priorityID
+		}
+		if !found {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("priority %d is not available here", priorityID))
+			return false
+		}
+	}
+
+	return true
+}
+
+// handleDuplicateTask copies a task and its subtasks into the same place,
+// another group or the caller's personal list. A name already taken there
+// gets a " (copy)" suffix.
+func (h *Handler) handleDuplicateTask(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
 	vars := mux.Vars(r)
 	str, ok := vars["taskID"]
 	if !ok {
@@ -401,14 +703,499 @@ func (h *Handler) handleDeleteTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var dup types.DuplicateTask
+	if err := utils.ParseJSON(r, &dup); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	allowed, err := h.store.CanAccessTask(taskID, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !allowed {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you have no access to this task"))
+		return
+	}
+
+	src, err := h.store.GetTaskByID(taskID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	c := types.TaskCopy{
+		GroupID:    src.Group_id,
+		OffsetDays: dup.OffsetDays,
+		WithChats:  dup.WithChats,
+	}
+	if dup.GroupID != nil {
+		c.GroupID = *dup.GroupID
+	}
+	c.SameScope = c.GroupID == src.Group_id
+	if c.SameScope {
+		// A copied subtask stays next to the original.
+		c.ParentID = src.Parent_task_id
+	}
+
+	if c.GroupID == 0 {
+		c.Responsible = []types.ResponsibleUserID{{ID: int64(userID)}}
+	} else {
+		if _, err := h.groupStore.GetUserRole(c.GroupID, userID); err != nil {
+			utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you are not a member of this group"))
+			return
+		}
+		c.Responsible, err = h.copyResponsible(taskID, userID, c, dup.Responsible)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	name := dup.Name
+	if name == "" {
+		name = src.Name
+	}
+	c.Name, err = h.freeTaskName(name, userID, c)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	newID, err := h.store.DuplicateTask(taskID, c)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.publish(types.Event{
+		Type:    types.EventTaskCreated,
+		TaskID:  newID,
+		GroupID: c.GroupID,
+		ActorID: userID,
+		Data:    map[string]interface{}{"copied_from": taskID},
+	})
+
+	utils.WriteJson(w, http.StatusCreated, map[string]interface{}{
+		"Status":    "Task duplicated",
+		"task_id":   newID,
+		"task_name": c.Name,
+	})
+}
+
+// copyResponsible picks the responsible users of a copy in a group. Users
+// given in the request must be group members. Without them a copy in the
+// same group keeps each task's own users, and one in another group keeps the
+// original's users who are members there, or else the caller.
+func (h *Handler) copyResponsible(taskID, userID int, c types.TaskCopy, requested []types.ResponsibleUserID) ([]types.ResponsibleUserID, error) {
+	if len(requested) > 0 {
+		for _, m := range requested {
+			if _, err := h.groupStore.GetUserRole(c.GroupID, int(m.ID)); err != nil {
+				return nil, fmt.Errorf("user %d is not a member of this group", m.ID)
+			}
+		}
+		return requested, nil
+	}
+
+	if c.SameScope {
+		return nil, nil
+	}
+
+	rs, err := h.store.GetResponsible(taskID)
+	if err != nil {
+		return nil, err
+	}
+	members := make([]types.ResponsibleUserID, 0, len(rs))
+	for _, m := range rs {
+		if _, err := h.groupStore.GetUserRole(c.GroupID, int(m.ID)); err == nil {
+			members = append(members, m)
+		}
+	}
+	if len(members) == 0 {
+		members = append(members, types.ResponsibleUserID{ID: int64(userID)})
+	}
+	return members, nil
+}
+
+// freeTaskName returns the name if no task in the copy's place has it yet,
+// otherwise the first free "name (copy N)".
+func (h *Handler) freeTaskName(name string, userID int, c types.TaskCopy) (string, error) {
+	taken := func(n string) bool {
+		var err error
+		switch {
+		case c.ParentID != 0:
+			_, err = h.store.GetSubtaskByName(c.ParentID, n)
+		case c.GroupID != 0:
+			_, err = h.store.GetTaskByName(n, c.GroupID, false)
+		default:
+			_, err = h.store.GetTaskByName(n, userID, true)
+		}
+		return err == nil
+	}
+
+	if !taken(name) {
+		return name, nil
+	}
+	for i := 1; i <= maxCopyNumber; i++ {
+		if n := copyName(name, i); !taken(n) {
+			return n, nil
+		}
+	}
+	return "", fmt.Errorf("Task: %s has too many copies", name)
+}
+
+func (h *Handler) handleDeleteTask(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	taskID, ok := h.taskFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	// The task's responsible users and watchers go with it, so they are
+	// collected first.
+	deleted := types.Event{Type: types.EventTaskDeleted, TaskID: taskID, ActorID: userID}
+	if task, err := h.store.GetTaskByID(taskID); err == nil {
+		deleted.GroupID = task.Group_id
+		deleted.Data = map[string]interface{}{"name": task.Name}
+	}
+	recipients, err := h.store.GetTaskRecipients(taskID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	deleted.Recipients = recipients
+
 	err = h.store.DeleteTask(taskID)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
+	h.publish(deleted)
+
 	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
 		"Status":  "Task deleted",
 		"Task id": taskID,
 	})
 }
+
+func (h *Handler) handleGetResponsible(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	str, ok := vars["taskID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing task ID"))
+		return
+	}
+
+	taskID, err := strconv.Atoi(str)
+	if err != nil || taskID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid task ID"))
+		return
+	}
+
+	rs, err := h.store.GetResponsible(taskID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status":      "Get responsible users",
+		"responsible": rs,
+	})
+}
+
+func (h *Handler) handleAddResponsible(w http.ResponseWriter, r *http.Request) {
+	task, update, ok := h.parseResponsibleRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if len(update.Responsible) == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("no responsible users to add"))
+		return
+	}
+
+	err := h.store.AddResponsible(task.ID, update.Responsible, update.Subtasks)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.publishResponsible(r, task)
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Responsible users added",
+	})
+}
+
+func (h *Handler) handleReplaceResponsible(w http.ResponseWriter, r *http.Request) {
+	task, update, ok := h.parseResponsibleRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if len(update.Responsible) == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("Group task: %s must have responsible user", task.Name))
+		return
+	}
+
+	err := h.store.ReplaceResponsible(task.ID, update.Responsible, update.Subtasks)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.publishResponsible(r, task)
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Responsible users replaced",
+	})
+}
+
+func (h *Handler) handleRemoveResponsible(w http.ResponseWriter, r *http.Request) {
+	task, update, ok := h.parseResponsibleRequest(w, r)
+	if !ok {
+		return
+	}
+
+	removed := make(map[int64]bool)
+	for _, u := range update.Responsible {
+		removed[u.ID] = true
+	}
+
+	err := h.checkResponsibleLeft(*task, removed, update.Subtasks)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = h.store.RemoveResponsible(task.ID, update.Responsible, update.Subtasks)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.publishResponsible(r, task)
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Responsible users removed",
+	})
+}
+
+func (h *Handler) publishResponsible(r *http.Request, task *types.Task) {
+	h.publish(types.Event{
+		Type:    types.EventTaskResponsibleChanged,
+		TaskID:  task.ID,
+		GroupID: task.Group_id,
+		ActorID: auth.GetUserIDFromContext(r.Context()),
+	})
+}
+
+// parseResponsibleRequest loads the task from the route and the payload from
+// the body, and checks that the caller can access the task and the users
+// belong to the task's group. A personal task can only be assigned to its
+// owner, the caller. It writes the error response itself and reports whether
+// the handler may continue.
+func (h *Handler) parseResponsibleRequest(w http.ResponseWriter, r *http.Request) (*types.Task, *types.UpdateResponsible, bool) {
+	vars := mux.Vars(r)
+	str, ok := vars["taskID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing task ID"))
+		return nil, nil, false
+	}
+
+	taskID, err := strconv.Atoi(str)
+	if err != nil || taskID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid task ID"))
+		return nil, nil, false
+	}
+
+	var update types.UpdateResponsible
+	if err := utils.ParseJSON(r, &update); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return nil, nil, false
+	}
+
+	task, err := h.store.GetTaskByID(taskID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return nil, nil, false
+	}
+
+	userID := auth.GetUserIDFromContext(r.Context())
+	allowed, err := h.store.CanAccessTask(task.ID, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, nil, false
+	}
+	if !allowed {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you have no access to this task"))
+		return nil, nil, false
+	}
+
+	if task.Group_id == 0 {
+		for _, u := range update.Responsible {
+			if u.ID != int64(userID) {
+				utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("Task: %s is a personal task, only its owner can be responsible", task.Name))
+				return nil, nil, false
+			}
+		}
+		return task, &update, true
+	}
+
+	members, err := h.groupStore.GetUsers(task.Group_id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, nil, false
+	}
+
+	inGroup := make(map[int64]bool)
+	for _, m := range members {
+		inGroup[int64(m.ID)] = true
+	}
+	for _, u := range update.Responsible {
+		if !inGroup[u.ID] {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("User %d is not a member of this group", u.ID))
+			return nil, nil, false
+		}
+	}
+
+	return task, &update, true
+}
+
+// checkResponsibleLeft makes sure a task keeps at least one responsible
+// user once the removed users are gone, the same rule handleCreateTask applies.
+func (h *Handler) checkResponsibleLeft(task types.Task, removed map[int64]bool, withSubtasks bool) error {
+	rs, err := h.store.GetResponsible(task.ID)
+	if err != nil {
+		return err
+	}
+
+	left := 0
+	for _, u := range rs {
+		if !removed[u.ID] {
+			left++
+		}
+	}
+	if left == 0 {
+		return fmt.Errorf("Task: %s must have responsible user", task.Name)
+	}
+
+	if !withSubtasks {
+		return nil
+	}
+
+	subtasks, err := h.store.GetSubTasks(task.ID, types.TaskFilter{})
+	if err != nil {
+		return err
+	}
+	for _, sub := range subtasks {
+		if err := h.checkResponsibleLeft(sub, removed, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (h *Handler) handleGetGroupWorkload(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	vars := mux.Vars(r)
+	str, ok := vars["groupID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing group ID"))
+		return
+	}
+
+	groupID, err := strconv.Atoi(str)
+	if err != nil || groupID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid group ID"))
+		return
+	}
+
+	_, err = h.groupStore.GetUserRole(groupID, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you are not a member of this group"))
+		return
+	}
+
+	now := time.Now().UTC()
+	today := now.Truncate(24 * time.Hour)
+	from, to, err := parseDateRange(r, today.AddDate(0, 0, -30), today.AddDate(0, 0, 30))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	wl, err := h.store.GetGroupWorkload(groupID, from, to, now)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status":   "Get group workload",
+		"from":     from.Format(dateLayout),
+		"to":       to.AddDate(0, 0, -1).Format(dateLayout),
+		"workload": wl,
+	})
+}
+
+// parseTaskFilter reads the label filter of a task listing: ?labels= takes
+// comma separated label IDs and ?label_mode= one of any (default), all or none.
+func parseTaskFilter(r *http.Request) (types.TaskFilter, error) {
+	var f types.TaskFilter
+	q := r.URL.Query()
+
+	if str := q.Get("labels"); str != "" {
+		for _, part := range strings.Split(str, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || id <= 0 {
+				return f, fmt.Errorf("invalid label ID: %s", part)
+			}
+			f.Labels = append(f.Labels, id)
+		}
+	}
+
+	f.LabelMode = types.LabelModeAny
+	if mode := q.Get("label_mode"); mode != "" {
+		switch mode {
+		case types.LabelModeAny, types.LabelModeAll, types.LabelModeNone:
+			f.LabelMode = mode
+		default:
+			return f, fmt.Errorf("label_mode must be any, all or none")
+		}
+	}
+
+	return f, nil
+}
+
+// parseDateRange reads the inclusive ?from= and ?to= dates (YYYY-MM-DD) and
+// returns them as a half-open range [from, to+1 day).
+func parseDateRange(r *http.Request, defFrom, defTo time.Time) (time.Time, time.Time, error) {
+	from, to := defFrom, defTo
+
+	if str := r.URL.Query().Get("from"); str != "" {
+		t, err := time.Parse(dateLayout, str)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid from date: %s", str)
+		}
+		from = t
+	}
+
+	if str := r.URL.Query().Get("to"); str != "" {
+		t, err := time.Parse(dateLayout, str)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid to date: %s", str)
+		}
+		to = t
+	}
+
+	if to.Before(from) {
+		return from, to, fmt.Errorf("to date is before from date")
+	}
+
+	return from, to.AddDate(0, 0, 1), nil
+}
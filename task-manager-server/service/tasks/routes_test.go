@@ -0,0 +1,208 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SibHelly/task-manager-server/service/auth"
+	"github.com/SibHelly/task-manager-server/types"
+	"github.com/gorilla/mux"
+)
+
+// groups holds one group with member 1 who has 2FA and member 2 who has
+// not. It follows types.MemberCond: members without 2FA do not count while
+// the group requires it.
+type groups struct {
+	types.GroupStore
+	require2FA bool
+}
+
+func (g *groups) member(groupID, userID int) bool {
+	if groupID != 1 || (userID != 1 && userID != 2) {
+		return false
+	}
+	return !g.require2FA || userID == 1
+}
+
+func (g *groups) GetUserRole(groupID, userID int) (string, error) {
+	if !g.member(groupID, userID) {
+		return "", fmt.Errorf("not a member")
+	}
+	return "editor", nil
+}
+
+// tasks holds task 10 of group 1, with nobody responsible for it, and
+// personal task 20 of user 1.
+type tasks struct {
+	types.TasksStore
+	groups *groups
+}
+
+func (s *tasks) CanAccessTask(taskID, userID int) (bool, error) {
+	if taskID == 20 {
+		return userID == 1, nil
+	}
+	return taskID == 10 && s.groups.member(1, userID), nil
+}
+
+func (s *tasks) GetTaskByID(ID int) (*types.Task, error) {
+	if ID == 20 {
+		return &types.Task{ID: ID, Name: "Groceries"}, nil
+	}
+	return &types.Task{ID: ID, Name: "Report", Group_id: 1}, nil
+}
+
+func (s *tasks) GetTasks(ID int, flag bool, f types.TaskFilter) ([]types.Task, error) {
+	return []types.Task{{ID: 10, Name: "Report", Group_id: ID}}, nil
+}
+
+func TestGroupTasksNeed2FA(t *testing.T) {
+	g := &groups{}
+	handler := NewHandler(&tasks{groups: g}, nil, nil, nil, g, nil, nil)
+	router := mux.NewRouter()
+	router.HandleFunc("/task/{taskID}", handler.handleGetTask)
+	router.HandleFunc("/tasks/group/{groupID}", handler.handleGetTasksGroup)
+
+	get := func(path string, userID int) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, userID))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	for _, path := range []string{"/task/10", "/tasks/group/1"} {
+		for _, c := range []struct {
+			require2FA bool
+			userID     int
+			want       int
+		}{
+			{false, 2, http.StatusOK},
+			{true, 1, http.StatusOK},
+			{true, 2, http.StatusForbidden},
+			{false, 3, http.StatusForbidden},
+		} {
+			g.require2FA = c.require2FA
+			if code := get(path, c.userID); code != c.want {
+				t.Errorf("%s, user %d, require 2FA %v: expected status code %d, got %d",
+					path, c.userID, c.require2FA, c.want, code)
+			}
+		}
+	}
+}
+
+// scoped has system status and priority 1, and status and priority 2 of
+// group 1.
+type scoped struct {
+	types.StatusStore
+	types.PriorityStore
+}
+
+func (s scoped) GetStatuses(ID int, flag bool) ([]types.Status, error) {
+	out := []types.Status{{ID: 1}}
+	if !flag && ID == 1 {
+		out = append(out, types.Status{ID: 2, GroupID: 1})
+	}
+	return out, nil
+}
+
+func (s scoped) GetPriorities(ID int, flag bool) ([]types.Priority, error) {
+	out := []types.Priority{{ID: 1}}
+	if !flag && ID == 1 {
+		out = append(out, types.Priority{ID: 2, GroupID: 1})
+	}
+	return out, nil
+}
+
+func TestInTaskScope(t *testing.T) {
+	handler := NewHandler(nil, nil, scoped{}, scoped{}, nil, nil, nil)
+
+	for _, c := range []struct {
+		groupID, statusID, priorityID int
+		want                          bool
+	}{
+		{0, 0, 0, true},
+		{0, 1, 1, true},
+		{1, 2, 2, true},
+		{0, 2, 0, false},
+		{0, 0, 2, false},
+		{3, 2, 1, false},
+		{1, 5, 0, false},
+	} {
+		rr := httptest.NewRecorder()
+		if got := handler.inTaskScope(rr, c.groupID, 7, c.statusID, c.priorityID); got != c.want {
+			t.Errorf("group %d, status %d, priority %d: got %v", c.groupID, c.statusID, c.priorityID, got)
+		}
+		if !c.want && rr.Code != http.StatusBadRequest {
+			t.Errorf("group %d, status %d, priority %d: expected status code %d, got %d",
+				c.groupID, c.statusID, c.priorityID, http.StatusBadRequest, rr.Code)
+		}
+	}
+}
+
+type published []types.Event
+
+func (p *published) Publish(e types.Event) {
+	*p = append(*p, e)
+}
+
+func TestChangesNeedTaskAccess(t *testing.T) {
+	g := &groups{}
+	events := &published{}
+	handler := NewHandler(&tasks{groups: g}, nil, nil, nil, g, nil, events)
+
+	for _, c := range []struct {
+		handler http.HandlerFunc
+		path    string
+		body    string
+	}{
+		{handler.handleFinishTask, "/tasks/finish/10", ""},
+		{handler.handleUpdateTask, "/tasks/update/10", `{"task_name": "Report"}`},
+		{handler.handleUpdateTaskStatus, "/tasks/update/status/10", `{"status_id": 1}`},
+		{handler.handleDeleteTask, "/tasks/delete/10", ""},
+		{handler.handleCreateSubtask, "/tasks/createSubtask", `{"task_name": "Draft", "parent_task_id": 10}`},
+		{handler.handleCreateTask, "/tasks/create", `{"task_name": "Spam", "group_id": 1, "responsible_users_id": [{"responsible_id": 3}]}`},
+	} {
+		req := httptest.NewRequest(http.MethodPut, c.path, bytes.NewBufferString(c.body))
+		req = mux.SetURLVars(req, map[string]string{"taskID": "10"})
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 3))
+		rr := httptest.NewRecorder()
+		c.handler(rr, req)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("%s: expected status code %d, got %d: %s", c.path, http.StatusForbidden, rr.Code, rr.Body)
+		}
+	}
+	if len(*events) != 0 {
+		t.Errorf("refused changes published %+v", *events)
+	}
+}
+
+func TestPersonalTaskResponsible(t *testing.T) {
+	g := &groups{}
+	handler := NewHandler(&tasks{groups: g}, nil, nil, nil, g, nil, nil)
+
+	parse := func(userID int, body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/tasks/responsible/20", bytes.NewBufferString(body))
+		req = mux.SetURLVars(req, map[string]string{"taskID": "20"})
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, userID))
+		rr := httptest.NewRecorder()
+		if _, _, ok := handler.parseResponsibleRequest(rr, req); ok {
+			return http.StatusOK
+		}
+		return rr.Code
+	}
+
+	if code := parse(1, `{"responsible_users_id": [{"responsible_id": 1}]}`); code != http.StatusOK {
+		t.Errorf("owner: expected status code %d, got %d", http.StatusOK, code)
+	}
+	if code := parse(1, `{"responsible_users_id": [{"responsible_id": 2}]}`); code != http.StatusBadRequest {
+		t.Errorf("other user: expected status code %d, got %d", http.StatusBadRequest, code)
+	}
+	if code := parse(2, `{"responsible_users_id": [{"responsible_id": 2}]}`); code != http.StatusForbidden {
+		t.Errorf("no access: expected status code %d, got %d", http.StatusForbidden, code)
+	}
+}
@@ -3,11 +3,41 @@ package tasks
 import (
 	"database/sql"
 	"fmt"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/SibHelly/task-manager-server/types"
 )
 
+const dateLayout = "2006-01-02"
+
+// finishedStatusID is the status FinishTask moves a task to.
+const finishedStatusID = 1
+
+// openTaskCond matches tasks whose status is not a final one.
+const openTaskCond = "NOT EXISTS (SELECT 1 FROM status_map fs WHERE fs.status_id = t.status_id AND fs.is_final)"
+
+// Focus list scoring. A task scores its priority weight, plus up to
+// focusDeadlinePoints as its end_time approaches within focusHorizonHours,
+// plus focusOverduePoints once it is overdue. Tasks in a blocked status drop
+// below everything that can be worked on.
+const (
+	focusDeadlinePoints = 50
+	focusHorizonHours   = 14 * 24
+	focusOverduePoints  = 100
+	focusBlockedPenalty = 1000
+)
+
+var focusScore = fmt.Sprintf(`(COALESCE(pm.weight, 0)
+	+ CASE
+		WHEN t.end_time IS NULL THEN 0
+		WHEN t.end_time < UTC_TIMESTAMP() THEN %[3]d
+		ELSE GREATEST(0, %[1]d * (1 - TIMESTAMPDIFF(HOUR, UTC_TIMESTAMP(), t.end_time) / %[2]d))
+	END
+	- IF(COALESCE(sm.is_blocked, FALSE), %[4]d, 0))`,
+	focusDeadlinePoints, focusHorizonHours, focusOverduePoints, focusBlockedPenalty)
+
 type Store struct {
 	db *sql.DB
 }
@@ -16,7 +46,7 @@ func NewStore(db *sql.DB) *Store {
 	return &Store{db: db}
 }
 
-func (s *Store) GetTasks(ID int, flag bool) ([]types.Task, error) {
+func (s *Store) GetTasks(ID int, flag bool, f types.TaskFilter) ([]types.Task, error) {
 	var query string
 	if flag {
 		query = `SELECT t.* FROM tasks t
@@ -28,8 +58,9 @@ func (s *Store) GetTasks(ID int, flag bool) ([]types.Task, error) {
 		WHERE t.group_id = ?
 		`
 	}
+	cond, args := filterCond(f)
 
-	rows, err := s.db.Query(query, ID)
+	rows, err := s.db.Query(query+cond, append([]interface{}{ID}, args...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -44,15 +75,16 @@ func (s *Store) GetTasks(ID int, flag bool) ([]types.Task, error) {
 		tasks = append(tasks, *p)
 	}
 
-	return tasks, nil
+	return tasks, s.fillChecklists(tasks)
 }
 
-func (s *Store) GetAllTasksUser(ID int) ([]types.Task, error) {
+func (s *Store) GetAllTasksUser(ID int, f types.TaskFilter) ([]types.Task, error) {
 	query := `SELECT t.* FROM tasks t
 		JOIN do_users du ON t.task_id = du.task_id
 		WHERE du.user_id = ?
 		`
-	rows, err := s.db.Query(query, ID)
+	cond, args := filterCond(f)
+	rows, err := s.db.Query(query+cond, append([]interface{}{ID}, args...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -67,18 +99,26 @@ func (s *Store) GetAllTasksUser(ID int) ([]types.Task, error) {
 		tasks = append(tasks, *p)
 	}
 
-	return tasks, nil
+	return tasks, s.fillChecklists(tasks)
 }
-func (s *Store) GetMostPriorityTasks(ID int) ([]types.Task, error) {
+
+// GetMostPriorityTasks returns the user's focus list: unfinished top-level
+// tasks ranked by focusScore, followed by all of their subtasks.
+func (s *Store) GetMostPriorityTasks(ID int, limit int, f types.TaskFilter) ([]types.Task, error) {
+	cond, args := filterCond(f)
 	query := `SELECT t.* FROM tasks t
 	JOIN do_users du ON t.task_id = du.task_id
-	WHERE du.user_id = ? AND t.parent_task_id IS NULL
-	ORDER BY t.priority_id ASC
-	LIMIT 3`
-	rows, err := s.db.Query(query, ID)
+	LEFT JOIN priority_map pm ON pm.priority_id = t.priority_id
+	LEFT JOIN status_map sm ON sm.status_id = t.status_id
+	WHERE du.user_id = ? AND t.parent_task_id IS NULL AND ` + openTaskCond + cond + `
+	ORDER BY ` + focusScore + ` DESC, t.end_time IS NULL, t.end_time, t.task_id
+	LIMIT ?`
+	args = append([]interface{}{ID}, args...)
+	rows, err := s.db.Query(query, append(args, limit)...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	tasks := make([]types.Task, 0)
 	for rows.Next() {
@@ -89,30 +129,94 @@ func (s *Store) GetMostPriorityTasks(ID int) ([]types.Task, error) {
 
 		tasks = append(tasks, *p)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(tasks) == 0 {
+		return tasks, nil
+	}
+
+	placeholders := make([]string, len(tasks))
+	args = make([]interface{}, len(tasks))
+	for i, t := range tasks {
+		placeholders[i] = "?"
+		args[i] = t.ID
+	}
 
-	query = `SELECT * FROM tasks t WHERE t.parent_task_id = ?`
-	subtasks := make([]types.Task, 0)
+	query = `SELECT t.* FROM tasks t WHERE t.parent_task_id IN (` + strings.Join(placeholders, ", ") + `)
+	ORDER BY t.parent_task_id, t.task_id`
+	subRows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer subRows.Close()
 
-	for _, t := range tasks {
-		rows1, err := s.db.Query(query, t.ID)
+	for subRows.Next() {
+		p, err := scanRowsIntoTask(subRows)
 		if err != nil {
 			return nil, err
 		}
 
-		for rows1.Next() {
-			p, err := scanRowsIntoTask(rows1)
-			if err != nil {
-				return nil, err
-			}
+		tasks = append(tasks, *p)
+	}
+	if err := subRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tasks, s.fillChecklists(tasks)
+}
+
+// FindTasks returns the tasks the user can see, the ones they are
+// responsible for and those of their groups, that match the filter, in the
+// given types.Sort* order.
+func (s *Store) FindTasks(userID int, f types.TaskFilter, sort string) ([]types.Task, error) {
+	cond, args := filterCond(f)
+	query := `SELECT t.* FROM tasks t
+	LEFT JOIN priority_map pm ON pm.priority_id = t.priority_id
+	LEFT JOIN status_map sm ON sm.status_id = t.status_id
+	WHERE (EXISTS (SELECT 1 FROM do_users du WHERE du.task_id = t.task_id AND du.user_id = ?)
+		OR ` + types.MemberCond("t.group_id") + `)` + cond + `
+	ORDER BY ` + sortOrder(sort) + `, t.task_id`
+
+	rows, err := s.db.Query(query, append([]interface{}{userID, userID}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-			subtasks = append(subtasks, *p)
+	tasks := make([]types.Task, 0)
+	for rows.Next() {
+		p, err := scanRowsIntoTask(rows)
+		if err != nil {
+			return nil, err
 		}
+
+		tasks = append(tasks, *p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tasks, s.fillChecklists(tasks)
+}
+
+func sortOrder(sort string) string {
+	switch sort {
+	case types.SortPriority:
+		return "COALESCE(pm.weight, 0) DESC, t.end_time IS NULL, t.end_time"
+	case types.SortCreated:
+		return "t.created_at DESC"
+	case types.SortName:
+		return "t.task_name"
+	case types.SortFocus:
+		return focusScore + " DESC, t.end_time IS NULL, t.end_time"
+	default:
+		return "t.end_time IS NULL, t.end_time"
 	}
-	tasks = append(tasks, subtasks...)
-	return tasks, nil
 }
 
-func (s *Store) CreateTask(t types.CreateTask) error {
+func (s *Store) CreateTask(t types.CreateTask) (int, error) {
 	query := `INSERT INTO tasks (
 	task_name, 
 	task_description,
@@ -123,15 +227,16 @@ func (s *Store) CreateTask(t types.CreateTask) error {
 	attachments,
 	category_id,
 	parent_task_id,
-	group_id)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	group_id,
+	estimate)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
 	if t.Name == "" {
-		return fmt.Errorf("You must input name")
+		return 0, fmt.Errorf("You must input name")
 	}
 
 	if t.Responsible == nil {
-		return fmt.Errorf("You must add responsible user for this task")
+		return 0, fmt.Errorf("You must add responsible user for this task")
 	}
 
 	res, err := s.db.Exec(
@@ -145,26 +250,31 @@ func (s *Store) CreateTask(t types.CreateTask) error {
 		nullIfZero(t.Category_id),
 		nullIfZero(t.Parent_task_id),
 		nullIfZero(t.Group_id),
+		nullIfZero(t.Estimate),
 	)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	id, err := res.LastInsertId()
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	if err := recordStatus(s.db, int(id), t.Status_id); err != nil {
+		return 0, err
 	}
 
 	for _, m := range t.Responsible {
 		_, err = s.db.Exec("INSERT INTO do_users (user_id, task_id) VALUES (?, ?)", m.ID, id)
 		if err != nil {
-			return err
+			return 0, err
 		}
 	}
 
 	for _, sub := range t.Subtasks {
 		if sub.Name == "" {
-			return fmt.Errorf("You must input name")
+			return 0, fmt.Errorf("You must input name")
 		}
 		res, err := s.db.Exec(
 			query,
@@ -178,23 +288,27 @@ func (s *Store) CreateTask(t types.CreateTask) error {
 			nullIfZero(t.Category_id),
 			nullIfZero(int(id)),
 			nullIfZero(t.Group_id),
+			nullIfZero(sub.Estimate),
 		)
 		if err != nil {
-			return err
+			return 0, err
 		}
 		sub_id, err := res.LastInsertId()
 		if err != nil {
-			return err
+			return 0, err
+		}
+		if err := recordStatus(s.db, int(sub_id), sub.Status_id); err != nil {
+			return 0, err
 		}
 		for _, m := range t.Responsible {
 			_, err = s.db.Exec("INSERT INTO do_users (user_id, task_id) VALUES (?, ?)", m.ID, sub_id)
 			if err != nil {
-				return err
+				return 0, err
 			}
 		}
 	}
 
-	return nil
+	return int(id), nil
 }
 
 func (s *Store) UpdateTask(t types.Task) error {
@@ -208,7 +322,8 @@ func (s *Store) UpdateTask(t types.Task) error {
 	attachments = ?,
 	category_id = ?,
 	parent_task_id = ?,
-	group_id = ?
+	group_id = ?,
+	estimate = ?
 	WHERE task_id = ?`
 	_, err := s.db.Exec(query,
 		t.Name,
@@ -220,15 +335,310 @@ func (s *Store) UpdateTask(t types.Task) error {
 		nullIfZero(t.Category_id),
 		nullIfZero(t.Parent_task_id),
 		nullIfZero(t.Group_id),
+		nullIfZero(t.Estimate),
 		t.ID,
 	)
 	if err != nil {
 		return err
 	}
 
+	return recordStatus(s.db, t.ID, t.Status_id)
+}
+
+// boardFrom returns the FROM clause selecting the tasks t on the board with
+// their positions tp, and its arguments.
+func boardFrom(b types.Board) (string, []interface{}) {
+	if b.GroupID != 0 {
+		return `FROM tasks t
+	LEFT JOIN task_positions tp ON tp.task_id = t.task_id AND tp.group_id = ?
+	WHERE t.group_id = ?`, []interface{}{b.GroupID, b.GroupID}
+	}
+	return `FROM tasks t
+	JOIN do_users du ON du.task_id = t.task_id
+	LEFT JOIN task_positions tp ON tp.task_id = t.task_id AND tp.user_id = ?
+	WHERE du.user_id = ?`, []interface{}{b.UserID, b.UserID}
+}
+
+// GetBoard returns the board's cards by status column, columns in status
+// order. Cards never placed on the board come last in their column.
+func (s *Store) GetBoard(b types.Board) ([]types.BoardColumn, error) {
+	from, args := boardFrom(b)
+	query := `SELECT t.*, COALESCE(tp.sort_rank, '') ` + from + `
+	ORDER BY t.status_id IS NULL,
+		(SELECT sm.position FROM status_map sm WHERE sm.status_id = t.status_id),
+		t.status_id, tp.sort_rank IS NULL, tp.sort_rank, t.task_id`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make([]types.BoardColumn, 0)
+	for rows.Next() {
+		var position string
+		p, err := scanRowsIntoTask(rows, &position)
+		if err != nil {
+			return nil, err
+		}
+		p.Position = position
+
+		if n := len(columns); n == 0 || columns[n-1].StatusID != p.Status_id {
+			columns = append(columns, types.BoardColumn{StatusID: p.Status_id})
+		}
+		columns[len(columns)-1].Tasks = append(columns[len(columns)-1].Tasks, *p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, c := range columns {
+		if err := s.fillChecklists(c.Tasks); err != nil {
+			return nil, err
+		}
+	}
+
+	return columns, nil
+}
+
+type rankedTask struct {
+	id   int
+	rank string
+}
+
+// columnRanks returns the cards of one column of the board in order.
+func columnRanks(tx *sql.Tx, b types.Board, statusID int) ([]rankedTask, error) {
+	from, args := boardFrom(b)
+	query := `SELECT t.task_id, COALESCE(tp.sort_rank, '') ` + from + ` AND t.status_id <=> ?
+	ORDER BY tp.sort_rank IS NULL, tp.sort_rank, t.task_id`
+
+	rows, err := tx.Query(query, append(args, nullIfZero(statusID))...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var column []rankedTask
+	for rows.Next() {
+		var t rankedTask
+		if err := rows.Scan(&t.id, &t.rank); err != nil {
+			return nil, err
+		}
+		column = append(column, t)
+	}
+
+	return column, rows.Err()
+}
+
+func setRank(db execer, b types.Board, taskID int, rank string) error {
+	_, err := db.Exec(`INSERT INTO task_positions (task_id, user_id, group_id, sort_rank)
+	VALUES (?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE sort_rank = VALUES(sort_rank)`,
+		taskID, nullIfZero(b.UserID), nullIfZero(b.GroupID), rank)
+	return err
+}
+
+// spreadColumn gives the cards evenly spaced ranks in the given order.
+func spreadColumn(tx *sql.Tx, b types.Board, ids []int) error {
+	for i, rank := range spreadRanks(len(ids)) {
+		if err := setRank(tx, b, ids[i], rank); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// MoveTask changes the task's status the way UpdateTaskStatus does and
+// places the card on the board, in one transaction. It returns the card's new
+// position.
+func (s *Store) MoveTask(taskID int, b types.Board, m types.MoveTask) (string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var current sql.NullInt64
+	err = tx.QueryRow("SELECT status_id FROM tasks WHERE task_id = ?", taskID).Scan(&current)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("task not found")
+		}
+		return "", err
+	}
+
+	if int(current.Int64) != m.StatusID {
+		_, err = tx.Exec("UPDATE tasks SET status_id = ? WHERE task_id = ?", nullIfZero(m.StatusID), taskID)
+		if err != nil {
+			return "", err
+		}
+		if err := recordStatus(tx, taskID, m.StatusID); err != nil {
+			return "", err
+		}
+	}
+
+	column, err := columnRanks(tx, b, m.StatusID)
+	if err != nil {
+		return "", err
+	}
+
+	others := make([]rankedTask, 0, len(column))
+	found, unranked := false, false
+	for _, t := range column {
+		if t.id == taskID {
+			found = true
+			continue
+		}
+		if t.rank == "" {
+			unranked = true
+		}
+		others = append(others, t)
+	}
+	if !found {
+		return "", fmt.Errorf("task is not on this board")
+	}
+
+	indexOf := func(id int) int {
+		for i, t := range others {
+			if t.id == id {
+				return i
+			}
+		}
+		return -1
+	}
+
+	at := len(others)
+	if m.PrevTaskID != 0 {
+		i := indexOf(m.PrevTaskID)
+		if i < 0 {
+			return "", fmt.Errorf("task %d is not in this column", m.PrevTaskID)
+		}
+		at = i + 1
+	}
+	if m.NextTaskID != 0 {
+		i := indexOf(m.NextTaskID)
+		if i < 0 {
+			return "", fmt.Errorf("task %d is not in this column", m.NextTaskID)
+		}
+		if m.PrevTaskID != 0 && i != at {
+			return "", fmt.Errorf("tasks %d and %d are not neighbors", m.PrevTaskID, m.NextTaskID)
+		}
+		at = i
+	}
+
+	var rank string
+	if !unranked {
+		var prev, next string
+		if at > 0 {
+			prev = others[at-1].rank
+		}
+		if at < len(others) {
+			next = others[at].rank
+		}
+		rank, err = rankBetween(prev, next)
+	}
+
+	if unranked || err != nil || len(rank) > maxRankLen {
+		ids := make([]int, 0, len(others)+1)
+		for i, t := range others {
+			if i == at {
+				ids = append(ids, taskID)
+			}
+			ids = append(ids, t.id)
+		}
+		if at == len(others) {
+			ids = append(ids, taskID)
+		}
+		if err := spreadColumn(tx, b, ids); err != nil {
+			return "", err
+		}
+		rank = spreadRanks(len(ids))[at]
+	} else if err := setRank(tx, b, taskID, rank); err != nil {
+		return "", err
+	}
+
+	return rank, tx.Commit()
+}
+
+// RebalancePositions respreads the board columns whose ranks grew longer
+// than rebalanceRankLen. It returns the number of columns rewritten.
+func (s *Store) RebalancePositions() (int, error) {
+	rows, err := s.db.Query(`SELECT DISTINCT COALESCE(tp.user_id, 0), COALESCE(tp.group_id, 0), COALESCE(t.status_id, 0)
+	FROM task_positions tp
+	JOIN tasks t ON t.task_id = tp.task_id
+	WHERE LENGTH(tp.sort_rank) > ?`, rebalanceRankLen)
+	if err != nil {
+		return 0, err
+	}
+
+	type boardColumn struct {
+		board    types.Board
+		statusID int
+	}
+	var columns []boardColumn
+	for rows.Next() {
+		var c boardColumn
+		if err := rows.Scan(&c.board.UserID, &c.board.GroupID, &c.statusID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		columns = append(columns, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for i, c := range columns {
+		if err := s.rebalanceColumn(c.board, c.statusID); err != nil {
+			return i, err
+		}
+	}
+
+	return len(columns), nil
+}
+
+func (s *Store) rebalanceColumn(b types.Board, statusID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	column, err := columnRanks(tx, b, statusID)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]int, len(column))
+	for i, t := range column {
+		ids[i] = t.id
+	}
+	if err := spreadColumn(tx, b, ids); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RunRebalancer calls RebalancePositions every interval. It never returns,
+// so start it in its own goroutine.
+func (s *Store) RunRebalancer(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		n, err := s.RebalancePositions()
+		if err != nil {
+			log.Printf("rebalance board positions: %v", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("rebalanced %d board columns", n)
+		}
+	}
+}
+
 func (s *Store) UpdateTaskStatus(ID, status_id int) error {
 	query := `UPDATE tasks 
 	SET status_id = ?
@@ -241,14 +651,14 @@ func (s *Store) UpdateTaskStatus(ID, status_id int) error {
 		if err != nil {
 			return err
 		}
-		return nil
+		return recordStatus(s.db, ID, 0)
 	}
 	_, err := s.db.Exec(query, status_id, ID)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return recordStatus(s.db, ID, status_id)
 }
 
 func (s *Store) FinishTask(ID int) error {
@@ -262,25 +672,39 @@ func (s *Store) FinishTask(ID int) error {
 	}
 
 	query = `UPDATE tasks 
-	SET status_id = 1
+	SET status_id = ?
 	WHERE task_id = ?`
-	_, err = s.db.Exec(query, ID)
+	_, err = s.db.Exec(query, finishedStatusID, ID)
 	if err != nil {
 		return err
 	}
 
+	if err := recordStatus(s.db, ID, finishedStatusID); err != nil {
+		return err
+	}
+
 	if count == 0 {
 		return nil
 	}
 
 	query = `UPDATE tasks 
-	SET status_id = 1
+	SET status_id = ?
 	WHERE parent_task_id = ?`
-	_, err = s.db.Exec(query, ID)
+	_, err = s.db.Exec(query, finishedStatusID, ID)
 	if err != nil {
 		return fmt.Errorf("error updating child tasks status: %w", err)
 	}
 
+	subtasks, err := s.GetSubTasks(ID, types.TaskFilter{})
+	if err != nil {
+		return err
+	}
+	for _, sub := range subtasks {
+		if err := recordStatus(s.db, sub.ID, finishedStatusID); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -378,14 +802,135 @@ func (s *Store) GetTaskByID(ID int) (*types.Task, error) {
 		return nil, fmt.Errorf("Task not found")
 	}
 
-	return t, nil
+	tasks := []types.Task{*t}
+	if err := s.fillChecklists(tasks); err != nil {
+		return nil, err
+	}
+
+	return &tasks[0], nil
+}
+
+// CanAccessTask reports whether the user is responsible for the task or is a
+// member of the group the task belongs to, see types.MemberCond.
+func (s *Store) CanAccessTask(taskID, userID int) (bool, error) {
+	query := `SELECT EXISTS (
+		SELECT 1 FROM tasks t
+		WHERE t.task_id = ? AND (
+			EXISTS (SELECT 1 FROM do_users du WHERE du.task_id = t.task_id AND du.user_id = ?)
+			OR ` + types.MemberCond("t.group_id") + `
+		)
+	)`
+
+	var ok bool
+	err := s.db.QueryRow(query, taskID, userID, userID).Scan(&ok)
+	if err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
+// AddWatcher makes the user watch the task. Watching an already watched task
+// keeps the original reason.
+func (s *Store) AddWatcher(taskID, userID int, reason string) error {
+	_, err := s.db.Exec("INSERT IGNORE INTO task_watchers (task_id, user_id, reason, created_at) VALUES (?, ?, ?, ?)",
+		taskID, userID, reason, time.Now().UTC())
+	return err
+}
+
+func (s *Store) RemoveWatcher(taskID, userID int) error {
+	res, err := s.db.Exec("DELETE FROM task_watchers WHERE task_id = ? AND user_id = ?", taskID, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("you are not watching this task")
+	}
+	return nil
+}
+
+func (s *Store) GetWatchers(taskID int) ([]types.Watcher, error) {
+	rows, err := s.db.Query(`SELECT tw.user_id, u.name, tw.reason, tw.created_at
+	FROM task_watchers tw
+	JOIN users u ON u.user_id = tw.user_id
+	WHERE tw.task_id = ?
+	ORDER BY tw.created_at, tw.user_id`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	watchers := make([]types.Watcher, 0)
+	for rows.Next() {
+		var w types.Watcher
+		if err := rows.Scan(&w.UserID, &w.Name, &w.Reason, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		watchers = append(watchers, w)
+	}
+
+	return watchers, rows.Err()
 }
 
-func (s *Store) GetSubTasks(ID int) ([]types.Task, error) {
+func (s *Store) GetWatchedTasks(userID int) ([]types.Task, error) {
+	rows, err := s.db.Query(`SELECT t.* FROM tasks t
+	JOIN task_watchers tw ON tw.task_id = t.task_id
+	WHERE tw.user_id = ?
+	ORDER BY tw.created_at DESC, t.task_id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := make([]types.Task, 0)
+	for rows.Next() {
+		p, err := scanRowsIntoTask(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		tasks = append(tasks, *p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tasks, s.fillChecklists(tasks)
+}
+
+// GetTaskRecipients returns the users who hear about changes to the task:
+// its responsible users and its watchers.
+func (s *Store) GetTaskRecipients(taskID int) ([]int, error) {
+	rows, err := s.db.Query(`SELECT user_id FROM do_users WHERE task_id = ?
+	UNION
+	SELECT user_id FROM task_watchers WHERE task_id = ?`, taskID, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]int, 0)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		users = append(users, id)
+	}
+
+	return users, rows.Err()
+}
+
+func (s *Store) GetSubTasks(ID int, f types.TaskFilter) ([]types.Task, error) {
 
 	query := "SELECT t.* FROM tasks t WHERE t.parent_task_id = ?"
+	cond, args := filterCond(f)
 
-	rows, err := s.db.Query(query, ID)
+	rows, err := s.db.Query(query+cond, append([]interface{}{ID}, args...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -400,7 +945,7 @@ func (s *Store) GetSubTasks(ID int) ([]types.Task, error) {
 		tasks = append(tasks, *p)
 	}
 
-	return tasks, nil
+	return tasks, s.fillChecklists(tasks)
 }
 
 func (s *Store) GetTaskIdByName(name string, ID int, flag bool) (*int, error) {
@@ -431,7 +976,7 @@ func (s *Store) GetTaskIdByName(name string, ID int, flag bool) (*int, error) {
 	return &t.ID, nil
 }
 
-func (s *Store) AddSubtask(t types.CreateTask) error {
+func (s *Store) AddSubtask(t types.CreateTask) (int, error) {
 	query := `INSERT INTO tasks (
 	task_name, 
 	task_description,
@@ -442,15 +987,16 @@ func (s *Store) AddSubtask(t types.CreateTask) error {
 	attachments,
 	category_id,
 	parent_task_id,
-	group_id)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	group_id,
+	estimate)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
 	if t.Name == "" {
-		return fmt.Errorf("You must input name")
+		return 0, fmt.Errorf("You must input name")
 	}
 
 	if t.Responsible == nil {
-		return fmt.Errorf("You must add responsible user for this task")
+		return 0, fmt.Errorf("You must add responsible user for this task")
 	}
 
 	res, err := s.db.Exec(
@@ -464,22 +1010,106 @@ func (s *Store) AddSubtask(t types.CreateTask) error {
 		nullIfZero(t.Category_id),
 		nullIfZero(t.Parent_task_id),
 		nullIfZero(t.Group_id),
+		nullIfZero(t.Estimate),
 	)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	id, err := res.LastInsertId()
 	if err != nil {
-		return err
+		return 0, err
+	}
+	if err := recordStatus(s.db, int(id), t.Status_id); err != nil {
+		return 0, err
 	}
 	for _, m := range t.Responsible {
 		_, err = s.db.Exec("INSERT INTO do_users (user_id, task_id) VALUES (?, ?)", m.ID, id)
 		if err != nil {
-			return err
+			return 0, err
 		}
 	}
-	return nil
+	return int(id), nil
+}
+
+// CreateTaskTree creates the task with its whole subtask tree in one
+// transaction. Subtasks get the group and responsible users of the root.
+func (s *Store) CreateTaskTree(t types.CreateTask) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := createTaskTree(tx, t, t)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// createTaskTree inserts t, then its subtasks under it.
+func createTaskTree(tx *sql.Tx, t, root types.CreateTask) (int, error) {
+	if t.Name == "" {
+		return 0, fmt.Errorf("You must input name")
+	}
+	if root.Responsible == nil {
+		return 0, fmt.Errorf("You must add responsible user for this task")
+	}
+
+	res, err := tx.Exec(`INSERT INTO tasks (
+	task_name,
+	task_description,
+	priority_id,
+	status_id,
+	start_time,
+	end_time,
+	attachments,
+	category_id,
+	parent_task_id,
+	group_id,
+	estimate)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.Name,
+		nullIfempty(t.Description),
+		nullIfZero(t.Priority_id),
+		nullIfZero(t.Status_id),
+		nullIfZeroTime(t.StartTime), nullIfZeroTime(t.EndTime),
+		nullIfempty(t.Attachments),
+		nullIfZero(t.Category_id),
+		nullIfZero(t.Parent_task_id),
+		nullIfZero(root.Group_id),
+		nullIfZero(t.Estimate),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id64, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	id := int(id64)
+
+	if err := recordStatus(tx, id, t.Status_id); err != nil {
+		return 0, err
+	}
+	for _, m := range root.Responsible {
+		_, err = tx.Exec("INSERT INTO do_users (user_id, task_id) VALUES (?, ?)", m.ID, id)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	for _, sub := range t.Subtasks {
+		sub.Parent_task_id = id
+		if _, err := createTaskTree(tx, sub, root); err != nil {
+			return 0, err
+		}
+	}
+
+	return id, nil
 }
 
 func (s *Store) GetSubtaskByName(ParentID int, subtask_name string) (*types.Task, error) {
@@ -524,7 +1154,250 @@ func (s *Store) GetResponsible(ID int) ([]types.ResponsibleUserID, error) {
 	return responsible, nil
 }
 
-func scanRowsIntoTask(rows *sql.Rows) (*types.Task, error) {
+func (s *Store) AddResponsible(taskID int, users []types.ResponsibleUserID, withSubtasks bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ids, err := taskTreeIDs(tx, taskID, withSubtasks)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		for _, u := range users {
+			_, err = tx.Exec("INSERT IGNORE INTO do_users (user_id, task_id) VALUES (?, ?)", u.ID, id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) RemoveResponsible(taskID int, users []types.ResponsibleUserID, withSubtasks bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ids, err := taskTreeIDs(tx, taskID, withSubtasks)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		for _, u := range users {
+			_, err = tx.Exec("DELETE FROM do_users WHERE user_id = ? AND task_id = ?", u.ID, id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) ReplaceResponsible(taskID int, users []types.ResponsibleUserID, withSubtasks bool) error {
+	if len(users) == 0 {
+		return fmt.Errorf("You must add responsible user for this task")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ids, err := taskTreeIDs(tx, taskID, withSubtasks)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		_, err = tx.Exec("DELETE FROM do_users WHERE task_id = ?", id)
+		if err != nil {
+			return err
+		}
+		for _, u := range users {
+			_, err = tx.Exec("INSERT IGNORE INTO do_users (user_id, task_id) VALUES (?, ?)", u.ID, id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// taskTreeIDs returns the task itself and, when withSubtasks is set,
+// every task below it in the parent_task_id hierarchy.
+func taskTreeIDs(tx *sql.Tx, taskID int, withSubtasks bool) ([]int, error) {
+	if !withSubtasks {
+		return []int{taskID}, nil
+	}
+
+	query := `WITH RECURSIVE tree AS (
+		SELECT task_id FROM tasks WHERE task_id = ?
+		UNION ALL
+		SELECT t.task_id FROM tasks t JOIN tree ON t.parent_task_id = tree.task_id
+	)
+	SELECT task_id FROM tree`
+	rows, err := tx.Query(query, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int, 0)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// GetGroupWorkload aggregates the open tasks of every group member. Tasks
+// count when their end_time falls in [from, to) or when they have no end_time,
+// and are overdue when their end_time is before now.
+func (s *Store) GetGroupWorkload(groupID int, from, to, now time.Time) ([]types.MemberWorkload, error) {
+	inRange := "(t.end_time IS NULL OR (t.end_time >= ? AND t.end_time < ?))"
+
+	query := `SELECT u.user_id, u.name, COALESCE(i.role, ''),
+		COUNT(t.task_id),
+		COALESCE(SUM(t.end_time < ?), 0),
+		COALESCE(SUM(t.estimate), 0)
+	FROM inclusions i
+	JOIN users u ON u.user_id = i.user_id
+	LEFT JOIN do_users du ON du.user_id = i.user_id
+	LEFT JOIN tasks t ON t.task_id = du.task_id
+		AND t.group_id = i.group_id
+		AND ` + openTaskCond + `
+		AND ` + inRange + `
+	WHERE i.group_id = ?
+	GROUP BY u.user_id, u.name, i.role
+	ORDER BY u.name`
+	rows, err := s.db.Query(query, now, from, to, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workload := make([]types.MemberWorkload, 0)
+	index := make(map[int]int)
+	for rows.Next() {
+		var m types.MemberWorkload
+		err := rows.Scan(&m.ID, &m.Name, &m.Role, &m.OpenTasks, &m.OverdueTasks, &m.Estimate)
+		if err != nil {
+			return nil, err
+		}
+		m.ByPriority = make([]types.PriorityCount, 0)
+		m.DueByDay = make([]types.DayCount, 0)
+		index[m.ID] = len(workload)
+		workload = append(workload, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `SELECT du.user_id, COALESCE(t.priority_id, 0), COUNT(*)
+	FROM tasks t
+	JOIN do_users du ON du.task_id = t.task_id
+	WHERE t.group_id = ?
+		AND ` + openTaskCond + `
+		AND ` + inRange + `
+	GROUP BY du.user_id, t.priority_id
+	ORDER BY du.user_id, t.priority_id`
+	rows, err = s.db.Query(query, groupID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID int
+		var c types.PriorityCount
+		if err := rows.Scan(&userID, &c.PriorityID, &c.Count); err != nil {
+			return nil, err
+		}
+		if i, ok := index[userID]; ok {
+			workload[i].ByPriority = append(workload[i].ByPriority, c)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `SELECT du.user_id, DATE(t.end_time), COUNT(*)
+	FROM tasks t
+	JOIN do_users du ON du.task_id = t.task_id
+	WHERE t.group_id = ?
+		AND ` + openTaskCond + `
+		AND t.end_time >= ? AND t.end_time < ?
+	GROUP BY du.user_id, DATE(t.end_time)
+	ORDER BY du.user_id, DATE(t.end_time)`
+	rows, err = s.db.Query(query, groupID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID int
+		var day time.Time
+		var count int
+		if err := rows.Scan(&userID, &day, &count); err != nil {
+			return nil, err
+		}
+		if i, ok := index[userID]; ok {
+			workload[i].DueByDay = append(workload[i].DueByDay, types.DayCount{
+				Day:   day.Format(dateLayout),
+				Count: count,
+			})
+		}
+	}
+
+	return workload, rows.Err()
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// recordStatus keeps task_status_history in step with tasks.status_id: the
+// open history row is closed and a new one opened when the status changed.
+func recordStatus(db execer, taskID, statusID int) error {
+	var current sql.NullInt64
+	err := db.QueryRow("SELECT status_id FROM task_status_history WHERE task_id = ? AND left_at IS NULL", taskID).Scan(&current)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if err == nil && int(current.Int64) == statusID {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	_, err = db.Exec("UPDATE task_status_history SET left_at = ? WHERE task_id = ? AND left_at IS NULL", now, taskID)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("INSERT INTO task_status_history (task_id, status_id, entered_at) VALUES (?, ?, ?)", taskID, nullIfZero(statusID), now)
+	return err
+}
+
+// scanRowsIntoTask scans a t.* row; extra receives any columns selected
+// after it.
+func scanRowsIntoTask(rows *sql.Rows, extra ...interface{}) (*types.Task, error) {
 	task := new(types.Task)
 
 	// Временные переменные для полей, которые могут быть NULL
@@ -538,9 +1411,11 @@ func scanRowsIntoTask(rows *sql.Rows) (*types.Task, error) {
 		startTime    sql.NullTime
 		endTime      sql.NullTime
 		attachments  sql.NullString
+		estimate     sql.NullInt64
+		createdAt    time.Time
 	)
 
-	err := rows.Scan(
+	dest := []interface{}{
 		&task.ID,
 		&task.Name,
 		&description,
@@ -552,7 +1427,10 @@ func scanRowsIntoTask(rows *sql.Rows) (*types.Task, error) {
 		&categoryID,
 		&parentTaskID,
 		&groupID,
-	)
+		&estimate,
+		&createdAt,
+	}
+	err := rows.Scan(append(dest, extra...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -612,9 +1490,119 @@ func scanRowsIntoTask(rows *sql.Rows) (*types.Task, error) {
 		task.Group_id = 0
 	}
 
+	if estimate.Valid {
+		task.Estimate = int(estimate.Int64)
+	} else {
+		task.Estimate = 0
+	}
+
+	task.CreatedAt = createdAt
+
 	return task, nil
 }
 
+// fillChecklists sets the checklist progress of the tasks that have
+// checklist items, with one query for the whole slice.
+func (s *Store) fillChecklists(tasks []types.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, len(tasks))
+	index := make(map[int]int, len(tasks))
+	for i, t := range tasks {
+		args[i] = t.ID
+		index[t.ID] = i
+	}
+
+	rows, err := s.db.Query(`SELECT task_id, COUNT(*), COALESCE(SUM(is_checked), 0)
+	FROM checklist_items
+	WHERE task_id IN `+placeholders(len(tasks))+`
+	GROUP BY task_id`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var taskID int
+		p := new(types.ChecklistProgress)
+		if err := rows.Scan(&taskID, &p.Total, &p.Checked); err != nil {
+			return err
+		}
+		p.Percent = p.Checked * 100 / p.Total
+		tasks[index[taskID]].Checklist = p
+	}
+
+	return rows.Err()
+}
+
+// filterCond turns the filter into an " AND ..." clause on tasks t and its
+// arguments. It returns an empty clause for the zero filter.
+func filterCond(f types.TaskFilter) (string, []interface{}) {
+	var b strings.Builder
+	var args []interface{}
+
+	inList := func(column string, ids []int) {
+		if len(ids) == 0 {
+			return
+		}
+		b.WriteString(" AND " + column + " IN " + placeholders(len(ids)))
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+	inList("t.status_id", f.Statuses)
+	inList("t.priority_id", f.Priorities)
+	inList("t.category_id", f.Categories)
+	inList("t.group_id", f.Groups)
+
+	if f.OpenOnly || f.Overdue {
+		b.WriteString(" AND " + openTaskCond)
+	}
+	if f.Overdue {
+		b.WriteString(" AND t.end_time < UTC_TIMESTAMP()")
+	}
+
+	if len(f.Labels) > 0 {
+		in := placeholders(len(f.Labels))
+		switch f.LabelMode {
+		case types.LabelModeAll:
+			b.WriteString(` AND (SELECT COUNT(DISTINCT tl.label_id) FROM task_labels tl
+			WHERE tl.task_id = t.task_id AND tl.label_id IN ` + in + `) = ?`)
+		case types.LabelModeNone:
+			b.WriteString(" AND NOT EXISTS (SELECT 1 FROM task_labels tl WHERE tl.task_id = t.task_id AND tl.label_id IN " + in + ")")
+		default:
+			b.WriteString(" AND EXISTS (SELECT 1 FROM task_labels tl WHERE tl.task_id = t.task_id AND tl.label_id IN " + in + ")")
+		}
+		for _, id := range f.Labels {
+			args = append(args, id)
+		}
+		if f.LabelMode == types.LabelModeAll {
+			args = append(args, len(distinct(f.Labels)))
+		}
+	}
+
+	return b.String(), args
+}
+
+// placeholders returns "(?, ?, ...)" with n markers.
+func placeholders(n int) string {
+	return "(" + strings.TrimSuffix(strings.Repeat("?, ", n), ", ") + ")"
+}
+
+func distinct(ids []int) []int {
+	seen := make(map[int]bool, len(ids))
+	out := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
 func nullIfZero(i int) interface{} {
 	if i == 0 {
 		return nil
@@ -0,0 +1,116 @@
+package tasks
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/SibHelly/task-manager-server/service/auth"
+	"github.com/SibHelly/task-manager-server/service/events"
+	"github.com/SibHelly/task-manager-server/types"
+	"github.com/SibHelly/task-manager-server/utils"
+	"github.com/gorilla/mux"
+)
+
+func (h *Handler) handleGetWatchers(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	taskID, ok := h.taskFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	ws, err := h.store.GetWatchers(taskID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status":   "Get watchers",
+		"watchers": ws,
+	})
+}
+
+func (h *Handler) handleWatchTask(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	taskID, ok := h.taskFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	err := h.store.AddWatcher(taskID, userID, types.WatchManual)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Watching task",
+	})
+}
+
+func (h *Handler) handleUnwatchTask(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	taskID, ok := h.taskFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	err := h.store.RemoveWatcher(taskID, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Stopped watching task",
+	})
+}
+
+func (h *Handler) handleGetWatchedTasks(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	ts, err := h.store.GetWatchedTasks(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Get watched tasks",
+		"tasks":  ts,
+	})
+}
+
+// taskFromRequest reads the task ID from the route and checks the user can
+// access the task. It writes the error response itself.
+func (h *Handler) taskFromRequest(w http.ResponseWriter, r *http.Request, userID int) (int, bool) {
+	vars := mux.Vars(r)
+	str, ok := vars["taskID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing task ID"))
+		return 0, false
+	}
+
+	taskID, err := strconv.Atoi(str)
+	if err != nil || taskID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid task ID"))
+		return 0, false
+	}
+
+	allowed, err := h.store.CanAccessTask(taskID, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return 0, false
+	}
+	if !allowed {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you have no access to this task"))
+		return 0, false
+	}
+
+	return taskID, true
+}
+
+// publish sends a task event, see events.PublishTask.
+func (h *Handler) publish(e types.Event) {
+	events.PublishTask(h.events, h.store, e)
+}
@@ -0,0 +1,53 @@
+package template
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// variablePattern matches {{name}}, spaces inside the braces allowed.
+var variablePattern = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_]+)\s*\}\}`)
+
+// expand replaces the {{variables}} of text with their values. Variables
+// without a value are left as they are and added to missing.
+func expand(text string, vars map[string]string, missing map[string]bool) string {
+	return variablePattern.ReplaceAllStringFunc(text, func(m string) string {
+		name := variablePattern.FindStringSubmatch(m)[1]
+		if v, ok := vars[name]; ok {
+			return v
+		}
+		missing[name] = true
+		return m
+	})
+}
+
+// missingList returns the names in missing sorted and comma separated.
+func missingList(missing map[string]bool) string {
+	names := make([]string, 0, len(missing))
+	for name := range missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// offsetDays returns how many whole days t is after anchor, or nil when
+// either is unset.
+func offsetDays(t, anchor time.Time) *int {
+	if t.IsZero() || anchor.IsZero() {
+		return nil
+	}
+	days := int(math.Round(t.Sub(anchor).Hours() / 24))
+	return &days
+}
+
+// atOffset is the inverse of offsetDays.
+func atOffset(start time.Time, days *int) time.Time {
+	if days == nil {
+		return time.Time{}
+	}
+	return start.AddDate(0, 0, *days)
+}
@@ -0,0 +1,42 @@
+package template
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpand(t *testing.T) {
+	vars := map[string]string{"client": "ACME", "date": "2024-05-01"}
+	missing := make(map[string]bool)
+
+	got := expand("Onboard {{client}} on {{ date }}, ask {{owner}} and {{owner}}", vars, missing)
+	want := "Onboard ACME on 2024-05-01, ask {{owner}} and {{owner}}"
+	if got != want {
+		t.Errorf("expand = %q, want %q", got, want)
+	}
+	if list := missingList(missing); list != "owner" {
+		t.Errorf("missing = %q, want %q", list, "owner")
+	}
+}
+
+func TestOffsetDays(t *testing.T) {
+	anchor := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+
+	if d := offsetDays(time.Time{}, anchor); d != nil {
+		t.Errorf("offset of zero time = %d, want nil", *d)
+	}
+
+	due := time.Date(2024, 5, 4, 18, 0, 0, 0, time.UTC)
+	d := offsetDays(due, anchor)
+	if d == nil || *d != 3 {
+		t.Fatalf("offsetDays = %v, want 3", d)
+	}
+
+	start := time.Date(2025, 1, 10, 9, 0, 0, 0, time.UTC)
+	if got := atOffset(start, d); !got.Equal(start.AddDate(0, 0, 3)) {
+		t.Errorf("atOffset = %v", got)
+	}
+	if got := atOffset(start, nil); !got.IsZero() {
+		t.Errorf("atOffset(nil) = %v, want zero", got)
+	}
+}
@@ -0,0 +1,395 @@
+package template
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SibHelly/task-manager-server/service/auth"
+	"github.com/SibHelly/task-manager-server/types"
+	"github.com/SibHelly/task-manager-server/utils"
+	"github.com/gorilla/mux"
+)
+
+const dateLayout = "2006-01-02"
+
+type Handler struct {
+	store      types.TemplateStore
+	taskStore  types.TasksStore
+	groupStore types.GroupStore
+	userStore  types.UserStore
+}
+
+func NewHandler(store types.TemplateStore, taskStore types.TasksStore, groupStore types.GroupStore, userStore types.UserStore) *Handler {
+	return &Handler{store: store, taskStore: taskStore, groupStore: groupStore, userStore: userStore}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/templates", auth.WithJWTAuth(h.handleGetTemplates, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/templates/group/{groupID}", auth.WithJWTAuth(h.handleGetGroupTemplates, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/templates/from-task/{taskID}", auth.WithJWTAuth(h.handleSaveTemplate, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/templates/{templateID}", auth.WithJWTAuth(h.handleGetTemplate, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/templates/{templateID}", auth.WithJWTAuth(h.handleUpdateTemplate, h.userStore)).Methods(http.MethodPut)
+	router.HandleFunc("/templates/{templateID}", auth.WithJWTAuth(h.handleDeleteTemplate, h.userStore)).Methods(http.MethodDelete)
+	router.HandleFunc("/tasks/from-template/{templateID}", auth.WithJWTAuth(h.handleUseTemplate, h.userStore)).Methods(http.MethodPost)
+}
+
+func (h *Handler) handleGetTemplates(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	templates, err := h.store.GetTemplates(userID, true)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, templates)
+}
+
+func (h *Handler) handleGetGroupTemplates(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	vars := mux.Vars(r)
+	str, ok := vars["groupID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing group ID"))
+		return
+	}
+
+	groupID, err := strconv.Atoi(str)
+	if err != nil || groupID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid group ID"))
+		return
+	}
+
+	_, err = h.groupStore.GetUserRole(groupID, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you are not a member of this group"))
+		return
+	}
+
+	templates, err := h.store.GetTemplates(groupID, false)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, templates)
+}
+
+// handleSaveTemplate stores a task and its subtasks as a template. Group
+// tasks become templates of their group, which owners and editors may save.
+// Dates are kept relative to the task's start, or its end when it has none.
+func (h *Handler) handleSaveTemplate(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	vars := mux.Vars(r)
+	str, ok := vars["taskID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing task ID"))
+		return
+	}
+
+	taskID, err := strconv.Atoi(str)
+	if err != nil || taskID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid task ID"))
+		return
+	}
+
+	var save types.SaveTemplate
+	if err := utils.ParseJSON(r, &save); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if save.Name == "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("template name is required"))
+		return
+	}
+
+	allowed, err := h.taskStore.CanAccessTask(taskID, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !allowed {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you have no access to this task"))
+		return
+	}
+
+	task, err := h.taskStore.GetTaskByID(taskID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	scopeID, flag := userID, true
+	if task.Group_id != 0 {
+		if !h.canManageGroup(task.Group_id, userID) {
+			utils.WriteError(w, http.StatusForbidden, fmt.Errorf("only group owners and editors can add templates"))
+			return
+		}
+		scopeID, flag = task.Group_id, false
+	}
+
+	_, err = h.store.GetTemplate(scopeID, save.Name, flag)
+	if err == nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("template: %s already exists", save.Name))
+		return
+	}
+
+	anchor := task.StartTime
+	if anchor.IsZero() {
+		anchor = task.EndTime
+	}
+	tt, err := h.templateTask(*task, anchor)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	err = h.store.CreateTemplate(scopeID, types.CreateTemplate{Name: save.Name, Task: tt}, flag)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusCreated, "Template created")
+}
+
+func (h *Handler) handleGetTemplate(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	t, ok := h.templateFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, t)
+}
+
+func (h *Handler) handleUpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	current, ok := h.templateFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	if !h.canManage(current, userID) {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you can not change this template"))
+		return
+	}
+
+	var update types.CreateTemplate
+	if err := utils.ParseJSON(r, &update); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if update.Name == "" || update.Task.Name == "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("template name and task name are required"))
+		return
+	}
+
+	scopeID, flag := scopeOf(current)
+	t, err := h.store.GetTemplate(scopeID, update.Name, flag)
+	if err == nil && t.ID != current.ID {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("template: %s already exists", update.Name))
+		return
+	}
+
+	err = h.store.UpdateTemplate(current.ID, update)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, "Template updated")
+}
+
+func (h *Handler) handleDeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	current, ok := h.templateFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	if !h.canManage(current, userID) {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you can not delete this template"))
+		return
+	}
+
+	err := h.store.DeleteTemplate(current.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, "Template deleted")
+}
+
+// handleUseTemplate creates a task tree from a template. {{date}} expands to
+// the start date unless the request sets it; any other variable without a
+// value fails the request before anything is created.
+func (h *Handler) handleUseTemplate(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	tpl, ok := h.templateFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	var use types.UseTemplate
+	if err := utils.ParseJSON(r, &use); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	start := use.StartTime
+	if start.IsZero() {
+		start = time.Now().UTC()
+	}
+
+	vars := map[string]string{"date": start.Format(dateLayout)}
+	for k, v := range use.Variables {
+		vars[k] = v
+	}
+
+	missing := make(map[string]bool)
+	root := instantiate(tpl.Task, start, vars, missing)
+	if len(missing) > 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing template variables: %s", missingList(missing)))
+		return
+	}
+
+	if tpl.GroupID == 0 {
+		_, err := h.taskStore.GetTaskByName(root.Name, userID, true)
+		if err == nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("Task: %s already exists in your list tasks", root.Name))
+			return
+		}
+		root.Responsible = []types.ResponsibleUserID{{ID: int64(userID)}}
+	} else {
+		_, err := h.taskStore.GetTaskByName(root.Name, tpl.GroupID, false)
+		if err == nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("Task: %s already exists in this group", root.Name))
+			return
+		}
+		if len(use.Responsible) == 0 {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("Group task: %s must have responsible user", root.Name))
+			return
+		}
+		root.Responsible = use.Responsible
+		root.Group_id = tpl.GroupID
+	}
+
+	taskID, err := h.taskStore.CreateTaskTree(root)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status":  "Task created",
+		"task_id": taskID,
+	})
+}
+
+// instantiate turns a template tree into tasks starting at start.
+func instantiate(tt types.TemplateTask, start time.Time, vars map[string]string, missing map[string]bool) types.CreateTask {
+	t := types.CreateTask{
+		Name:        expand(tt.Name, vars, missing),
+		Description: expand(tt.Description, vars, missing),
+		Priority_id: tt.Priority_id,
+		Status_id:   tt.Status_id,
+		Category_id: tt.Category_id,
+		Attachments: tt.Attachments,
+		Estimate:    tt.Estimate,
+		StartTime:   atOffset(start, tt.StartOffsetDays),
+		EndTime:     atOffset(start, tt.DueOffsetDays),
+	}
+	for _, sub := range tt.Subtasks {
+		t.Subtasks = append(t.Subtasks, instantiate(sub, start, vars, missing))
+	}
+	return t
+}
+
+// templateTask copies the task and its subtasks, dates relative to anchor.
+func (h *Handler) templateTask(t types.Task, anchor time.Time) (types.TemplateTask, error) {
+	tt := types.TemplateTask{
+		Name:            t.Name,
+		Description:     t.Description,
+		Priority_id:     t.Priority_id,
+		Status_id:       t.Status_id,
+		Category_id:     t.Category_id,
+		Attachments:     t.Attachments,
+		Estimate:        t.Estimate,
+		StartOffsetDays: offsetDays(t.StartTime, anchor),
+		DueOffsetDays:   offsetDays(t.EndTime, anchor),
+	}
+
+	subtasks, err := h.taskStore.GetSubTasks(t.ID, types.TaskFilter{})
+	if err != nil {
+		return tt, err
+	}
+	for _, sub := range subtasks {
+		st, err := h.templateTask(sub, anchor)
+		if err != nil {
+			return tt, err
+		}
+		tt.Subtasks = append(tt.Subtasks, st)
+	}
+
+	return tt, nil
+}
+
+// templateFromRequest loads the template from the route; users see their own
+// templates and those of their groups.
+func (h *Handler) templateFromRequest(w http.ResponseWriter, r *http.Request, userID int) (*types.Template, bool) {
+	vars := mux.Vars(r)
+	str, ok := vars["templateID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing template ID"))
+		return nil, false
+	}
+
+	templateID, err := strconv.Atoi(str)
+	if err != nil || templateID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid template ID"))
+		return nil, false
+	}
+
+	t, err := h.store.GetTemplateByID(templateID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return nil, false
+	}
+
+	if t.GroupID != 0 {
+		if _, err := h.groupStore.GetUserRole(t.GroupID, userID); err != nil {
+			utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you have no access to this template"))
+			return nil, false
+		}
+	} else if t.UserID != userID {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you have no access to this template"))
+		return nil, false
+	}
+
+	return t, true
+}
+
+// canManage reports whether the user may change the template: their own
+// templates, or those of a group where they are owner or editor.
+func (h *Handler) canManage(t *types.Template, userID int) bool {
+	if t.GroupID != 0 {
+		return h.canManageGroup(t.GroupID, userID)
+	}
+	return t.UserID == userID
+}
+
+func (h *Handler) canManageGroup(groupID, userID int) bool {
+	role, err := h.groupStore.GetUserRole(groupID, userID)
+	return err == nil && (role == "owner" || role == "editor")
+}
+
+// scopeOf returns the ID and flag of the scope the template lives in.
+func scopeOf(t *types.Template) (int, bool) {
+	if t.GroupID != 0 {
+		return t.GroupID, false
+	}
+	return t.UserID, true
+}
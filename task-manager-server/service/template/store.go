@@ -0,0 +1,143 @@
+package template
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/SibHelly/task-manager-server/types"
+)
+
+const templateSelect = `SELECT tt.template_id, tt.template_name, COALESCE(tt.user_id, 0), COALESCE(tt.group_id, 0),
+	tt.task, tt.created_at
+	FROM task_templates tt`
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// scopeColumn returns the column holding the owner: the user when flag is
+// set, the group otherwise.
+func scopeColumn(flag bool) string {
+	if flag {
+		return "tt.user_id"
+	}
+	return "tt.group_id"
+}
+
+func (s *Store) GetTemplates(ID int, flag bool) ([]types.Template, error) {
+	rows, err := s.db.Query(templateSelect+" WHERE "+scopeColumn(flag)+" = ? ORDER BY tt.template_name", ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := make([]types.Template, 0)
+	for rows.Next() {
+		t, err := scanRowsIntoTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		templates = append(templates, *t)
+	}
+
+	return templates, rows.Err()
+}
+
+func (s *Store) GetTemplate(ID int, name string, flag bool) (*types.Template, error) {
+	rows, err := s.db.Query(templateSelect+" WHERE "+scopeColumn(flag)+" = ? AND tt.template_name = ?", ID, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	t := new(types.Template)
+	for rows.Next() {
+		t, err = scanRowsIntoTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if t.ID == 0 {
+		return nil, fmt.Errorf("template not found")
+	}
+	return t, nil
+}
+
+func (s *Store) GetTemplateByID(templateID int) (*types.Template, error) {
+	rows, err := s.db.Query(templateSelect+" WHERE tt.template_id = ?", templateID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	t := new(types.Template)
+	for rows.Next() {
+		t, err = scanRowsIntoTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if t.ID == 0 {
+		return nil, fmt.Errorf("template not found")
+	}
+	return t, nil
+}
+
+func (s *Store) CreateTemplate(ID int, t types.CreateTemplate, flag bool) error {
+	task, err := json.Marshal(t.Task)
+	if err != nil {
+		return err
+	}
+
+	query := "INSERT INTO task_templates (template_name, task, group_id) VALUES (?, ?, ?)"
+	if flag {
+		query = "INSERT INTO task_templates (template_name, task, user_id) VALUES (?, ?, ?)"
+	}
+
+	_, err = s.db.Exec(query, t.Name, task, ID)
+	return err
+}
+
+func (s *Store) UpdateTemplate(templateID int, t types.CreateTemplate) error {
+	task, err := json.Marshal(t.Task)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec("UPDATE task_templates SET template_name = ?, task = ? WHERE template_id = ?", t.Name, task, templateID)
+	return err
+}
+
+func (s *Store) DeleteTemplate(templateID int) error {
+	_, err := s.db.Exec("DELETE FROM task_templates WHERE template_id = ?", templateID)
+	return err
+}
+
+func scanRowsIntoTemplate(rows *sql.Rows) (*types.Template, error) {
+	t := new(types.Template)
+	var task []byte
+
+	err := rows.Scan(
+		&t.ID,
+		&t.Name,
+		&t.UserID,
+		&t.GroupID,
+		&task,
+		&t.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(task, &t.Task); err != nil {
+		return nil, fmt.Errorf("template %d is broken: %w", t.ID, err)
+	}
+
+	return t, nil
+}
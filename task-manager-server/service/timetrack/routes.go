@@ -0,0 +1,377 @@
+package timetrack
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SibHelly/task-manager-server/service/auth"
+	"github.com/SibHelly/task-manager-server/types"
+	"github.com/SibHelly/task-manager-server/utils"
+	"github.com/gorilla/mux"
+)
+
+const dateLayout = "2006-01-02"
+
+type Handler struct {
+	store      types.TimeEntryStore
+	taskStore  types.TasksStore
+	groupStore types.GroupStore
+	userStore  types.UserStore
+}
+
+func NewHandler(store types.TimeEntryStore, taskStore types.TasksStore, groupStore types.GroupStore, userStore types.UserStore) *Handler {
+	return &Handler{
+		store:      store,
+		taskStore:  taskStore,
+		groupStore: groupStore,
+		userStore:  userStore,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	// timer
+	router.HandleFunc("/time/start/{taskID}", auth.WithJWTAuth(h.handleStartTimer, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/time/stop", auth.WithJWTAuth(h.handleStopTimer, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/time/running", auth.WithJWTAuth(h.handleGetRunningTimer, h.userStore)).Methods(http.MethodGet)
+
+	// entries
+	router.HandleFunc("/time/task/{taskID}", auth.WithJWTAuth(h.handleGetTaskEntries, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/time/task/{taskID}", auth.WithJWTAuth(h.handleCreateEntry, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/time/report", auth.WithJWTAuth(h.handleGetReport, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/time/{entryID}", auth.WithJWTAuth(h.handleUpdateEntry, h.userStore)).Methods(http.MethodPut)
+	router.HandleFunc("/time/{entryID}", auth.WithJWTAuth(h.handleDeleteEntry, h.userStore)).Methods(http.MethodDelete)
+}
+
+func (h *Handler) handleStartTimer(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	taskID, ok := h.taskFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	e, err := h.store.StartTimer(userID, taskID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Timer started",
+		"entry":  e,
+	})
+}
+
+func (h *Handler) handleStopTimer(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	e, err := h.store.StopTimer(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Timer stopped",
+		"entry":  e,
+	})
+}
+
+func (h *Handler) handleGetRunningTimer(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	e, err := h.store.GetRunningTimer(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Get running timer",
+		"entry":  e,
+	})
+}
+
+func (h *Handler) handleGetTaskEntries(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	taskID, ok := h.taskFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	es, err := h.store.GetTaskEntries(taskID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	totals, err := h.store.GetTaskTotals(taskID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status":  "Get time entries",
+		"entries": es,
+		"totals":  totals,
+	})
+}
+
+func (h *Handler) handleCreateEntry(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	taskID, ok := h.taskFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	var create types.CreateTimeEntry
+	if err := utils.ParseJSON(r, &create); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if create.StartedAt.IsZero() || !create.EndedAt.After(create.StartedAt) {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("ended_at must be after started_at"))
+		return
+	}
+
+	e, err := h.store.CreateEntry(types.CreateTimeEntry{
+		TaskID:    taskID,
+		UserID:    userID,
+		StartedAt: create.StartedAt,
+		EndedAt:   create.EndedAt,
+		Note:      create.Note,
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusCreated, map[string]interface{}{
+		"Status": "Time entry created",
+		"entry":  e,
+	})
+}
+
+func (h *Handler) handleUpdateEntry(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	e, ok := h.ownEntryFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	var update types.CreateTimeEntry
+	if err := utils.ParseJSON(r, &update); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if update.StartedAt.IsZero() {
+		update.StartedAt = e.StartedAt
+	}
+	if e.EndedAt != nil && update.EndedAt.IsZero() {
+		update.EndedAt = *e.EndedAt
+	}
+	if !update.EndedAt.IsZero() && !update.EndedAt.After(update.StartedAt) {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("ended_at must be after started_at"))
+		return
+	}
+
+	err := h.store.UpdateEntry(e.ID, update)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Time entry updated",
+	})
+}
+
+func (h *Handler) handleDeleteEntry(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	e, ok := h.ownEntryFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	err := h.store.DeleteEntry(e.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status":   "Time entry deleted",
+		"entry_id": e.ID,
+	})
+}
+
+// handleGetReport lists time entries over a date range. Without a group only
+// the caller's own entries are reported; with a group the caller must be a
+// member and may filter by any member. Add ?format=csv for a CSV download.
+func (h *Handler) handleGetReport(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	q := r.URL.Query()
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	f := types.TimeReportFilter{
+		From: today.AddDate(0, 0, -30),
+		To:   today,
+	}
+
+	if str := q.Get("from"); str != "" {
+		t, err := time.Parse(dateLayout, str)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid from date: %s", str))
+			return
+		}
+		f.From = t
+	}
+	if str := q.Get("to"); str != "" {
+		t, err := time.Parse(dateLayout, str)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid to date: %s", str))
+			return
+		}
+		f.To = t
+	}
+	if f.To.Before(f.From) {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("to date is before from date"))
+		return
+	}
+	f.To = f.To.AddDate(0, 0, 1)
+
+	for key, dst := range map[string]*int{"group_id": &f.GroupID, "user_id": &f.UserID, "category_id": &f.CategoryID} {
+		str := q.Get(key)
+		if str == "" {
+			continue
+		}
+		id, err := strconv.Atoi(str)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid %s", key))
+			return
+		}
+		*dst = id
+	}
+
+	if f.GroupID == 0 {
+		f.UserID = userID
+	} else if _, err := h.groupStore.GetUserRole(f.GroupID, userID); err != nil {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you are not a member of this group"))
+		return
+	}
+
+	report, err := h.store.GetReport(f)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if q.Get("format") == "csv" {
+		writeReportCSV(w, report)
+		return
+	}
+
+	var total int64
+	for _, row := range report {
+		total += row.Duration
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status":  "Get time report",
+		"from":    f.From.Format(dateLayout),
+		"to":      f.To.AddDate(0, 0, -1).Format(dateLayout),
+		"total":   total,
+		"entries": report,
+	})
+}
+
+func writeReportCSV(w http.ResponseWriter, report []types.TimeReportRow) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="time-report.csv"`)
+	w.WriteHeader(http.StatusOK)
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"entry_id", "user_id", "user_name", "task_id", "task_name", "group_id", "category_id", "started_at", "ended_at", "duration_seconds", "note"})
+	for _, row := range report {
+		endedAt := ""
+		if row.EndedAt != nil {
+			endedAt = row.EndedAt.Format(time.RFC3339)
+		}
+		cw.Write([]string{
+			strconv.Itoa(row.EntryID),
+			strconv.Itoa(row.UserID),
+			row.UserName,
+			strconv.Itoa(row.TaskID),
+			row.TaskName,
+			strconv.Itoa(row.GroupID),
+			strconv.Itoa(row.CategoryID),
+			row.StartedAt.Format(time.RFC3339),
+			endedAt,
+			strconv.FormatInt(row.Duration, 10),
+			row.Note,
+		})
+	}
+	cw.Flush()
+}
+
+// taskFromRequest reads the task ID from the route and checks the user can
+// see the task. It writes the error response itself.
+func (h *Handler) taskFromRequest(w http.ResponseWriter, r *http.Request, userID int) (int, bool) {
+	vars := mux.Vars(r)
+	str, ok := vars["taskID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing task ID"))
+		return 0, false
+	}
+
+	taskID, err := strconv.Atoi(str)
+	if err != nil || taskID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid task ID"))
+		return 0, false
+	}
+
+	ok, err = h.taskStore.CanAccessTask(taskID, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return 0, false
+	}
+	if !ok {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you have no access to this task"))
+		return 0, false
+	}
+
+	return taskID, true
+}
+
+// ownEntryFromRequest loads the entry from the route; users may only change
+// their own entries.
+func (h *Handler) ownEntryFromRequest(w http.ResponseWriter, r *http.Request, userID int) (*types.TimeEntry, bool) {
+	vars := mux.Vars(r)
+	str, ok := vars["entryID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing entry ID"))
+		return nil, false
+	}
+
+	entryID, err := strconv.Atoi(str)
+	if err != nil || entryID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid entry ID"))
+		return nil, false
+	}
+
+	e, err := h.store.GetEntry(entryID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return nil, false
+	}
+
+	if e.UserID != userID {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you can only change your own time entries"))
+		return nil, false
+	}
+
+	return e, true
+}
@@ -0,0 +1,277 @@
+package timetrack
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/SibHelly/task-manager-server/types"
+)
+
+// durationExpr is the length of an entry in seconds, running timers included.
+const durationExpr = "TIMESTAMPDIFF(SECOND, e.started_at, COALESCE(e.ended_at, UTC_TIMESTAMP()))"
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// StartTimer stops the user's running timer, if any, and starts a new one on
+// the task.
+func (s *Store) StartTimer(userID, taskID int) (*types.TimeEntry, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	_, err = tx.Exec("UPDATE time_entries SET ended_at = ? WHERE user_id = ? AND ended_at IS NULL", now, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := tx.Exec("INSERT INTO time_entries (task_id, user_id, started_at) VALUES (?, ?, ?)", taskID, userID, now)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &types.TimeEntry{ID: int(id), TaskID: taskID, UserID: userID, StartedAt: now}, nil
+}
+
+func (s *Store) StopTimer(userID int) (*types.TimeEntry, error) {
+	e, err := s.GetRunningTimer(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	_, err = s.db.Exec("UPDATE time_entries SET ended_at = ? WHERE entry_id = ?", now, e.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	e.EndedAt = &now
+	e.Duration = int64(now.Sub(e.StartedAt).Seconds())
+	return e, nil
+}
+
+func (s *Store) GetRunningTimer(userID int) (*types.TimeEntry, error) {
+	query := `SELECT e.entry_id, e.task_id, e.user_id, e.started_at, e.ended_at, ` + durationExpr + `, e.note
+	FROM time_entries e WHERE e.user_id = ? AND e.ended_at IS NULL`
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	e := new(types.TimeEntry)
+	for rows.Next() {
+		e, err = scanRowsIntoEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if e.ID == 0 {
+		return nil, fmt.Errorf("no running timer")
+	}
+	return e, nil
+}
+
+func (s *Store) CreateEntry(c types.CreateTimeEntry) (*types.TimeEntry, error) {
+	res, err := s.db.Exec(
+		"INSERT INTO time_entries (task_id, user_id, started_at, ended_at, note) VALUES (?, ?, ?, ?, ?)",
+		c.TaskID, c.UserID, c.StartedAt.UTC(), c.EndedAt.UTC(), c.Note,
+	)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetEntry(int(id))
+}
+
+func (s *Store) GetEntry(entryID int) (*types.TimeEntry, error) {
+	query := `SELECT e.entry_id, e.task_id, e.user_id, e.started_at, e.ended_at, ` + durationExpr + `, e.note
+	FROM time_entries e WHERE e.entry_id = ?`
+	rows, err := s.db.Query(query, entryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	e := new(types.TimeEntry)
+	for rows.Next() {
+		e, err = scanRowsIntoEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if e.ID == 0 {
+		return nil, fmt.Errorf("time entry not found")
+	}
+	return e, nil
+}
+
+// UpdateEntry changes the times and note of an entry. A zero EndedAt keeps a
+// running timer running.
+func (s *Store) UpdateEntry(entryID int, c types.CreateTimeEntry) error {
+	var endedAt interface{}
+	if !c.EndedAt.IsZero() {
+		endedAt = c.EndedAt.UTC()
+	}
+
+	_, err := s.db.Exec(
+		"UPDATE time_entries SET started_at = ?, ended_at = ?, note = ? WHERE entry_id = ?",
+		c.StartedAt.UTC(), endedAt, c.Note, entryID,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) DeleteEntry(entryID int) error {
+	_, err := s.db.Exec("DELETE FROM time_entries WHERE entry_id = ?", entryID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) GetTaskEntries(taskID int) ([]types.TimeEntry, error) {
+	query := `SELECT e.entry_id, e.task_id, e.user_id, e.started_at, e.ended_at, ` + durationExpr + `, e.note
+	FROM time_entries e WHERE e.task_id = ?
+	ORDER BY e.started_at`
+	rows, err := s.db.Query(query, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]types.TimeEntry, 0)
+	for rows.Next() {
+		e, err := scanRowsIntoEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *e)
+	}
+
+	return entries, rows.Err()
+}
+
+// GetTaskTotals returns the time logged on the task itself and the time
+// rolled up from the whole subtask tree below it.
+func (s *Store) GetTaskTotals(taskID int) (*types.TimeTotals, error) {
+	query := `WITH RECURSIVE tree AS (
+		SELECT task_id FROM tasks WHERE task_id = ?
+		UNION ALL
+		SELECT t.task_id FROM tasks t JOIN tree ON t.parent_task_id = tree.task_id
+	)
+	SELECT
+		COALESCE(SUM(CASE WHEN e.task_id = ? THEN ` + durationExpr + ` END), 0),
+		COALESCE(SUM(` + durationExpr + `), 0)
+	FROM time_entries e
+	JOIN tree ON tree.task_id = e.task_id`
+
+	totals := &types.TimeTotals{TaskID: taskID}
+	err := s.db.QueryRow(query, taskID, taskID).Scan(&totals.Own, &totals.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	return totals, nil
+}
+
+// GetReport lists the entries started in [f.From, f.To). Zero IDs in the
+// filter are ignored.
+func (s *Store) GetReport(f types.TimeReportFilter) ([]types.TimeReportRow, error) {
+	query := `SELECT e.entry_id, e.user_id, u.name, t.task_id, t.task_name,
+		COALESCE(t.group_id, 0), COALESCE(t.category_id, 0),
+		e.started_at, e.ended_at, ` + durationExpr + `, e.note
+	FROM time_entries e
+	JOIN tasks t ON t.task_id = e.task_id
+	JOIN users u ON u.user_id = e.user_id
+	WHERE e.started_at >= ? AND e.started_at < ?`
+	args := []interface{}{f.From.UTC(), f.To.UTC()}
+
+	if f.GroupID != 0 {
+		query += " AND t.group_id = ?"
+		args = append(args, f.GroupID)
+	}
+	if f.UserID != 0 {
+		query += " AND e.user_id = ?"
+		args = append(args, f.UserID)
+	}
+	if f.CategoryID != 0 {
+		query += " AND t.category_id = ?"
+		args = append(args, f.CategoryID)
+	}
+	query += " ORDER BY e.started_at"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := make([]types.TimeReportRow, 0)
+	for rows.Next() {
+		var (
+			r       types.TimeReportRow
+			endedAt sql.NullTime
+			note    sql.NullString
+		)
+		err := rows.Scan(
+			&r.EntryID, &r.UserID, &r.UserName, &r.TaskID, &r.TaskName,
+			&r.GroupID, &r.CategoryID,
+			&r.StartedAt, &endedAt, &r.Duration, &note,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if endedAt.Valid {
+			r.EndedAt = &endedAt.Time
+		}
+		r.Note = note.String
+		report = append(report, r)
+	}
+
+	return report, rows.Err()
+}
+
+func scanRowsIntoEntry(rows *sql.Rows) (*types.TimeEntry, error) {
+	e := new(types.TimeEntry)
+
+	var (
+		endedAt sql.NullTime
+		note    sql.NullString
+	)
+
+	err := rows.Scan(&e.ID, &e.TaskID, &e.UserID, &e.StartedAt, &endedAt, &e.Duration, &note)
+	if err != nil {
+		return nil, err
+	}
+
+	if endedAt.Valid {
+		e.EndedAt = &endedAt.Time
+	}
+	e.Note = note.String
+
+	return e, nil
+}
@@ -0,0 +1,177 @@
+package user
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/SibHelly/task-manager-server/types"
+)
+
+// soleTasks selects the tasks the user is the only responsible for; the
+// placeholder is "NOT" for group tasks and empty for personal ones.
+const soleTasks = `SELECT t.task_id FROM tasks t
+	JOIN do_users du ON du.task_id = t.task_id
+	WHERE du.user_id = ? AND t.group_id IS %s NULL
+		AND NOT EXISTS (SELECT 1 FROM do_users o WHERE o.task_id = t.task_id AND o.user_id <> du.user_id)`
+
+// DeleteUser deletes the account. Before that, in the same transaction:
+// groups where the user is the only owner go to another member, an editor
+// first, or are deleted with their tasks when nobody else is in them; group
+// tasks the user was the only responsible for go to the group owner, and
+// such personal tasks are deleted with their subtasks. Comments the user
+// wrote stay, without a sender.
+func (s *Store) DeleteUser(userID int) (*types.AccountDeletion, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	d := &types.AccountDeletion{
+		TransferredGroups: make([]int, 0),
+		DeletedGroups:     make([]int, 0),
+		ReassignedTasks:   make([]int, 0),
+		DeletedTasks:      make([]int, 0),
+	}
+
+	owned, err := queryIDs(tx, `SELECT i.group_id FROM inclusions i
+	WHERE i.user_id = ? AND i.role = 'owner'
+		AND NOT EXISTS (SELECT 1 FROM inclusions o
+			WHERE o.group_id = i.group_id AND o.user_id <> i.user_id AND o.role = 'owner')`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, groupID := range owned {
+		var heir int
+		err := tx.QueryRow(`SELECT user_id FROM inclusions WHERE group_id = ? AND user_id <> ?
+		ORDER BY role = 'editor' DESC, inclusion_id LIMIT 1`, groupID, userID).Scan(&heir)
+		if err == sql.ErrNoRows {
+			tasks, err := queryIDs(tx, "SELECT task_id FROM tasks WHERE group_id = ?", groupID)
+			if err != nil {
+				return nil, err
+			}
+			deleted, err := deleteTaskTrees(tx, tasks)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := tx.Exec("DELETE FROM `groups` WHERE group_id = ?", groupID); err != nil {
+				return nil, err
+			}
+			d.DeletedTasks = append(d.DeletedTasks, deleted...)
+			d.DeletedGroups = append(d.DeletedGroups, groupID)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec("UPDATE inclusions SET role = 'owner' WHERE group_id = ? AND user_id = ?", groupID, heir)
+		if err != nil {
+			return nil, err
+		}
+		d.TransferredGroups = append(d.TransferredGroups, groupID)
+	}
+
+	groupTasks, err := queryIDs(tx, fmt.Sprintf(soleTasks, "NOT"), userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, taskID := range groupTasks {
+		res, err := tx.Exec(`INSERT IGNORE INTO do_users (user_id, task_id)
+		SELECT i.user_id, t.task_id FROM tasks t
+		JOIN inclusions i ON i.group_id = t.group_id
+		WHERE t.task_id = ? AND i.role = 'owner' AND i.user_id <> ?
+		ORDER BY i.inclusion_id LIMIT 1`, taskID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			d.ReassignedTasks = append(d.ReassignedTasks, taskID)
+		}
+	}
+
+	personal, err := queryIDs(tx, fmt.Sprintf(soleTasks, ""), userID)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := deleteTaskTrees(tx, personal)
+	if err != nil {
+		return nil, err
+	}
+	d.DeletedTasks = append(d.DeletedTasks, deleted...)
+
+	if _, err := tx.Exec("DELETE FROM users WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+
+	return d, tx.Commit()
+}
+
+// deleteTaskTrees deletes the tasks and all their subtasks, and returns the
+// IDs deleted.
+func deleteTaskTrees(tx *sql.Tx, roots []int) ([]int, error) {
+	if len(roots) == 0 {
+		return nil, nil
+	}
+
+	args := make([]interface{}, len(roots))
+	for i, id := range roots {
+		args[i] = id
+	}
+	ids, err := queryIDs(tx, `WITH RECURSIVE tree AS (
+		SELECT task_id FROM tasks WHERE task_id IN `+placeholders(len(roots))+`
+		UNION
+		SELECT t.task_id FROM tasks t JOIN tree ON t.parent_task_id = tree.task_id
+	)
+	SELECT task_id FROM tree`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	args = make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	in := placeholders(len(ids))
+
+	// comments do not cascade with their chat, and subtasks point at their
+	// parent, so both are cleared before the tasks go
+	queries := []string{
+		"DELETE FROM comments WHERE chat_id IN (SELECT chat_id FROM chats WHERE task_id IN " + in + ")",
+		"UPDATE tasks SET parent_task_id = NULL WHERE task_id IN " + in,
+		"DELETE FROM tasks WHERE task_id IN " + in,
+	}
+	for _, q := range queries {
+		if _, err := tx.Exec(q, args...); err != nil {
+			return nil, err
+		}
+	}
+
+	return ids, nil
+}
+
+func queryIDs(tx *sql.Tx, query string, args ...interface{}) ([]int, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int, 0)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// placeholders returns "(?, ?, ...)" with n markers.
+func placeholders(n int) string {
+	return "(" + strings.TrimSuffix(strings.Repeat("?, ", n), ", ") + ")"
+}
@@ -0,0 +1,188 @@
+package user
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SibHelly/task-manager-server/service/auth"
+	"github.com/SibHelly/task-manager-server/types"
+	"github.com/SibHelly/task-manager-server/utils"
+)
+
+// emailCodeTTL is how long the code sent to a new email works.
+const emailCodeTTL = time.Hour
+
+var errEmailTaken = fmt.Errorf("email is already in use")
+
+// handleSetEmail sends a code to the new email. The email only replaces the
+// old one once the code comes back to /me/email/verify.
+func (h *Handler) handleSetEmail(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	var payload types.SetEmailPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	email := normalizeEmail(payload.Email)
+	if !validEmail(email) {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid email"))
+		return
+	}
+
+	if !h.allow(w, h.login.emailPerUser, strconv.Itoa(userID)) {
+		return
+	}
+
+	u, err := h.store.GetUserById(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if u.Email == email {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("this is already your email"))
+		return
+	}
+	if _, err := h.store.GetUserByEmail(email); err == nil {
+		utils.WriteError(w, http.StatusBadRequest, errEmailTaken)
+		return
+	}
+
+	code, err := newResetCode()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = h.store.CreateEmailVerification(u.ID, email, hashCode(code), time.Now().UTC().Add(emailCodeTTL))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	err = h.mailer.Send(types.Message{
+		To:      email,
+		Subject: "Confirm your email",
+		Body: fmt.Sprintf("Your email confirmation code is %s. It works once, for %d minutes.",
+			code, int(emailCodeTTL/time.Minute)),
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Confirmation code sent",
+	})
+}
+
+func (h *Handler) handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	var payload types.VerifyEmailPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if !h.allow(w, h.login.emailCheckPerUser, strconv.Itoa(userID)) {
+		return
+	}
+
+	email, err := h.store.UseEmailVerification(userID, hashCode(strings.TrimSpace(payload.Code)), time.Now().UTC())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if email == "" {
+		utils.WriteError(w, http.StatusBadRequest, errBadResetCode)
+		return
+	}
+
+	// Someone else may have confirmed the same email in the meantime.
+	if other, err := h.store.GetUserByEmail(email); err == nil && other.ID != userID {
+		utils.WriteError(w, http.StatusBadRequest, errEmailTaken)
+		return
+	}
+	if err := h.store.SetEmail(userID, email); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	u, err := h.store.GetUserById(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Email confirmed",
+		"user":   u,
+	})
+}
+
+// handleDeleteEmail removes the email, unless it is the only way left to
+// log in.
+func (h *Handler) handleDeleteEmail(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	u, err := h.store.GetUserById(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if u.Phone == "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("add a phone before removing the email"))
+		return
+	}
+
+	if err := h.store.SetEmail(userID, ""); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Email removed",
+	})
+}
+
+// normalizeEmail is the form emails are stored and looked up in.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// validEmail accepts a bare address, like "a@example.com", that fits
+// users.email.
+func validEmail(email string) bool {
+	if email == "" || len(email) > maxEmailLen {
+		return false
+	}
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email && addr.Name == ""
+}
+
+// hideContacts blanks the contacts the user does not show to others.
+func hideContacts(u *types.User) {
+	switch u.ContactVisibility {
+	case types.ContactBoth:
+	case types.ContactEmail:
+		u.Phone = ""
+	case types.ContactNone:
+		u.Phone, u.Email = "", ""
+	default:
+		u.Email = ""
+	}
+}
+
+// loginKey names the user in the login lockout when the login itself is
+// not known: the phone, else the email.
+func loginKey(u *types.User) string {
+	switch {
+	case u.Phone != "":
+		return u.Phone
+	case u.Email != "":
+		return u.Email
+	}
+	return "user:" + strconv.Itoa(u.ID)
+}
@@ -0,0 +1,65 @@
+package user
+
+import (
+	"database/sql"
+	"time"
+)
+
+// SetEmail sets the verified email of the user; an empty one removes it.
+func (s *Store) SetEmail(userID int, email string) error {
+	_, err := s.db.Exec("UPDATE users SET email = ? WHERE user_id = ?", nullIfEmpty(email), userID)
+	return err
+}
+
+// CreateEmailVerification stores the code sent to a new email. Any older
+// unused codes of the user stop working.
+func (s *Store) CreateEmailVerification(userID int, email, codeHash string, expiresAt time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	_, err = tx.Exec("UPDATE email_verifications SET used_at = ? WHERE user_id = ? AND used_at IS NULL", now, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO email_verifications (user_id, email, code_hash, expires_at, created_at)
+	VALUES (?, ?, ?, ?, ?)`, userID, email, codeHash, expiresAt, now)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseEmailVerification marks the code used and returns the email it was
+// sent to, or "" when the code is not the user's, used or expired.
+func (s *Store) UseEmailVerification(userID int, codeHash string, now time.Time) (string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var id int
+	var email string
+	err = tx.QueryRow(`SELECT verification_id, email FROM email_verifications
+	WHERE user_id = ? AND code_hash = ? AND used_at IS NULL AND expires_at > ? FOR UPDATE`,
+		userID, codeHash, now).Scan(&id, &email)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec("UPDATE email_verifications SET used_at = ? WHERE verification_id = ?", now, id)
+	if err != nil {
+		return "", err
+	}
+
+	return email, tx.Commit()
+}
@@ -0,0 +1,152 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/SibHelly/task-manager-server/service/auth"
+	"github.com/SibHelly/task-manager-server/types"
+)
+
+type mailbox struct {
+	sent []types.Message
+}
+
+func (m *mailbox) Send(msg types.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestEmailLogin(t *testing.T) {
+	hash, err := auth.HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	userStore := &mockUserStore{users: []types.User{
+		{ID: 1, Name: "alice", Phone: "79990000001", Password: hash},
+		{ID: 2, Name: "bob", Phone: "79990000002", Email: "bob@example.com", Password: hash},
+	}}
+	mail := &mailbox{}
+	handler := NewHandler(userStore, nil, nil, mail, nil)
+
+	call := func(h http.HandlerFunc, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 1))
+		rr := httptest.NewRecorder()
+		h(rr, req)
+		return rr
+	}
+
+	t.Run("should refuse an email another user has", func(t *testing.T) {
+		if rr := call(handler.handleSetEmail, `{"email": "Bob@Example.com"}`); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+		if rr := call(handler.handleSetEmail, `{"email": "Alice <alice@example.com>"}`); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should set the email once the code comes back", func(t *testing.T) {
+		if rr := call(handler.handleSetEmail, `{"email": " Alice@Example.com "}`); rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+		}
+		if len(mail.sent) != 1 || mail.sent[0].To != "alice@example.com" {
+			t.Fatalf("unexpected mail %+v", mail.sent)
+		}
+		if userStore.users[0].Email != "" {
+			t.Error("email should wait for the code")
+		}
+
+		if rr := call(handler.handleVerifyEmail, `{"code": "00000000"}`); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+
+		code := regexp.MustCompile(`[0-9]{8}`).FindString(mail.sent[0].Body)
+		if rr := call(handler.handleVerifyEmail, `{"code": "`+code+`"}`); rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+		}
+		if userStore.users[0].Email != "alice@example.com" {
+			t.Errorf("email = %q", userStore.users[0].Email)
+		}
+	})
+
+	login := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.handleLogin(rr, httptest.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(body)))
+		return rr
+	}
+
+	t.Run("should log in by email or phone", func(t *testing.T) {
+		for _, body := range []string{
+			`{"email": "ALICE@example.com", "password": "correct horse"}`,
+			`{"phone": "79990000001", "password": "correct horse"}`,
+		} {
+			if rr := login(body); rr.Code != http.StatusOK {
+				t.Errorf("%s: expected status code %d, got %d: %s", body, http.StatusOK, rr.Code, rr.Body)
+			}
+		}
+	})
+
+	t.Run("should want exactly one of phone and email", func(t *testing.T) {
+		for _, body := range []string{
+			`{"password": "correct horse"}`,
+			`{"phone": "79990000001", "email": "alice@example.com", "password": "correct horse"}`,
+		} {
+			if rr := login(body); rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status code %d, got %d", body, http.StatusBadRequest, rr.Code)
+			}
+		}
+	})
+}
+
+func TestHideContacts(t *testing.T) {
+	for _, c := range []struct {
+		visibility   string
+		phone, email string
+	}{
+		{types.ContactPhone, "79990000001", ""},
+		{types.ContactEmail, "", "a@example.com"},
+		{types.ContactBoth, "79990000001", "a@example.com"},
+		{types.ContactNone, "", ""},
+	} {
+		u := types.User{Phone: "79990000001", Email: "a@example.com", ContactVisibility: c.visibility}
+		hideContacts(&u)
+		if u.Phone != c.phone || u.Email != c.email {
+			t.Errorf("%s: phone %q, email %q", c.visibility, u.Phone, u.Email)
+		}
+	}
+}
+
+func TestGetUserHidesContacts(t *testing.T) {
+	userStore := &mockUserStore{users: []types.User{
+		{ID: 1, Name: "alice", Phone: "79990000001", Email: "alice@example.com", ContactVisibility: types.ContactEmail},
+	}}
+	handler := NewHandler(userStore, nil, nil, nil, nil)
+
+	get := func(callerID int) types.User {
+		req := httptest.NewRequest(http.MethodPost, "/user", bytes.NewBufferString(`{"user_id": 1}`))
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, callerID))
+		rr := httptest.NewRecorder()
+		handler.handleGetUser(rr, req)
+
+		var out struct {
+			User types.User `json:"user"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		return out.User
+	}
+
+	if u := get(2); u.Phone != "" || u.Email != "alice@example.com" {
+		t.Errorf("others see phone %q, email %q", u.Phone, u.Email)
+	}
+	if u := get(1); u.Phone != "79990000001" {
+		t.Errorf("own phone shows as %q", u.Phone)
+	}
+}
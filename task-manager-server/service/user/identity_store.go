@@ -0,0 +1,63 @@
+package user
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SibHelly/task-manager-server/types"
+)
+
+// GetUserByIdentity returns the user an OIDC identity is linked to.
+func (s *Store) GetUserByIdentity(issuer, subject string) (*types.User, error) {
+	rows, err := s.db.Query(userSelect+` WHERE user_id =
+	(SELECT user_id FROM user_identities WHERE issuer = ? AND subject = ?)`, issuer, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	u := new(types.User)
+	for rows.Next() {
+		u, err = scanRowIntoUser(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if u.ID == 0 {
+		return nil, fmt.Errorf("user not found")
+	}
+	return u, nil
+}
+
+func (s *Store) LinkIdentity(userID int, issuer, subject string) error {
+	_, err := s.db.Exec("INSERT INTO user_identities (user_id, issuer, subject, created_at) VALUES (?, ?, ?, ?)",
+		userID, issuer, subject, time.Now().UTC())
+	return err
+}
+
+// CreateOIDCUser creates a user that signed up with an OIDC provider and
+// links the identity to it.
+func (s *Store) CreateOIDCUser(u types.User, issuer, subject string) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO users (name, info, phone, email, password) VALUES (?, ?, ?, ?, ?)",
+		u.Name, u.Info, nullIfEmpty(u.Phone), nullIfEmpty(u.Email), u.Password)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("INSERT INTO user_identities (user_id, issuer, subject, created_at) VALUES (?, ?, ?, ?)",
+		id, issuer, subject, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), tx.Commit()
+}
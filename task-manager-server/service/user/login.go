@@ -0,0 +1,267 @@
+package user
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SibHelly/task-manager-server/config"
+	"github.com/SibHelly/task-manager-server/service/auth"
+	"github.com/SibHelly/task-manager-server/service/ratelimit"
+	"github.com/SibHelly/task-manager-server/types"
+	"github.com/SibHelly/task-manager-server/utils"
+)
+
+// Login limits: attempts per IP and per phone or email in loginWindow, and
+// how long a login stays locked out after config.Envs.LoginMaxFailures
+// failures.
+const (
+	loginsPerIP        = 30
+	loginsPerLogin     = 10
+	loginWindow        = 15 * time.Minute
+	loginFailureWindow = 24 * time.Hour
+	loginBaseLock      = time.Minute
+	loginMaxLock       = time.Hour
+	forgotsPerIP       = 10
+	forgotsPerPhone    = 3
+	resetsPerPhone     = 5
+	resetWindow        = time.Hour
+	codesPerUser       = 10
+	oidcPerIP          = 30
+	emailsPerUser      = 3
+	emailChecksPerUser = 5
+)
+
+// errBadLogin is the only answer to a failed login, so it does not tell
+// whether the phone or email is registered.
+var errBadLogin = fmt.Errorf("invalid login or password")
+
+var errLockedOut = fmt.Errorf("too many failed attempts, try again later")
+
+// loginGuard holds the limits checked before every login, password reset
+// and email confirmation.
+type loginGuard struct {
+	perIP             *ratelimit.Limiter
+	perLogin          *ratelimit.Limiter
+	lockout           *ratelimit.Lockout
+	forgotPerIP       *ratelimit.Limiter
+	forgotPerPhone    *ratelimit.Limiter
+	resetPerPhone     *ratelimit.Limiter
+	codePerUser       *ratelimit.Limiter
+	oidcPerIP         *ratelimit.Limiter
+	emailPerUser      *ratelimit.Limiter
+	emailCheckPerUser *ratelimit.Limiter
+}
+
+func newLoginGuard(store types.RateLimitStore) *loginGuard {
+	return &loginGuard{
+		perIP:    ratelimit.NewLimiter(store, "login:ip:", loginsPerIP, loginWindow),
+		perLogin: ratelimit.NewLimiter(store, "login:id:", loginsPerLogin, loginWindow),
+		lockout: ratelimit.NewLockout(store, "login:", int(config.Envs.LoginMaxFailures),
+			loginFailureWindow, loginBaseLock, loginMaxLock),
+		forgotPerIP:       ratelimit.NewLimiter(store, "forgot:ip:", forgotsPerIP, resetWindow),
+		forgotPerPhone:    ratelimit.NewLimiter(store, "forgot:phone:", forgotsPerPhone, resetWindow),
+		resetPerPhone:     ratelimit.NewLimiter(store, "reset:phone:", resetsPerPhone, resetWindow),
+		codePerUser:       ratelimit.NewLimiter(store, "2fa:user:", codesPerUser, loginWindow),
+		oidcPerIP:         ratelimit.NewLimiter(store, "oidc:ip:", oidcPerIP, loginWindow),
+		emailPerUser:      ratelimit.NewLimiter(store, "email:user:", emailsPerUser, resetWindow),
+		emailCheckPerUser: ratelimit.NewLimiter(store, "email-check:user:", emailChecksPerUser, resetWindow),
+	}
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// checkDummyPassword spends as long as a real password check, so unknown
+// logins can not be told apart by timing.
+func checkDummyPassword(plain string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = auth.HashPassword("not a real password")
+	})
+	auth.ComparePasswords(dummyHash, []byte(plain))
+}
+
+func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var payload types.LoginUserPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	login, lookup := payload.Phone, h.store.GetUserByPhone
+	if payload.Email != "" {
+		login, lookup = normalizeEmail(payload.Email), h.store.GetUserByEmail
+	}
+	if login == "" || (payload.Phone != "" && payload.Email != "") {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("log in with either a phone or an email"))
+		return
+	}
+
+	attempt := types.LoginAttempt{Login: login, IP: ratelimit.ClientIP(r)}
+
+	for _, check := range []struct {
+		limiter *ratelimit.Limiter
+		key     string
+	}{{h.login.perIP, attempt.IP}, {h.login.perLogin, login}} {
+		res, err := check.limiter.Allow(check.key)
+		if err != nil {
+			log.Printf("login rate limit: %v", err)
+			continue
+		}
+		if !res.Allowed {
+			h.audit(attempt, types.LoginRateLimited)
+			ratelimit.TooManyRequests(w, res.RetryAfter, fmt.Errorf("too many login attempts, try again later"))
+			return
+		}
+	}
+
+	locked, err := h.login.lockout.Locked(login)
+	if err != nil {
+		log.Printf("login lockout: %v", err)
+	}
+	if locked > 0 {
+		h.audit(attempt, types.LoginLocked)
+		ratelimit.TooManyRequests(w, locked, errLockedOut)
+		return
+	}
+
+	u, err := lookup(login)
+	if err != nil {
+		checkDummyPassword(payload.Password)
+		h.failLogin(w, attempt, types.LoginUnknownUser)
+		return
+	}
+
+	attempt.UserID = u.ID
+	if !auth.ComparePasswords(u.Password, []byte(payload.Password)) {
+		h.failLogin(w, attempt, types.LoginBadPassword)
+		return
+	}
+
+	h.completeLogin(w, r, attempt, u)
+}
+
+// completeLogin follows a checked first factor: users with 2FA get a
+// challenge token for /login/2fa, the others are logged in.
+func (h *Handler) completeLogin(w http.ResponseWriter, r *http.Request, attempt types.LoginAttempt, u *types.User) {
+	if u.TOTPEnabled {
+		challenge, err := auth.CreateChallengeJWT([]byte(config.Envs.JWTSecret), u.ID, u.TokenVersion)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+		})
+		return
+	}
+
+	h.finishLogin(w, r, attempt, u)
+}
+
+// handleLoginTwoFactor takes the second factor of a login that answered
+// with a challenge token, and hands out the session token.
+func (h *Handler) handleLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var payload types.TwoFactorLoginPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	userID, version, err := auth.ParseChallengeJWT(payload.ChallengeToken)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	u, err := h.store.GetUserById(userID)
+	if err != nil || u.TokenVersion != version || !u.TOTPEnabled {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid challenge token"))
+		return
+	}
+
+	attempt := types.LoginAttempt{Login: loginKey(u), UserID: u.ID, IP: ratelimit.ClientIP(r)}
+	if !h.allow(w, h.login.codePerUser, strconv.Itoa(u.ID)) {
+		h.audit(attempt, types.LoginRateLimited)
+		return
+	}
+
+	locked, err := h.login.lockout.Locked(attempt.Login)
+	if err != nil {
+		log.Printf("login lockout: %v", err)
+	}
+	if locked > 0 {
+		h.audit(attempt, types.LoginLocked)
+		ratelimit.TooManyRequests(w, locked, errLockedOut)
+		return
+	}
+
+	ok, err := h.checkSecondFactor(u, payload.Code)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		h.audit(attempt, types.LoginBadCode)
+		if locked, err := h.login.lockout.Fail(attempt.Login); err != nil {
+			log.Printf("login lockout: %v", err)
+		} else if locked > 0 {
+			ratelimit.TooManyRequests(w, locked, errLockedOut)
+			return
+		}
+		utils.WriteError(w, http.StatusBadRequest, errBadCode)
+		return
+	}
+
+	h.finishLogin(w, r, attempt, u)
+}
+
+// finishLogin clears the failures of the login, records it and hands out
+// the session token.
+func (h *Handler) finishLogin(w http.ResponseWriter, r *http.Request, attempt types.LoginAttempt, u *types.User) {
+	if err := h.login.lockout.Succeed(attempt.Login); err != nil {
+		log.Printf("login lockout: %v", err)
+	}
+	attempt.Success = true
+	h.audit(attempt, "")
+
+	token, err := h.startSession(r, u.ID, u.TokenVersion)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]string{"token": token})
+}
+
+// failLogin counts the failure towards a lockout and answers with the same
+// error whatever went wrong.
+func (h *Handler) failLogin(w http.ResponseWriter, attempt types.LoginAttempt, reason string) {
+	h.audit(attempt, reason)
+
+	locked, err := h.login.lockout.Fail(attempt.Login)
+	if err != nil {
+		log.Printf("login lockout: %v", err)
+	}
+	if locked > 0 {
+		ratelimit.TooManyRequests(w, locked, errLockedOut)
+		return
+	}
+
+	utils.WriteError(w, http.StatusBadRequest, errBadLogin)
+}
+
+func (h *Handler) audit(attempt types.LoginAttempt, reason string) {
+	attempt.Reason = reason
+	attempt.At = time.Now().UTC()
+	if err := h.store.RecordLoginAttempt(attempt); err != nil {
+		log.Printf("login audit: %v", err)
+	}
+}
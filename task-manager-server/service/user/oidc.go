@@ -0,0 +1,172 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/SibHelly/task-manager-server/config"
+	"github.com/SibHelly/task-manager-server/service/auth"
+	"github.com/SibHelly/task-manager-server/service/ratelimit"
+	"github.com/SibHelly/task-manager-server/types"
+	"github.com/SibHelly/task-manager-server/utils"
+)
+
+var (
+	errOIDCDisabled = fmt.Errorf("single sign-on is not configured")
+	errNoAccount    = fmt.Errorf("no account is linked to this login")
+)
+
+// handleOIDCStart begins a single sign-on login. The client sends the user
+// to auth_url and keeps flow for the callback.
+func (h *Handler) handleOIDCStart(w http.ResponseWriter, r *http.Request) {
+	if h.idp == nil {
+		utils.WriteError(w, http.StatusNotFound, errOIDCDisabled)
+		return
+	}
+
+	flow, flowToken, challenge, err := auth.NewOIDCFlow([]byte(config.Envs.JWTSecret))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	authURL, err := h.idp.AuthURL(flow.State, flow.Nonce, challenge)
+	if err != nil {
+		log.Printf("oidc: %v", err)
+		utils.WriteError(w, http.StatusBadGateway, fmt.Errorf("identity provider is unavailable"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]string{
+		"auth_url": authURL,
+		"flow":     flowToken,
+	})
+}
+
+// handleOIDCCallback finishes a single sign-on login with the code and
+// state the provider sent back. The identity is looked up among the linked
+// ones, then linked to the user with the same verified email, and otherwise
+// gets a new user when config.Envs.OIDCAutoCreate is set. Phones are not
+// used to link: the ones users type in here are never verified.
+func (h *Handler) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if h.idp == nil {
+		utils.WriteError(w, http.StatusNotFound, errOIDCDisabled)
+		return
+	}
+
+	var payload types.OIDCCallbackPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if !h.allow(w, h.login.oidcPerIP, ratelimit.ClientIP(r)) {
+		return
+	}
+
+	flow, err := auth.ParseOIDCFlow(payload.Flow)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(payload.State), []byte(flow.State)) != 1 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("state does not match the login flow"))
+		return
+	}
+
+	id, err := h.idp.Exchange(r.Context(), payload.Code, flow.Verifier, flow.Nonce)
+	if err != nil {
+		log.Printf("oidc: %v", err)
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("login with the identity provider failed"))
+		return
+	}
+
+	u, err := h.oidcUser(id)
+	if err == errNoAccount {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.completeLogin(w, r, types.LoginAttempt{Login: loginKey(u), UserID: u.ID, IP: ratelimit.ClientIP(r)}, u)
+}
+
+// oidcUser finds or makes the user behind a verified identity.
+func (h *Handler) oidcUser(id *types.Identity) (*types.User, error) {
+	if u, err := h.store.GetUserByIdentity(id.Issuer, id.Subject); err == nil {
+		return u, nil
+	}
+
+	if email := normalizeEmail(id.Email); id.EmailVerified && email != "" {
+		if u, err := h.store.GetUserByEmail(email); err == nil {
+			if err := h.store.LinkIdentity(u.ID, id.Issuer, id.Subject); err != nil {
+				return nil, err
+			}
+			return u, nil
+		}
+	}
+
+	if !h.oidcAutoCreate {
+		return nil, errNoAccount
+	}
+	return h.createOIDCUser(id)
+}
+
+// createOIDCUser provisions a user for an identity seen for the first time.
+// The user gets a random password nobody knows, so it can only log in with
+// the provider until it resets the password.
+func (h *Handler) createOIDCUser(id *types.Identity) (*types.User, error) {
+	name := strings.TrimSpace(id.Name)
+	if utf8.RuneCountInString(name) > maxNameLen {
+		name = string([]rune(name)[:maxNameLen])
+	}
+	if name == "" {
+		name = "user"
+	}
+
+	phone := ""
+	if id.PhoneVerified && phonePattern.MatchString(id.Phone) && !h.phoneTaken(id.Phone) {
+		phone = id.Phone
+	}
+	email := ""
+	if id.EmailVerified && validEmail(normalizeEmail(id.Email)) {
+		email = normalizeEmail(id.Email)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	hash, err := auth.HashPassword(hex.EncodeToString(secret))
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := h.store.CreateOIDCUser(types.User{Name: name, Phone: phone, Email: email, Password: hash}, id.Issuer, id.Subject)
+	if err != nil {
+		return nil, err
+	}
+	return h.store.GetUserById(userID)
+}
+
+// phoneTaken tells if a user already has the phone in any of the ways it
+// may be stored: providers send E.164 with a leading +, which users often
+// leave out.
+func (h *Handler) phoneTaken(phone string) bool {
+	bare := strings.TrimPrefix(phone, "+")
+	for _, p := range []string{bare, "+" + bare} {
+		if _, err := h.store.GetUserByPhone(p); err == nil {
+			return true
+		}
+	}
+	return false
+}
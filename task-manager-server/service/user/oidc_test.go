@@ -0,0 +1,161 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SibHelly/task-manager-server/config"
+	"github.com/SibHelly/task-manager-server/service/auth"
+	"github.com/SibHelly/task-manager-server/types"
+)
+
+// fakeIdP vouches for identity when it gets back the verifier of the flow
+// it was started with.
+type fakeIdP struct {
+	identity  types.Identity
+	challenge string
+}
+
+func (f *fakeIdP) Issuer() string {
+	return "https://idp.example"
+}
+
+func (f *fakeIdP) AuthURL(state, nonce, codeChallenge string) (string, error) {
+	f.challenge = codeChallenge
+	return "https://idp.example/authorize?state=" + state, nil
+}
+
+func (f *fakeIdP) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*types.Identity, error) {
+	if code != "good" || auth.PKCEChallenge(codeVerifier) != f.challenge {
+		return nil, fmt.Errorf("invalid_grant")
+	}
+	id := f.identity
+	return &id, nil
+}
+
+func TestOIDCCallback(t *testing.T) {
+	userStore := &mockUserStore{users: []types.User{
+		{ID: 1, Name: "alice", Phone: "79990000001", Password: "hash"},
+		{ID: 2, Name: "bob", Phone: "79990000002", Email: "bob@example.com", Password: "hash", TOTPEnabled: true},
+	}}
+	idp := &fakeIdP{}
+	handler := NewHandler(userStore, nil, nil, nil, idp)
+	handler.oidcAutoCreate = true
+
+	login := func(code string, mangleState bool) *httptest.ResponseRecorder {
+		flow, flowToken, challenge, err := auth.NewOIDCFlow([]byte(config.Envs.JWTSecret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		idp.challenge = challenge
+
+		state := flow.State
+		if mangleState {
+			state += "x"
+		}
+		b, _ := json.Marshal(types.OIDCCallbackPayload{Code: code, State: state, Flow: flowToken})
+		rr := httptest.NewRecorder()
+		handler.handleOIDCCallback(rr, httptest.NewRequest(http.MethodPost, "/oidc/callback", bytes.NewBuffer(b)))
+		return rr
+	}
+	decode := func(rr *httptest.ResponseRecorder) map[string]interface{} {
+		var out map[string]interface{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	t.Run("should refuse a state from another flow", func(t *testing.T) {
+		if rr := login("good", true); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should refuse a code the provider does not accept", func(t *testing.T) {
+		if rr := login("bad", false); rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+
+	t.Run("should not link by a phone", func(t *testing.T) {
+		idp.identity = types.Identity{Issuer: idp.Issuer(), Subject: "s1", Phone: "+79990000001", PhoneVerified: true}
+
+		handler.oidcAutoCreate = false
+		if rr := login("good", false); rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+		if _, ok := userStore.identities[idp.Issuer()+" s1"]; ok {
+			t.Error("identity should not be linked")
+		}
+		handler.oidcAutoCreate = true
+	})
+
+	t.Run("should link the user with the verified email", func(t *testing.T) {
+		idp.identity = types.Identity{Issuer: idp.Issuer(), Subject: "s2", Email: "Bob@Example.com", EmailVerified: true}
+		rr := login("good", false)
+		if out := decode(rr); rr.Code != http.StatusOK || out["two_factor_required"] != true || out["token"] != nil {
+			t.Errorf("expected a 2FA challenge, got %d %s", rr.Code, rr.Body)
+		}
+		if userStore.identities[idp.Issuer()+" s2"] != 2 {
+			t.Errorf("identity linked to %d, want 2", userStore.identities[idp.Issuer()+" s2"])
+		}
+	})
+
+	t.Run("should not link by an unverified email", func(t *testing.T) {
+		idp.identity = types.Identity{Issuer: idp.Issuer(), Subject: "s4", Email: "bob@example.com"}
+		handler.oidcAutoCreate = false
+		defer func() { handler.oidcAutoCreate = true }()
+		if rr := login("good", false); rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should ask users with 2FA for a code", func(t *testing.T) {
+		idp.identity = types.Identity{Issuer: idp.Issuer(), Subject: "s2"}
+		rr := login("good", false)
+		if out := decode(rr); rr.Code != http.StatusOK || out["two_factor_required"] != true || out["token"] != nil {
+			t.Errorf("expected a 2FA challenge, got %d %s", rr.Code, rr.Body)
+		}
+	})
+
+	t.Run("should make a user without the phone someone else has", func(t *testing.T) {
+		idp.identity = types.Identity{Issuer: idp.Issuer(), Subject: "s3", Name: "Mallory", Phone: "+79990000001", PhoneVerified: true}
+
+		handler.oidcAutoCreate = false
+		if rr := login("good", false); rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+
+		handler.oidcAutoCreate = true
+		if rr := login("good", false); rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+		}
+		u := userStore.users[len(userStore.users)-1]
+		if u.ID != 3 || u.Name != "Mallory" || u.Phone != "" || u.Password == "" {
+			t.Errorf("unexpected new user %+v", u)
+		}
+		if userStore.identities[idp.Issuer()+" s3"] != 3 {
+			t.Errorf("identity linked to %d, want 3", userStore.identities[idp.Issuer()+" s3"])
+		}
+
+		if rr := login("good", false); rr.Code != http.StatusOK || len(userStore.users) != 3 {
+			t.Errorf("second login should reuse the user, got %d users", len(userStore.users))
+		}
+	})
+}
+
+func TestOIDCDisabled(t *testing.T) {
+	handler := NewHandler(&mockUserStore{}, nil, nil, nil, nil)
+
+	rr := httptest.NewRecorder()
+	handler.handleOIDCStart(rr, httptest.NewRequest(http.MethodGet, "/oidc/start", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
@@ -0,0 +1,214 @@
+package user
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/SibHelly/task-manager-server/config"
+	"github.com/SibHelly/task-manager-server/service/auth"
+	"github.com/SibHelly/task-manager-server/service/ratelimit"
+	"github.com/SibHelly/task-manager-server/types"
+	"github.com/SibHelly/task-manager-server/utils"
+)
+
+// Reset codes are resetCodeDigits long and work once, for resetCodeTTL.
+const (
+	resetCodeDigits = 8
+	resetCodeTTL    = 15 * time.Minute
+)
+
+var errBadResetCode = fmt.Errorf("invalid or expired code")
+
+func (h *Handler) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	var payload types.ChangePasswordPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	u, err := h.store.GetUserById(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if !auth.ComparePasswords(u.Password, []byte(payload.OldPassword)) {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("old password is incorrect"))
+		return
+	}
+	if payload.NewPassword == payload.OldPassword {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("new password must differ from the old one"))
+		return
+	}
+	if err := auth.ValidatePassword(payload.NewPassword, u.Name, u.Phone, u.Email); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.setPassword(u.ID, payload.NewPassword); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Every session is signed out; this device gets a new one.
+	token, err := h.startSession(r, u.ID, u.TokenVersion+1)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Password changed",
+		"token":  token,
+	})
+}
+
+// handleForgotPassword sends a reset code to the phone. The answer is the
+// same whether or not the phone is registered.
+func (h *Handler) handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var payload types.ForgotPasswordPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if !h.allow(w, h.login.forgotPerIP, ratelimit.ClientIP(r)) || !h.allow(w, h.login.forgotPerPhone, payload.Phone) {
+		return
+	}
+
+	if u, err := h.store.GetUserByPhone(payload.Phone); err == nil {
+		if err := h.sendResetCode(u); err != nil {
+			log.Printf("password reset for user %d: %v", u.ID, err)
+		}
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "If the phone is registered, a reset code was sent to it",
+	})
+}
+
+func (h *Handler) handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var payload types.ResetPasswordPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if !h.allow(w, h.login.resetPerPhone, payload.Phone) {
+		return
+	}
+
+	if err := auth.ValidatePassword(payload.NewPassword, payload.Phone); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	u, err := h.store.GetUserByPhone(payload.Phone)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, errBadResetCode)
+		return
+	}
+	if err := auth.ValidatePassword(payload.NewPassword, u.Name, u.Phone, u.Email); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ok, err := h.store.UsePasswordReset(u.ID, hashCode(payload.Code), time.Now().UTC())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, errBadResetCode)
+		return
+	}
+
+	if err := h.setPassword(u.ID, payload.NewPassword); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for _, login := range []string{u.Phone, u.Email} {
+		if login == "" {
+			continue
+		}
+		if err := h.login.lockout.Succeed(login); err != nil {
+			log.Printf("login lockout: %v", err)
+		}
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Password reset",
+	})
+}
+
+// setPassword stores the new password and signs the user out everywhere.
+func (h *Handler) setPassword(userID int, password string) error {
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return h.store.UpdatePassword(userID, hash)
+}
+
+func (h *Handler) sendResetCode(u *types.User) error {
+	code, err := newResetCode()
+	if err != nil {
+		return err
+	}
+
+	err = h.store.CreatePasswordReset(u.ID, hashCode(code), time.Now().UTC().Add(resetCodeTTL))
+	if err != nil {
+		return err
+	}
+
+	return h.sender.Send(types.Message{
+		To:      u.Phone,
+		Subject: "Password reset",
+		Body: fmt.Sprintf("Your password reset code is %s. It works once, for %d minutes.",
+			code, int(resetCodeTTL/time.Minute)),
+	})
+}
+
+// allow counts a hit on the limiter and answers 429 when it is over.
+func (h *Handler) allow(w http.ResponseWriter, l *ratelimit.Limiter, key string) bool {
+	res, err := l.Allow(key)
+	if err != nil {
+		log.Printf("rate limit: %v", err)
+		return true
+	}
+	if !res.Allowed {
+		ratelimit.TooManyRequests(w, res.RetryAfter, fmt.Errorf("too many requests, try again later"))
+		return false
+	}
+	return true
+}
+
+func newResetCode() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < resetCodeDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", resetCodeDigits, n), nil
+}
+
+// hashCode hashes reset and recovery codes. The hash is keyed with the
+// server secret, so the short codes can not be guessed back from a copy of
+// the database.
+func hashCode(code string) string {
+	mac := hmac.New(sha256.New, []byte(config.Envs.JWTSecret))
+	mac.Write([]byte(code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
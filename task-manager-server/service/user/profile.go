@@ -0,0 +1,322 @@
+package user
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/SibHelly/task-manager-server/config"
+	"github.com/SibHelly/task-manager-server/service/auth"
+	"github.com/SibHelly/task-manager-server/types"
+	"github.com/SibHelly/task-manager-server/utils"
+	"github.com/gorilla/mux"
+)
+
+// Profile limits; maxNameLen is the length of users.name.
+const (
+	maxNameLen     = 50
+	maxInfoLen     = 2000
+	maxAvatarBytes = 2 << 20
+)
+
+// avatarTypes maps the accepted picture types to their file extension.
+var avatarTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+var (
+	phonePattern  = regexp.MustCompile(`^\+?[0-9]{5,14}$`)
+	localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+)
+
+func (h *Handler) handleGetMe(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	u, err := h.store.GetUserById(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Get profile",
+		"user":   u,
+	})
+}
+
+func (h *Handler) handleUpdateMe(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	var payload types.UpdateProfile
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	u, err := h.store.GetUserById(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if err := applyProfile(u, payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if payload.Phone != nil {
+		other, err := h.store.GetUserByPhone(u.Phone)
+		if err == nil && other.ID != u.ID {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("User with %s already exists", u.Phone))
+			return
+		}
+	}
+
+	if err := h.store.UpdateUser(*u); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Profile updated",
+		"user":   u,
+	})
+}
+
+// handleDeleteMe deletes the account after checking the password again.
+func (h *Handler) handleDeleteMe(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	var payload types.DeleteAccountPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	u, err := h.store.GetUserById(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if !auth.ComparePasswords(u.Password, []byte(payload.Password)) {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("password is incorrect"))
+		return
+	}
+
+	deletion, err := h.store.DeleteUser(u.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	removeAvatar(u.Avatar)
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status":  "Account deleted",
+		"deleted": deletion,
+	})
+}
+
+// handleUploadAvatar takes the picture from the "avatar" field of a
+// multipart form and replaces the old one.
+func (h *Handler) handleUploadAvatar(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	u, err := h.store.GetUserById(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAvatarBytes+1<<16)
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing avatar file or it is over %d MB", maxAvatarBytes>>20))
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxAvatarBytes+1))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(data) > maxAvatarBytes {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("avatar must be at most %d MB", maxAvatarBytes>>20))
+		return
+	}
+
+	ext, ok := avatarTypes[http.DetectContentType(data)]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("avatar must be a PNG, JPEG, GIF or WebP picture"))
+		return
+	}
+
+	name, err := saveAvatar(u.ID, ext, data)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := h.store.SetAvatar(u.ID, name); err != nil {
+		removeAvatar(name)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	removeAvatar(u.Avatar)
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Avatar uploaded",
+		"avatar": name,
+	})
+}
+
+func (h *Handler) handleDeleteAvatar(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	u, err := h.store.GetUserById(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if err := h.store.SetAvatar(u.ID, ""); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	removeAvatar(u.Avatar)
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Avatar deleted",
+	})
+}
+
+func (h *Handler) handleGetAvatar(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	str, ok := vars["userID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing user ID"))
+		return
+	}
+
+	userID, err := strconv.Atoi(str)
+	if err != nil || userID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid user ID"))
+		return
+	}
+
+	u, err := h.store.GetUserById(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if u.Avatar == "" {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("user has no avatar"))
+		return
+	}
+
+	http.ServeFile(w, r, avatarPath(u.Avatar))
+}
+
+// applyProfile copies the given fields onto u, checking each of them.
+func applyProfile(u *types.User, p types.UpdateProfile) error {
+	if p.Name != nil {
+		name := strings.TrimSpace(*p.Name)
+		if name == "" || utf8.RuneCountInString(name) > maxNameLen {
+			return fmt.Errorf("name must be 1 to %d characters", maxNameLen)
+		}
+		u.Name = name
+	}
+	if p.Info != nil {
+		if utf8.RuneCountInString(*p.Info) > maxInfoLen {
+			return fmt.Errorf("info must be at most %d characters", maxInfoLen)
+		}
+		u.Info = *p.Info
+	}
+	if p.Phone != nil {
+		phone := strings.TrimSpace(*p.Phone)
+		if !phonePattern.MatchString(phone) {
+			return fmt.Errorf("phone must be digits, with an optional leading +")
+		}
+		u.Phone = phone
+	}
+	if p.Timezone != nil {
+		if !validTimezone(*p.Timezone) {
+			return fmt.Errorf("unknown timezone: %s", *p.Timezone)
+		}
+		u.Timezone = *p.Timezone
+	}
+	if p.ContactVisibility != nil {
+		switch *p.ContactVisibility {
+		case types.ContactPhone, types.ContactEmail, types.ContactBoth, types.ContactNone:
+			u.ContactVisibility = *p.ContactVisibility
+		default:
+			return fmt.Errorf("contact_visibility must be phone, email, both or none")
+		}
+	}
+	if p.Locale != nil {
+		if !localePattern.MatchString(*p.Locale) {
+			return fmt.Errorf("locale must look like \"en\" or \"en-US\"")
+		}
+		u.Locale = *p.Locale
+	}
+	if p.Searchable != nil {
+		u.Searchable = *p.Searchable
+	}
+	return nil
+}
+
+// validTimezone accepts IANA names like "Europe/Moscow" and "UTC". "Local"
+// is refused: it means whatever the server runs in.
+func validTimezone(name string) bool {
+	if name == "" || name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+func avatarPath(name string) string {
+	return filepath.Join(config.Envs.UploadDir, "avatars", filepath.Base(name))
+}
+
+// saveAvatar writes the picture under a new random name, so a changed
+// avatar never hits a cached old one.
+func saveAvatar(userID int, ext string, data []byte) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%d-%s%s", userID, hex.EncodeToString(b), ext)
+
+	path := avatarPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", err
+	}
+	return name, f.Close()
+}
+
+func removeAvatar(name string) {
+	if name == "" {
+		return
+	}
+	if err := os.Remove(avatarPath(name)); err != nil && !os.IsNotExist(err) {
+		log.Printf("remove avatar %s: %v", name, err)
+	}
+}
@@ -3,28 +3,95 @@ package user
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/SibHelly/task-manager-server/config"
 	"github.com/SibHelly/task-manager-server/service/auth"
+	"github.com/SibHelly/task-manager-server/service/notify"
+	"github.com/SibHelly/task-manager-server/service/ratelimit"
 	"github.com/SibHelly/task-manager-server/types"
 	"github.com/SibHelly/task-manager-server/utils"
 	"github.com/gorilla/mux"
 )
 
+const (
+	maxTokenName = 100
+	maxTokenDays = 3650
+)
+
 type Handler struct {
-	store types.UserStore
+	store  types.UserStore
+	login  *loginGuard
+	sender types.MessageSender
+	mailer types.MessageSender
+	idp    types.IdentityProvider
+	// oidcAutoCreate makes new users for identities that match none.
+	oidcAutoCreate bool
 }
 
-func NewHandler(store types.UserStore) *Handler {
-	return &Handler{store: store}
+// NewHandler keeps login limits in limits, or in memory when it is nil. It
+// sends reset codes to phones through sender and confirmation codes to
+// emails through mailer, either to the log when nil. Single sign-on goes
+// through idp; it is turned off when idp is nil.
+func NewHandler(store types.UserStore, limits types.RateLimitStore, sender, mailer types.MessageSender,
+	idp types.IdentityProvider) *Handler {
+	if limits == nil {
+		limits = ratelimit.NewMemoryStore()
+	}
+	if sender == nil {
+		sender = notify.LogSender{}
+	}
+	if mailer == nil {
+		mailer = notify.LogSender{}
+	}
+	return &Handler{
+		store:          store,
+		login:          newLoginGuard(limits),
+		sender:         sender,
+		mailer:         mailer,
+		idp:            idp,
+		oidcAutoCreate: config.Envs.OIDCAutoCreate,
+	}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc("/login", h.handleLogin).Methods("POST")
+	router.HandleFunc("/login/2fa", h.handleLoginTwoFactor).Methods(http.MethodPost)
+	router.HandleFunc("/oidc/start", h.handleOIDCStart).Methods(http.MethodGet)
+	router.HandleFunc("/oidc/callback", h.handleOIDCCallback).Methods(http.MethodPost)
 	router.HandleFunc("/register", h.handleRegister).Methods("POST")
+	router.HandleFunc("/password/forgot", h.handleForgotPassword).Methods(http.MethodPost)
+	router.HandleFunc("/password/reset", h.handleResetPassword).Methods(http.MethodPost)
+	router.HandleFunc("/password", auth.WithJWTAuth(h.handleChangePassword, h.store)).Methods(http.MethodPut)
 	router.HandleFunc("/auth/check", auth.WithJWTAuth(h.handleCheckAuth, h.store)).Methods("GET")
 	router.HandleFunc("/check/user", auth.WithJWTAuth(h.handleCheckUser, h.store)).Methods("Post")
 	router.HandleFunc("/user", auth.WithJWTAuth(h.handleGetUser, h.store)).Methods("Post")
+
+	router.HandleFunc("/me", auth.WithJWTAuth(h.handleGetMe, h.store)).Methods(http.MethodGet)
+	router.HandleFunc("/me", auth.WithJWTAuth(h.handleUpdateMe, h.store)).Methods(http.MethodPut)
+	router.HandleFunc("/me", auth.WithJWTAuth(h.handleDeleteMe, h.store)).Methods(http.MethodDelete)
+	router.HandleFunc("/me/email", auth.WithJWTAuth(h.handleSetEmail, h.store)).Methods(http.MethodPost)
+	router.HandleFunc("/me/email", auth.WithJWTAuth(h.handleDeleteEmail, h.store)).Methods(http.MethodDelete)
+	router.HandleFunc("/me/email/verify", auth.WithJWTAuth(h.handleVerifyEmail, h.store)).Methods(http.MethodPost)
+	router.HandleFunc("/me/sessions", auth.WithJWTAuth(h.handleGetSessions, h.store)).Methods(http.MethodGet)
+	router.HandleFunc("/me/sessions", auth.WithJWTAuth(h.handleRevokeOtherSessions, h.store)).Methods(http.MethodDelete)
+	router.HandleFunc("/me/sessions/{sessionID}", auth.WithJWTAuth(h.handleRevokeSession, h.store)).Methods(http.MethodDelete)
+	router.HandleFunc("/me/avatar", auth.WithJWTAuth(h.handleUploadAvatar, h.store)).Methods(http.MethodPost)
+	router.HandleFunc("/me/avatar", auth.WithJWTAuth(h.handleDeleteAvatar, h.store)).Methods(http.MethodDelete)
+	router.HandleFunc("/users/search", auth.WithJWTAuth(h.handleSearchUsers, h.store)).Methods(http.MethodGet)
+	router.HandleFunc("/users/{userID}/avatar", auth.WithJWTAuth(h.handleGetAvatar, h.store)).Methods(http.MethodGet)
+
+	router.HandleFunc("/2fa", auth.WithJWTAuth(h.handleGetTwoFactor, h.store)).Methods(http.MethodGet)
+	router.HandleFunc("/2fa/setup", auth.WithJWTAuth(h.handleSetupTwoFactor, h.store)).Methods(http.MethodPost)
+	router.HandleFunc("/2fa/enable", auth.WithJWTAuth(h.handleEnableTwoFactor, h.store)).Methods(http.MethodPost)
+	router.HandleFunc("/2fa/disable", auth.WithJWTAuth(h.handleDisableTwoFactor, h.store)).Methods(http.MethodPost)
+	router.HandleFunc("/2fa/recovery-codes", auth.WithJWTAuth(h.handleNewRecoveryCodes, h.store)).Methods(http.MethodPost)
+
+	router.HandleFunc("/tokens", auth.WithJWTAuth(h.handleGetTokens, h.store)).Methods(http.MethodGet)
+	router.HandleFunc("/tokens", auth.WithJWTAuth(h.handleCreateToken, h.store)).Methods(http.MethodPost)
+	router.HandleFunc("/tokens/scopes", auth.WithJWTAuth(h.handleGetTokenScopes, h.store)).Methods(http.MethodGet)
+	router.HandleFunc("/tokens/{tokenID}", auth.WithJWTAuth(h.handleRevokeToken, h.store)).Methods(http.MethodDelete)
 }
 
 func (h *Handler) handleCheckAuth(w http.ResponseWriter, r *http.Request) {
@@ -43,6 +110,8 @@ type check struct {
 	User_name string `json:"user_name"`
 }
 
+// handleCheckUser resolves an exact name to a user ID. Names are not unique,
+// so it answers with the first match; pickers should use /users/search.
 func (h *Handler) handleCheckUser(w http.ResponseWriter, r *http.Request) {
 	var payload check
 	if err := utils.ParseJSON(r, &payload); err != nil {
@@ -64,6 +133,8 @@ type user_id struct {
 	ID int `json:"user_id"`
 }
 
+// handleGetUser returns any user; the contacts of others are cut down to
+// what they show.
 func (h *Handler) handleGetUser(w http.ResponseWriter, r *http.Request) {
 	var payload user_id
 	if err := utils.ParseJSON(r, &payload); err != nil {
@@ -75,69 +146,146 @@ func (h *Handler) handleGetUser(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
+	if u.ID != auth.GetUserIDFromContext(r.Context()) {
+		hideContacts(u)
+	}
 	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
 		"user": u,
 	})
 
 }
 
-func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
-	var payload types.LoginUserPayload
+func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
+	var payload types.RegisterUserPayload
 	if err := utils.ParseJSON(r, &payload); err != nil {
 		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	u, err := h.store.GetUserByPhone(payload.Phone)
+	_, err := h.store.GetUserByPhone(payload.Phone)
+	if err == nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("User with %s already exists", payload.Phone))
+		return
+	}
+
+	if err := auth.ValidatePassword(payload.Password, payload.Name, payload.Phone); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(payload.Password)
 	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("Not found user with this phone"))
+		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	if !auth.ComparePasswords(u.Password, []byte(payload.Password)) {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("Invalid password"))
+	err = h.store.CreateUser(types.User{
+		Name:     payload.Name,
+		Info:     payload.Info,
+		Phone:    payload.Phone,
+		Password: hashedPassword,
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	secret := []byte(config.Envs.JWTSecret)
-	token, err := auth.CreateJWT(secret, u.ID)
+	utils.WriteJson(w, http.StatusCreated, nil)
+}
+
+func (h *Handler) handleGetTokens(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	tokens, err := h.store.GetAPITokens(userID)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	utils.WriteJson(w, http.StatusOK, map[string]string{"token": token})
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Get tokens",
+		"tokens": tokens,
+	})
 }
 
-func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
-	var payload types.RegisterUserPayload
-	if err := utils.ParseJSON(r, &payload); err != nil {
+func (h *Handler) handleGetTokenScopes(w http.ResponseWriter, r *http.Request) {
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status":    "Get token scopes",
+		"resources": auth.Resources,
+		"access":    []string{auth.ScopeRead, auth.ScopeWrite},
+	})
+}
+
+// handleCreateToken creates an API token. The token itself is only in this
+// response; the server keeps just its hash.
+func (h *Handler) handleCreateToken(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	var create types.CreateAPIToken
+	if err := utils.ParseJSON(r, &create); err != nil {
 		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	_, err := h.store.GetUserByPhone(payload.Phone)
-	if err == nil {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("User with %s already exists", payload.Phone))
+	create.Name = strings.TrimSpace(create.Name)
+	if create.Name == "" || len([]rune(create.Name)) > maxTokenName {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("token name must be 1 to %d characters", maxTokenName))
+		return
+	}
+	if len(create.Scopes) == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("token needs at least one scope"))
+		return
+	}
+	for _, s := range create.Scopes {
+		if !auth.ValidScope(s) {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("unknown scope: %s", s))
+			return
+		}
+	}
+	if create.ExpiresInDays < 0 || create.ExpiresInDays > maxTokenDays {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("expires_in_days must be between 0 and %d", maxTokenDays))
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(payload.Password)
+	token, hash, prefix, err := auth.NewAPIToken()
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	err = h.store.CreateUser(types.User{
-		Name:     payload.Name,
-		Info:     payload.Info,
-		Phone:    payload.Phone,
-		Password: hashedPassword,
-	})
+	id, err := h.store.CreateAPIToken(userID, create, hash, prefix)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	utils.WriteJson(w, http.StatusCreated, nil)
+	utils.WriteJson(w, http.StatusCreated, map[string]interface{}{
+		"Status":   "Token created",
+		"token_id": id,
+		"token":    token,
+	})
+}
+
+func (h *Handler) handleRevokeToken(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	vars := mux.Vars(r)
+	str, ok := vars["tokenID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing token ID"))
+		return
+	}
+
+	tokenID, err := strconv.Atoi(str)
+	if err != nil || tokenID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid token ID"))
+		return
+	}
+
+	err = h.store.RevokeAPIToken(userID, tokenID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Token revoked",
+	})
 }
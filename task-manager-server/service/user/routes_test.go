@@ -2,18 +2,23 @@ package user
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/SibHelly/task-manager-server/service/auth"
 	"github.com/SibHelly/task-manager-server/types"
 	"github.com/gorilla/mux"
 )
 
 func TestUserServiceHandlers(t *testing.T) {
 	userStore := &mockUserStore{}
-	handler := NewHandler(userStore)
+	handler := NewHandler(userStore, nil, nil, nil, nil)
 
 	t.Run("should fail if the user payload is invalid", func(t *testing.T) {
 		payload := types.RegisterUserPayload{
@@ -40,21 +45,320 @@ func TestUserServiceHandlers(t *testing.T) {
 	})
 }
 
+func TestUpdateMe(t *testing.T) {
+	userStore := &mockUserStore{users: []types.User{
+		{ID: 1, Name: "alice", Phone: "79990000001", Password: "hash", Timezone: "UTC", Locale: "en"},
+		{ID: 2, Name: "bob", Phone: "79990000002", Password: "hash", Timezone: "UTC", Locale: "en"},
+	}}
+	handler := NewHandler(userStore, nil, nil, nil, nil)
+
+	update := func(body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPut, "/me", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 1))
+		rr := httptest.NewRecorder()
+		handler.handleUpdateMe(rr, req)
+		return rr
+	}
+
+	t.Run("should refuse a phone another user has", func(t *testing.T) {
+		userStore.updated = nil
+		rr := update(`{"phone": "79990000002"}`)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+		if userStore.updated != nil {
+			t.Error("user should not be updated")
+		}
+	})
+
+	t.Run("should refuse an unknown timezone", func(t *testing.T) {
+		rr := update(`{"timezone": "Mars/Olympus"}`)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should change only the given fields", func(t *testing.T) {
+		userStore.updated = nil
+		rr := update(`{"name": " Alice ", "timezone": "Europe/Moscow", "locale": "ru-RU"}`)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+		}
+
+		u := userStore.updated
+		if u == nil || u.Name != "Alice" || u.Phone != "79990000001" || u.Timezone != "Europe/Moscow" || u.Locale != "ru-RU" {
+			t.Errorf("updated user = %+v", u)
+		}
+		if strings.Contains(rr.Body.String(), "hash") {
+			t.Errorf("response leaks the password hash: %s", rr.Body)
+		}
+	})
+}
+
+func TestSearchUsers(t *testing.T) {
+	userStore := &mockUserStore{}
+	handler := NewHandler(userStore, nil, nil, nil, nil)
+
+	search := func(query string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, "/users/search?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 1))
+		rr := httptest.NewRecorder()
+		handler.handleSearchUsers(rr, req)
+		return rr
+	}
+
+	for _, query := range []string{"q=a", "q=%20%20", "q=al&limit=0", "q=al&limit=51", "q=al&group_id=x"} {
+		if rr := search(query); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, got %d", query, http.StatusBadRequest, rr.Code)
+		}
+	}
+
+	rr := search("q=%20al%20&group_id=3")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+	}
+	want := types.UserSearch{Text: "al", GroupID: 3, Limit: defaultUserSearchMax}
+	if userStore.search == nil || *userStore.search != want {
+		t.Errorf("search = %+v, want %+v", userStore.search, want)
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	if got := escapeLike(`50%_a\b`); got != `50\%\_a\\b` {
+		t.Errorf("escapeLike = %q", got)
+	}
+}
+
 type mockUserStore struct {
+	users   []types.User
+	updated *types.User
+	search  *types.UserSearch
+	// recovery holds the unused recovery code hashes.
+	recovery []string
+	sessions []types.Session
+	// identities maps "issuer subject" to the linked user.
+	identities map[string]int
+	// emailCodes maps code hashes to the email they confirm.
+	emailCodes map[string]string
+}
+
+func (m *mockUserStore) index(id int) int {
+	for i, u := range m.users {
+		if u.ID == id {
+			return i
+		}
+	}
+	return -1
 }
 
 func (m *mockUserStore) GetUserByPhone(phone string) (*types.User, error) {
-	return nil, nil
+	for _, u := range m.users {
+		if u.Phone == phone {
+			return &u, nil
+		}
+	}
+	return nil, fmt.Errorf("user not found")
+}
+
+func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	for _, u := range m.users {
+		if email != "" && u.Email == email {
+			return &u, nil
+		}
+	}
+	return nil, fmt.Errorf("user not found")
 }
 
 func (m *mockUserStore) GetUserById(id int) (*types.User, error) {
-	return nil, nil
+	for _, u := range m.users {
+		if u.ID == id {
+			return &u, nil
+		}
+	}
+	return nil, fmt.Errorf("user not found")
 }
 
 func (s *mockUserStore) CreateUser(user types.User) error {
 	return nil
 }
 
+func (m *mockUserStore) UpdateUser(user types.User) error {
+	m.updated = &user
+	return nil
+}
+
+func (m *mockUserStore) SetAvatar(userID int, avatar string) error {
+	return nil
+}
+
+func (m *mockUserStore) DeleteUser(userID int) (*types.AccountDeletion, error) {
+	return &types.AccountDeletion{}, nil
+}
+
 func (m *mockUserStore) GetUserIdByName(name string) (*int, error) {
 	return nil, nil
 }
+
+func (m *mockUserStore) CreateAPIToken(userID int, t types.CreateAPIToken, hash, prefix string) (int, error) {
+	return 0, nil
+}
+
+func (m *mockUserStore) GetAPITokens(userID int) ([]types.APIToken, error) {
+	return nil, nil
+}
+
+func (m *mockUserStore) GetAPITokenByHash(hash string) (*types.APIToken, error) {
+	return nil, nil
+}
+
+func (m *mockUserStore) TouchAPIToken(tokenID int, at time.Time) error {
+	return nil
+}
+
+func (m *mockUserStore) RevokeAPIToken(userID, tokenID int) error {
+	return nil
+}
+
+func (m *mockUserStore) RecordLoginAttempt(a types.LoginAttempt) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdatePassword(userID int, hash string) error {
+	return nil
+}
+
+func (m *mockUserStore) CreatePasswordReset(userID int, codeHash string, expiresAt time.Time) error {
+	return nil
+}
+
+func (m *mockUserStore) UsePasswordReset(userID int, codeHash string, now time.Time) (bool, error) {
+	return false, nil
+}
+
+func (m *mockUserStore) SearchUsers(callerID int, q types.UserSearch) ([]types.UserSearchResult, error) {
+	m.search = &q
+	return []types.UserSearchResult{}, nil
+}
+
+func (m *mockUserStore) SetTOTPSecret(userID int, secret string) error {
+	if i := m.index(userID); i >= 0 {
+		m.users[i].TOTPSecret, m.users[i].TOTPEnabled, m.users[i].TOTPLastStep = secret, false, 0
+	}
+	return nil
+}
+
+func (m *mockUserStore) EnableTOTP(userID int, step int64, recoveryHashes []string) error {
+	if i := m.index(userID); i >= 0 {
+		m.users[i].TOTPEnabled, m.users[i].TOTPLastStep = true, step
+	}
+	m.recovery = recoveryHashes
+	return nil
+}
+
+func (m *mockUserStore) DisableTOTP(userID int) error {
+	if i := m.index(userID); i >= 0 {
+		m.users[i].TOTPSecret, m.users[i].TOTPEnabled, m.users[i].TOTPLastStep = "", false, 0
+	}
+	m.recovery = nil
+	return nil
+}
+
+func (m *mockUserStore) UseTOTPStep(userID int, step int64) (bool, error) {
+	i := m.index(userID)
+	if i < 0 || m.users[i].TOTPLastStep >= step {
+		return false, nil
+	}
+	m.users[i].TOTPLastStep = step
+	return true, nil
+}
+
+func (m *mockUserStore) ReplaceRecoveryCodes(userID int, hashes []string) error {
+	m.recovery = hashes
+	return nil
+}
+
+func (m *mockUserStore) UseRecoveryCode(userID int, hash string, now time.Time) (bool, error) {
+	for i, h := range m.recovery {
+		if h == hash {
+			m.recovery = append(m.recovery[:i], m.recovery[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockUserStore) CountRecoveryCodes(userID int) (int, error) {
+	return len(m.recovery), nil
+}
+
+func (m *mockUserStore) TwoFactorRequired(userID int) (bool, error) {
+	return false, nil
+}
+
+func (m *mockUserStore) CreateSession(sess types.Session) (int, error) {
+	sess.ID = len(m.sessions) + 1
+	m.sessions = append(m.sessions, sess)
+	return sess.ID, nil
+}
+
+func (m *mockUserStore) GetSession(sessionID int) (*types.Session, error) {
+	return nil, fmt.Errorf("session not found")
+}
+
+func (m *mockUserStore) GetSessions(userID int) ([]types.Session, error) {
+	return append([]types.Session(nil), m.sessions...), nil
+}
+
+func (m *mockUserStore) TouchSession(sessionID int, at time.Time) error {
+	return nil
+}
+
+func (m *mockUserStore) RevokeSession(userID, sessionID int) error {
+	return nil
+}
+
+func (m *mockUserStore) RevokeOtherSessions(userID, keepID int) (int, error) {
+	return 0, nil
+}
+
+func (m *mockUserStore) GetUserByIdentity(issuer, subject string) (*types.User, error) {
+	return m.GetUserById(m.identities[issuer+" "+subject])
+}
+
+func (m *mockUserStore) LinkIdentity(userID int, issuer, subject string) error {
+	if m.identities == nil {
+		m.identities = make(map[string]int)
+	}
+	m.identities[issuer+" "+subject] = userID
+	return nil
+}
+
+func (m *mockUserStore) CreateOIDCUser(u types.User, issuer, subject string) (int, error) {
+	u.ID = len(m.users) + 1
+	m.users = append(m.users, u)
+	return u.ID, m.LinkIdentity(u.ID, issuer, subject)
+}
+
+func (m *mockUserStore) SetEmail(userID int, email string) error {
+	if i := m.index(userID); i >= 0 {
+		m.users[i].Email = email
+	}
+	return nil
+}
+
+func (m *mockUserStore) CreateEmailVerification(userID int, email, codeHash string, expiresAt time.Time) error {
+	m.emailCodes = map[string]string{codeHash: email}
+	return nil
+}
+
+func (m *mockUserStore) UseEmailVerification(userID int, codeHash string, now time.Time) (string, error) {
+	email := m.emailCodes[codeHash]
+	delete(m.emailCodes, codeHash)
+	return email, nil
+}
@@ -0,0 +1,129 @@
+package user
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/SibHelly/task-manager-server/service/auth"
+	"github.com/SibHelly/task-manager-server/types"
+	"github.com/SibHelly/task-manager-server/utils"
+)
+
+const (
+	minUserSearchLen     = 2
+	defaultUserSearchMax = 10
+	maxUserSearchMax     = 50
+)
+
+// sharesGroup is true when the user u is in a group the caller is a member
+// of, see types.MemberCond.
+var sharesGroup = `EXISTS (SELECT 1 FROM inclusions b
+	WHERE b.user_id = u.user_id AND ` + types.MemberCond("b.group_id") + `)`
+
+// The phone and email of u, or NULL when u hides them from group members.
+const (
+	visiblePhone = `CASE WHEN u.contact_visibility IN ('phone', 'both') THEN u.phone END`
+	visibleEmail = `CASE WHEN u.contact_visibility IN ('email', 'both') THEN u.email END`
+)
+
+// SearchUsers finds users by a name, phone or email prefix. Users sharing a
+// group with the caller match on any of them, as far as they show their
+// contacts. Other users only show up when they made themselves searchable,
+// and then by a name prefix or the exact phone or email they show, so
+// contacts can not be guessed character by character.
+func (s *Store) SearchUsers(callerID int, q types.UserSearch) ([]types.UserSearchResult, error) {
+	prefix := escapeLike(q.Text) + "%"
+
+	query := `SELECT u.user_id, u.name, COALESCE(u.avatar, ''), COALESCE(` + visiblePhone + `, ''),
+		COALESCE(` + visibleEmail + `, ''), ` + sharesGroup + ` AS shared
+	FROM users u
+	WHERE u.user_id <> ?
+		AND ((` + sharesGroup + ` AND (u.name LIKE ? OR ` + visiblePhone + ` LIKE ? OR ` + visibleEmail + ` LIKE ?))
+			OR (u.searchable AND (u.name LIKE ? OR ` + visiblePhone + ` = ? OR ` + visibleEmail + ` = ?)))`
+	args := []interface{}{callerID, callerID, callerID, prefix, prefix, prefix, prefix, q.Text, q.Text}
+
+	if q.GroupID != 0 {
+		query += `
+		AND EXISTS (SELECT 1 FROM inclusions m WHERE m.group_id = ? AND m.user_id = u.user_id)
+		AND ` + types.MemberCond("?")
+		args = append(args, q.GroupID, q.GroupID, callerID)
+	}
+
+	query += `
+	ORDER BY shared DESC, u.name, u.user_id
+	LIMIT ?`
+	args = append(args, q.Limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]types.UserSearchResult, 0)
+	for rows.Next() {
+		var u types.UserSearchResult
+		if err := rows.Scan(&u.ID, &u.Name, &u.Avatar, &u.Phone, &u.Email, &u.SharesGroup); err != nil {
+			return nil, err
+		}
+		if !u.SharesGroup {
+			u.Phone, u.Email = "", ""
+		}
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+// handleSearchUsers serves ?q= with optional ?group_id= and ?limit=, for
+// the assignee and invite pickers.
+func (h *Handler) handleSearchUsers(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	query := r.URL.Query()
+
+	q := types.UserSearch{
+		Text:  strings.TrimSpace(query.Get("q")),
+		Limit: defaultUserSearchMax,
+	}
+	if utf8.RuneCountInString(q.Text) < minUserSearchLen {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("q must be at least %d characters", minUserSearchLen))
+		return
+	}
+
+	if str := query.Get("group_id"); str != "" {
+		groupID, err := strconv.Atoi(str)
+		if err != nil || groupID <= 0 {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid group ID"))
+			return
+		}
+		q.GroupID = groupID
+	}
+
+	if str := query.Get("limit"); str != "" {
+		l, err := strconv.Atoi(str)
+		if err != nil || l < 1 || l > maxUserSearchMax {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxUserSearchMax))
+			return
+		}
+		q.Limit = l
+	}
+
+	users, err := h.store.SearchUsers(userID, q)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Search users",
+		"users":  users,
+	})
+}
+
+// escapeLike escapes the LIKE wildcards in s.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,133 @@
+package user
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/SibHelly/task-manager-server/types"
+)
+
+const sessionSelect = `SELECT session_id, user_id, user_agent, ip, created_at, last_seen_at, expires_at, revoked_at
+	FROM sessions`
+
+// Column sizes of sessions.user_agent and sessions.ip.
+const (
+	maxUserAgentLen = 255
+	maxIPLen        = 45
+)
+
+func (s *Store) CreateSession(sess types.Session) (int, error) {
+	res, err := s.db.Exec(`INSERT INTO sessions (user_id, user_agent, ip, created_at, last_seen_at, expires_at)
+	VALUES (?, ?, ?, ?, ?, ?)`, sess.UserID, truncate(sess.UserAgent, maxUserAgentLen), truncate(sess.IP, maxIPLen),
+		sess.CreatedAt, sess.LastSeenAt, sess.ExpiresAt)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+func (s *Store) GetSession(sessionID int) (*types.Session, error) {
+	rows, err := s.db.Query(sessionSelect+" WHERE session_id = ?", sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sess := new(types.Session)
+	for rows.Next() {
+		sess, err = scanRowIntoSession(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if sess.ID == 0 {
+		return nil, fmt.Errorf("session not found")
+	}
+	return sess, nil
+}
+
+// GetSessions returns the user's sessions that are neither revoked nor
+// expired, the most recently seen first.
+func (s *Store) GetSessions(userID int) ([]types.Session, error) {
+	rows, err := s.db.Query(sessionSelect+`
+	WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+	ORDER BY last_seen_at DESC, session_id DESC`, userID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]types.Session, 0)
+	for rows.Next() {
+		sess, err := scanRowIntoSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *sess)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (s *Store) TouchSession(sessionID int, at time.Time) error {
+	_, err := s.db.Exec("UPDATE sessions SET last_seen_at = ? WHERE session_id = ?", at, sessionID)
+	return err
+}
+
+func (s *Store) RevokeSession(userID, sessionID int) error {
+	res, err := s.db.Exec("UPDATE sessions SET revoked_at = ? WHERE session_id = ? AND user_id = ? AND revoked_at IS NULL",
+		time.Now().UTC(), sessionID, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("session not found")
+	}
+	return nil
+}
+
+// RevokeOtherSessions revokes every session of the user but keepID, and
+// returns how many it revoked.
+func (s *Store) RevokeOtherSessions(userID, keepID int) (int, error) {
+	res, err := s.db.Exec("UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND session_id <> ? AND revoked_at IS NULL",
+		time.Now().UTC(), userID, keepID)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func scanRowIntoSession(rows *sql.Rows) (*types.Session, error) {
+	sess := new(types.Session)
+	var revoked sql.NullTime
+
+	err := rows.Scan(&sess.ID, &sess.UserID, &sess.UserAgent, &sess.IP,
+		&sess.CreatedAt, &sess.LastSeenAt, &sess.ExpiresAt, &revoked)
+	if err != nil {
+		return nil, err
+	}
+	if revoked.Valid {
+		sess.RevokedAt = &revoked.Time
+	}
+
+	return sess, nil
+}
+
+// truncate cuts s to n characters.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,100 @@
+package user
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SibHelly/task-manager-server/config"
+	"github.com/SibHelly/task-manager-server/service/auth"
+	"github.com/SibHelly/task-manager-server/service/ratelimit"
+	"github.com/SibHelly/task-manager-server/types"
+	"github.com/SibHelly/task-manager-server/utils"
+	"github.com/gorilla/mux"
+)
+
+// startSession records a new session for the device of the request and
+// returns its JWT.
+func (h *Handler) startSession(r *http.Request, userID, tokenVersion int) (string, error) {
+	now := time.Now().UTC()
+	expiration := time.Second * time.Duration(config.Envs.JWTExpirastionInSeconds)
+
+	sessionID, err := h.store.CreateSession(types.Session{
+		UserID:     userID,
+		UserAgent:  r.UserAgent(),
+		IP:         ratelimit.ClientIP(r),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(expiration),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return auth.CreateJWT([]byte(config.Envs.JWTSecret), userID, tokenVersion, sessionID)
+}
+
+func (h *Handler) handleGetSessions(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	current := auth.GetSessionIDFromContext(r.Context())
+
+	sessions, err := h.store.GetSessions(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status":   "Get sessions",
+		"sessions": sessions,
+	})
+}
+
+// handleRevokeSession signs one device out. Revoking the current session
+// is a logout.
+func (h *Handler) handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	vars := mux.Vars(r)
+	str, ok := vars["sessionID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing session ID"))
+		return
+	}
+
+	sessionID, err := strconv.Atoi(str)
+	if err != nil || sessionID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid session ID"))
+		return
+	}
+
+	if err := h.store.RevokeSession(userID, sessionID); err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Session revoked",
+	})
+}
+
+// handleRevokeOtherSessions signs out every device but the one making the
+// request.
+func (h *Handler) handleRevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	current := auth.GetSessionIDFromContext(r.Context())
+
+	n, err := h.store.RevokeOtherSessions(userID, current)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status":  "Other sessions revoked",
+		"revoked": n,
+	})
+}
@@ -0,0 +1,59 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SibHelly/task-manager-server/service/auth"
+	"github.com/SibHelly/task-manager-server/types"
+)
+
+func TestLoginStartsSession(t *testing.T) {
+	hash, err := auth.HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	userStore := &mockUserStore{users: []types.User{
+		{ID: 1, Name: "alice", Phone: "79990000001", Password: hash},
+	}}
+	handler := NewHandler(userStore, nil, nil, nil, nil)
+
+	for i := 0; i < 2; i++ {
+		b, _ := json.Marshal(types.LoginUserPayload{Phone: "79990000001", Password: "correct horse"})
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(b))
+		req.Header.Set("User-Agent", "test-agent")
+		rr := httptest.NewRecorder()
+		handler.handleLogin(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("login: %d %s", rr.Code, rr.Body)
+		}
+	}
+
+	if len(userStore.sessions) != 2 {
+		t.Fatalf("got %d sessions, want 2", len(userStore.sessions))
+	}
+	s := userStore.sessions[1]
+	if s.UserID != 1 || s.UserAgent != "test-agent" || s.IP != "192.0.2.1" || !s.ExpiresAt.After(s.CreatedAt) {
+		t.Errorf("unexpected session %+v", s)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/me/sessions", nil)
+	ctx := context.WithValue(req.Context(), auth.UserKey, 1)
+	req = req.WithContext(context.WithValue(ctx, auth.SessionKey, 2))
+	rr := httptest.NewRecorder()
+	handler.handleGetSessions(rr, req)
+
+	var out struct {
+		Sessions []types.Session `json:"sessions"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Sessions) != 2 || out.Sessions[0].Current || !out.Sessions[1].Current {
+		t.Errorf("unexpected sessions %+v", out.Sessions)
+	}
+}
@@ -2,11 +2,20 @@ package user
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/SibHelly/task-manager-server/types"
 )
 
+const userSelect = `SELECT user_id, name, COALESCE(info, ''), COALESCE(phone, ''), password,
+	COALESCE(avatar, ''), timezone, locale, COALESCE(email, ''), searchable, contact_visibility,
+	COALESCE(totp_secret, ''), totp_enabled, totp_last_step, token_version FROM users`
+
+// maxEmailLen is the length of users.email and login_attempts.login.
+const maxEmailLen = 254
+
 type Store struct {
 	db *sql.DB
 }
@@ -16,7 +25,26 @@ func NewStore(db *sql.DB) *Store {
 }
 
 func (s *Store) GetUserByPhone(phone string) (*types.User, error) {
-	rows, err := s.db.Query("SELECT * FROM users WHERE phone = ?", phone)
+	rows, err := s.db.Query(userSelect+" WHERE phone = ?", phone)
+	if err != nil {
+		return nil, err
+	}
+
+	u := new(types.User)
+	for rows.Next() {
+		u, err = scanRowIntoUser(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if u.ID == 0 {
+		return nil, fmt.Errorf("user not found")
+	}
+	return u, nil
+}
+
+func (s *Store) GetUserByEmail(email string) (*types.User, error) {
+	rows, err := s.db.Query(userSelect+" WHERE email = ?", email)
 	if err != nil {
 		return nil, err
 	}
@@ -35,7 +63,7 @@ func (s *Store) GetUserByPhone(phone string) (*types.User, error) {
 }
 
 func (s *Store) GetUserById(id int) (*types.User, error) {
-	rows, err := s.db.Query("SELECT * FROM users WHERE user_id = ?", id)
+	rows, err := s.db.Query(userSelect+" WHERE user_id = ?", id)
 	if err != nil {
 		return nil, err
 	}
@@ -54,7 +82,7 @@ func (s *Store) GetUserById(id int) (*types.User, error) {
 }
 
 func (s *Store) GetUserIdByName(name string) (*int, error) {
-	rows, err := s.db.Query("SELECT * FROM users WHERE name = ?", name)
+	rows, err := s.db.Query(userSelect+" WHERE name = ?", name)
 	if err != nil {
 		return nil, err
 	}
@@ -80,10 +108,229 @@ func (s *Store) CreateUser(user types.User) error {
 	return nil
 }
 
+// UpdateUser saves the profile fields of the user: name, info, phone,
+// timezone, locale, searchable and contact visibility. An empty phone is stored as NULL, since
+// users who signed up with OIDC may have none.
+func (s *Store) UpdateUser(u types.User) error {
+	_, err := s.db.Exec(`UPDATE users SET name = ?, info = ?, phone = ?, timezone = ?, locale = ?, searchable = ?,
+	contact_visibility = ? WHERE user_id = ?`, u.Name, u.Info, nullIfEmpty(u.Phone), u.Timezone, u.Locale,
+		u.Searchable, u.ContactVisibility, u.ID)
+	return err
+}
+
+func (s *Store) SetAvatar(userID int, avatar string) error {
+	_, err := s.db.Exec("UPDATE users SET avatar = ? WHERE user_id = ?", nullIfEmpty(avatar), userID)
+	return err
+}
+
+// UpdatePassword sets a new password hash, bumps the token version and
+// revokes every session, which signs the user out everywhere.
+func (s *Store) UpdatePassword(userID int, hash string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE users SET password = ?, token_version = token_version + 1 WHERE user_id = ?", hash, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", time.Now().UTC(), userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CreatePasswordReset stores a reset code hash. Any older unused codes of
+// the user stop working.
+func (s *Store) CreatePasswordReset(userID int, codeHash string, expiresAt time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	_, err = tx.Exec("UPDATE password_resets SET used_at = ? WHERE user_id = ? AND used_at IS NULL", now, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO password_resets (user_id, code_hash, expires_at, created_at) VALUES (?, ?, ?, ?)",
+		userID, codeHash, expiresAt, now)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UsePasswordReset marks the code used and reports whether it was valid:
+// the user's, unused and not expired.
+func (s *Store) UsePasswordReset(userID int, codeHash string, now time.Time) (bool, error) {
+	res, err := s.db.Exec(`UPDATE password_resets SET used_at = ?
+	WHERE user_id = ? AND code_hash = ? AND used_at IS NULL AND expires_at > ?`, now, userID, codeHash, now)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// RecordLoginAttempt adds an entry to the login audit. The login is cut to
+// the column size, since it comes straight from the request.
+func (s *Store) RecordLoginAttempt(a types.LoginAttempt) error {
+	_, err := s.db.Exec(`INSERT INTO login_attempts (login, user_id, ip, success, reason, created_at)
+	VALUES (?, ?, ?, ?, ?, ?)`, truncate(a.Login, maxEmailLen), nullIfZero(a.UserID), a.IP, a.Success, nullIfEmpty(a.Reason), a.At)
+	return err
+}
+
+func nullIfZero(i int) interface{} {
+	if i == 0 {
+		return nil
+	}
+	return i
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+const tokenSelect = `SELECT token_id, user_id, token_name, token_prefix, scopes,
+	expires_at, last_used_at, revoked_at, created_at
+	FROM api_tokens`
+
+func (s *Store) CreateAPIToken(userID int, t types.CreateAPIToken, hash, prefix string) (int, error) {
+	scopes, err := json.Marshal(t.Scopes)
+	if err != nil {
+		return 0, err
+	}
+
+	var expires interface{}
+	if t.ExpiresInDays > 0 {
+		expires = time.Now().UTC().AddDate(0, 0, t.ExpiresInDays)
+	}
+
+	res, err := s.db.Exec(`INSERT INTO api_tokens (user_id, token_name, token_hash, token_prefix, scopes, expires_at, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)`, userID, t.Name, hash, prefix, scopes, expires, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+func (s *Store) GetAPITokens(userID int) ([]types.APIToken, error) {
+	rows, err := s.db.Query(tokenSelect+" WHERE user_id = ? ORDER BY created_at DESC, token_id DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := make([]types.APIToken, 0)
+	for rows.Next() {
+		t, err := scanRowIntoAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *t)
+	}
+
+	return tokens, rows.Err()
+}
+
+func (s *Store) GetAPITokenByHash(hash string) (*types.APIToken, error) {
+	rows, err := s.db.Query(tokenSelect+" WHERE token_hash = ?", hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	t := new(types.APIToken)
+	for rows.Next() {
+		t, err = scanRowIntoAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if t.ID == 0 {
+		return nil, fmt.Errorf("token not found")
+	}
+
+	return t, nil
+}
+
+func (s *Store) TouchAPIToken(tokenID int, at time.Time) error {
+	_, err := s.db.Exec("UPDATE api_tokens SET last_used_at = ? WHERE token_id = ?", at, tokenID)
+	return err
+}
+
+// RevokeAPIToken revokes one of the user's tokens. Revoked tokens stay
+// listed so their use can still be looked up.
+func (s *Store) RevokeAPIToken(userID, tokenID int) error {
+	res, err := s.db.Exec("UPDATE api_tokens SET revoked_at = ? WHERE token_id = ? AND user_id = ? AND revoked_at IS NULL",
+		time.Now().UTC(), tokenID, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("token not found")
+	}
+	return nil
+}
+
+func scanRowIntoAPIToken(rows *sql.Rows) (*types.APIToken, error) {
+	t := new(types.APIToken)
+	var (
+		scopes   []byte
+		expires  sql.NullTime
+		lastUsed sql.NullTime
+		revoked  sql.NullTime
+	)
+
+	err := rows.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &scopes, &expires, &lastUsed, &revoked, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(scopes, &t.Scopes); err != nil {
+		return nil, fmt.Errorf("token %d has broken scopes: %w", t.ID, err)
+	}
+	if expires.Valid {
+		t.ExpiresAt = &expires.Time
+	}
+	if lastUsed.Valid {
+		t.LastUsedAt = &lastUsed.Time
+	}
+	if revoked.Valid {
+		t.RevokedAt = &revoked.Time
+	}
+
+	return t, nil
+}
+
 func scanRowIntoUser(rows *sql.Rows) (*types.User, error) {
 	user := new(types.User)
 
-	err := rows.Scan(&user.ID, &user.Name, &user.Info, &user.Phone, &user.Password)
+	err := rows.Scan(&user.ID, &user.Name, &user.Info, &user.Phone, &user.Password,
+		&user.Avatar, &user.Timezone, &user.Locale, &user.Email, &user.Searchable, &user.ContactVisibility,
+		&user.TOTPSecret, &user.TOTPEnabled, &user.TOTPLastStep, &user.TokenVersion)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,283 @@
+package user
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SibHelly/task-manager-server/service/auth"
+	"github.com/SibHelly/task-manager-server/types"
+	"github.com/SibHelly/task-manager-server/utils"
+)
+
+const (
+	totpIssuer        = "Task Manager"
+	recoveryCodeCount = 10
+)
+
+var errBadCode = fmt.Errorf("invalid two-factor code")
+
+func (h *Handler) handleGetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	u, err := h.store.GetUserById(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	left := 0
+	if u.TOTPEnabled {
+		left, err = h.store.CountRecoveryCodes(u.ID)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	required, err := h.store.TwoFactorRequired(u.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status":              "Get two-factor status",
+		"enabled":             u.TOTPEnabled,
+		"required":            required,
+		"recovery_codes_left": left,
+	})
+}
+
+// handleSetupTwoFactor starts enrollment: it makes a new secret and returns
+// it with the otpauth:// URI to show as a QR code. Nothing changes for
+// logins until the first code is confirmed.
+func (h *Handler) handleSetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	u, err := h.store.GetUserById(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if u.TOTPEnabled {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("two-factor authentication is already on"))
+		return
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := h.store.SetTOTPSecret(u.ID, secret); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// The app shows the account next to the codes.
+	account := u.Phone
+	if account == "" {
+		account = u.Email
+	}
+	if account == "" {
+		account = u.Name
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Two-factor setup started",
+		"secret": secret,
+		"uri":    auth.TOTPURI(totpIssuer, account, secret),
+	})
+}
+
+// handleEnableTwoFactor confirms the setup with a code from the app and
+// returns the recovery codes. They are shown only this once.
+func (h *Handler) handleEnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	var payload types.TwoFactorCodePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	u, err := h.store.GetUserById(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if u.TOTPEnabled {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("two-factor authentication is already on"))
+		return
+	}
+	if u.TOTPSecret == "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("start two-factor setup first"))
+		return
+	}
+	if !h.allow(w, h.login.codePerUser, strconv.Itoa(u.ID)) {
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(u.TOTPSecret, payload.Code, time.Now(), u.TOTPLastStep)
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, errBadCode)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := h.store.EnableTOTP(u.ID, step, hashes); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status":         "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// handleDisableTwoFactor turns 2FA off. It takes the password and a code,
+// and is refused while a group of the user requires 2FA.
+func (h *Handler) handleDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	var payload types.DisableTwoFactorPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	u, err := h.store.GetUserById(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if !u.TOTPEnabled {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("two-factor authentication is not on"))
+		return
+	}
+
+	required, err := h.store.TwoFactorRequired(u.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if required {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("a group you are in requires two-factor authentication"))
+		return
+	}
+
+	if !h.allow(w, h.login.codePerUser, strconv.Itoa(u.ID)) {
+		return
+	}
+	if !auth.ComparePasswords(u.Password, []byte(payload.Password)) {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("password is incorrect"))
+		return
+	}
+	ok, err := h.checkSecondFactor(u, payload.Code)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, errBadCode)
+		return
+	}
+
+	if err := h.store.DisableTOTP(u.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Two-factor authentication disabled",
+	})
+}
+
+// handleNewRecoveryCodes replaces the recovery codes. It takes a TOTP code,
+// so a lost set can not be used to make a new one.
+func (h *Handler) handleNewRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	var payload types.TwoFactorCodePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	u, err := h.store.GetUserById(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if !u.TOTPEnabled {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("two-factor authentication is not on"))
+		return
+	}
+	if !h.allow(w, h.login.codePerUser, strconv.Itoa(u.ID)) {
+		return
+	}
+
+	if !auth.IsTOTPCode(payload.Code) {
+		utils.WriteError(w, http.StatusBadRequest, errBadCode)
+		return
+	}
+	ok, err := h.checkSecondFactor(u, payload.Code)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, errBadCode)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := h.store.ReplaceRecoveryCodes(u.ID, hashes); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status":         "Recovery codes replaced",
+		"recovery_codes": codes,
+	})
+}
+
+// checkSecondFactor checks a TOTP code or, failing the form of one, a
+// recovery code. Either is used up by a successful check.
+func (h *Handler) checkSecondFactor(u *types.User, code string) (bool, error) {
+	now := time.Now()
+	if auth.IsTOTPCode(code) {
+		step, ok := auth.ValidateTOTP(u.TOTPSecret, code, now, u.TOTPLastStep)
+		if !ok {
+			return false, nil
+		}
+		return h.store.UseTOTPStep(u.ID, step)
+	}
+
+	code = auth.NormalizeRecoveryCode(code)
+	if code == "" {
+		return false, nil
+	}
+	return h.store.UseRecoveryCode(u.ID, hashCode(code), now.UTC())
+}
+
+// newRecoveryCodes returns new recovery codes and the hashes to store.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := auth.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hashes := make([]string, len(codes))
+	for i, c := range codes {
+		hashes[i] = hashCode(auth.NormalizeRecoveryCode(c))
+	}
+	return codes, hashes, nil
+}
@@ -0,0 +1,128 @@
+package user
+
+import (
+	"database/sql"
+	"time"
+)
+
+// SetTOTPSecret starts 2FA setup with a new secret. The secret is not used
+// for logins until EnableTOTP.
+func (s *Store) SetTOTPSecret(userID int, secret string) error {
+	_, err := s.db.Exec("UPDATE users SET totp_secret = ?, totp_enabled = FALSE, totp_last_step = 0 WHERE user_id = ?",
+		secret, userID)
+	return err
+}
+
+// EnableTOTP turns 2FA on, with step as the last code used and a fresh set
+// of recovery codes.
+func (s *Store) EnableTOTP(userID int, step int64, recoveryHashes []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE users SET totp_enabled = TRUE, totp_last_step = ? WHERE user_id = ? AND totp_secret IS NOT NULL",
+		step, userID)
+	if err != nil {
+		return err
+	}
+	if err := replaceRecoveryCodes(tx, userID, recoveryHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) DisableTOTP(userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE users SET totp_secret = NULL, totp_enabled = FALSE, totp_last_step = 0 WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep records that the code of step was used and reports whether
+// it was still unused, so a code works once even when two requests race.
+func (s *Store) UseTOTPStep(userID int, step int64) (bool, error) {
+	res, err := s.db.Exec("UPDATE users SET totp_last_step = ? WHERE user_id = ? AND totp_last_step < ?", step, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (s *Store) ReplaceRecoveryCodes(userID int, hashes []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, hashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks the code used and reports whether it was one of
+// the user's unused codes.
+func (s *Store) UseRecoveryCode(userID int, hash string, now time.Time) (bool, error) {
+	res, err := s.db.Exec("UPDATE recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		now, userID, hash)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// CountRecoveryCodes returns how many unused recovery codes the user has.
+func (s *Store) CountRecoveryCodes(userID int) (int, error) {
+	var n int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL", userID).Scan(&n)
+	return n, err
+}
+
+// TwoFactorRequired reports whether one of the user's groups requires 2FA.
+func (s *Store) TwoFactorRequired(userID int) (bool, error) {
+	var required bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM inclusions i
+	JOIN `+"`groups`"+` g ON g.group_id = i.group_id
+	WHERE i.user_id = ? AND g.require_2fa)`, userID).Scan(&required)
+	return required, err
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int, hashes []string) error {
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, h := range hashes {
+		_, err := tx.Exec("INSERT INTO recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, ?)", userID, h, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
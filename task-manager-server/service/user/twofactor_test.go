@@ -0,0 +1,90 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SibHelly/task-manager-server/service/auth"
+	"github.com/SibHelly/task-manager-server/types"
+)
+
+func TestTwoFactorLogin(t *testing.T) {
+	hash, err := auth.HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	userStore := &mockUserStore{users: []types.User{
+		{ID: 1, Name: "alice", Phone: "79990000001", Password: hash},
+	}}
+	handler := NewHandler(userStore, nil, nil, nil, nil)
+
+	call := func(h http.HandlerFunc, userID int, body interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+		b, _ := json.Marshal(body)
+		req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBuffer(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if userID != 0 {
+			req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, userID))
+		}
+		rr := httptest.NewRecorder()
+		h(rr, req)
+
+		var out map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &out)
+		return rr, out
+	}
+
+	// enroll
+	rr, out := call(handler.handleSetupTwoFactor, 1, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("setup: %d %s", rr.Code, rr.Body)
+	}
+	secret := out["secret"].(string)
+
+	code, _ := auth.TOTPCode(secret, time.Now())
+	if rr, _ := call(handler.handleEnableTwoFactor, 1, types.TwoFactorCodePayload{Code: "000000x"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("enable with a bad code: %d", rr.Code)
+	}
+	rr, out = call(handler.handleEnableTwoFactor, 1, types.TwoFactorCodePayload{Code: code})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("enable: %d %s", rr.Code, rr.Body)
+	}
+	recovery := out["recovery_codes"].([]interface{})
+	if len(recovery) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes", len(recovery))
+	}
+
+	login := func() string {
+		rr, out := call(handler.handleLogin, 0, types.LoginUserPayload{Phone: "79990000001", Password: "correct horse"})
+		if rr.Code != http.StatusOK || out["two_factor_required"] != true || out["token"] != nil {
+			t.Fatalf("login: %d %s", rr.Code, rr.Body)
+		}
+		return out["challenge_token"].(string)
+	}
+
+	// the code used to enable is spent
+	challenge := login()
+	if rr, _ := call(handler.handleLoginTwoFactor, 0, types.TwoFactorLoginPayload{ChallengeToken: challenge, Code: code}); rr.Code != http.StatusBadRequest {
+		t.Errorf("replayed code: %d", rr.Code)
+	}
+
+	// a recovery code works once
+	payload := types.TwoFactorLoginPayload{ChallengeToken: challenge, Code: recovery[0].(string)}
+	rr, out = call(handler.handleLoginTwoFactor, 0, payload)
+	if rr.Code != http.StatusOK || out["token"] == nil {
+		t.Fatalf("recovery code: %d %s", rr.Code, rr.Body)
+	}
+	if rr, _ := call(handler.handleLoginTwoFactor, 0, payload); rr.Code != http.StatusBadRequest {
+		t.Errorf("reused recovery code: %d", rr.Code)
+	}
+
+	if rr, _ := call(handler.handleLoginTwoFactor, 0, types.TwoFactorLoginPayload{ChallengeToken: "nope", Code: "123456"}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("bad challenge: %d", rr.Code)
+	}
+}
@@ -0,0 +1,269 @@
+package view
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/SibHelly/task-manager-server/service/auth"
+	"github.com/SibHelly/task-manager-server/types"
+	"github.com/SibHelly/task-manager-server/utils"
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	store      types.ViewStore
+	taskStore  types.TasksStore
+	groupStore types.GroupStore
+	userStore  types.UserStore
+}
+
+func NewHandler(store types.ViewStore, taskStore types.TasksStore, groupStore types.GroupStore, userStore types.UserStore) *Handler {
+	return &Handler{store: store, taskStore: taskStore, groupStore: groupStore, userStore: userStore}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/views", auth.WithJWTAuth(h.handleGetViews, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/views", auth.WithJWTAuth(h.handleCreateView, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/views/{viewID}", auth.WithJWTAuth(h.handleGetView, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/views/{viewID}", auth.WithJWTAuth(h.handleUpdateView, h.userStore)).Methods(http.MethodPut)
+	router.HandleFunc("/views/{viewID}", auth.WithJWTAuth(h.handleDeleteView, h.userStore)).Methods(http.MethodDelete)
+	router.HandleFunc("/views/{viewID}/tasks", auth.WithJWTAuth(h.handleGetViewTasks, h.userStore)).Methods(http.MethodGet)
+}
+
+func (h *Handler) handleGetViews(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	views, err := h.store.GetViews(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, views)
+}
+
+func (h *Handler) handleCreateView(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	var create types.CreateView
+	if err := utils.ParseJSON(r, &create); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.validateView(&create, userID); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	_, err := h.store.GetView(userID, create.Name)
+	if err == nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("view: %s already exists", create.Name))
+		return
+	}
+
+	err = h.store.CreateView(userID, create)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusCreated, "View created")
+}
+
+func (h *Handler) handleGetView(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	v, ok := h.viewFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, v)
+}
+
+func (h *Handler) handleUpdateView(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	current, ok := h.viewFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	if current.UserID != userID {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("only the owner can change this view"))
+		return
+	}
+
+	var create types.CreateView
+	if err := utils.ParseJSON(r, &create); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.validateView(&create, userID); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	v, err := h.store.GetView(userID, create.Name)
+	if err == nil && v.ID != current.ID {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("view: %s already exists", create.Name))
+		return
+	}
+
+	err = h.store.UpdateView(current.ID, create)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, "View updated")
+}
+
+func (h *Handler) handleDeleteView(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	current, ok := h.viewFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	if current.UserID != userID {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("only the owner can delete this view"))
+		return
+	}
+
+	err := h.store.DeleteView(current.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, "View deleted")
+}
+
+// handleGetViewTasks runs the view for the current user, so a shared view
+// only ever shows tasks the caller can see themselves.
+func (h *Handler) handleGetViewTasks(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	v, ok := h.viewFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	ts, err := h.taskStore.FindTasks(userID, v.Filter, v.Sort)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	res := map[string]interface{}{
+		"Status": "Get view tasks",
+		"view":   v,
+		"tasks":  ts,
+	}
+	if v.GroupBy != "" {
+		res["groups"] = groupTasks(ts, v.GroupBy)
+	}
+
+	utils.WriteJson(w, http.StatusOK, res)
+}
+
+// viewFromRequest loads the view from the route; users see their own views
+// and those shared with their groups.
+func (h *Handler) viewFromRequest(w http.ResponseWriter, r *http.Request, userID int) (*types.View, bool) {
+	vars := mux.Vars(r)
+	str, ok := vars["viewID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing view ID"))
+		return nil, false
+	}
+
+	viewID, err := strconv.Atoi(str)
+	if err != nil || viewID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid view ID"))
+		return nil, false
+	}
+
+	v, err := h.store.GetViewByID(viewID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return nil, false
+	}
+
+	if v.UserID != userID {
+		if v.GroupID == 0 {
+			utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you have no access to this view"))
+			return nil, false
+		}
+		if _, err := h.groupStore.GetUserRole(v.GroupID, userID); err != nil {
+			utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you have no access to this view"))
+			return nil, false
+		}
+	}
+
+	return v, true
+}
+
+// validateView checks the view and fills in the defaults.
+func (h *Handler) validateView(v *types.CreateView, userID int) error {
+	if v.Name == "" {
+		return fmt.Errorf("view name is required")
+	}
+
+	switch v.Sort {
+	case "":
+		v.Sort = types.SortDeadline
+	case types.SortDeadline, types.SortPriority, types.SortCreated, types.SortName, types.SortFocus:
+	default:
+		return fmt.Errorf("unknown sort: %s", v.Sort)
+	}
+
+	switch v.GroupBy {
+	case "", types.GroupByStatus, types.GroupByPriority, types.GroupByCategory, types.GroupByGroup:
+	default:
+		return fmt.Errorf("unknown group_by: %s", v.GroupBy)
+	}
+
+	switch v.Filter.LabelMode {
+	case "":
+		v.Filter.LabelMode = types.LabelModeAny
+	case types.LabelModeAny, types.LabelModeAll, types.LabelModeNone:
+	default:
+		return fmt.Errorf("label_mode must be any, all or none")
+	}
+
+	if v.GroupID != 0 {
+		if _, err := h.groupStore.GetUserRole(v.GroupID, userID); err != nil {
+			return fmt.Errorf("you are not a member of this group")
+		}
+	}
+
+	return nil
+}
+
+// groupTasks splits the tasks by the field, keeping the order in which each
+// value first appears.
+func groupTasks(ts []types.Task, by string) []types.TaskGroup {
+	groups := make([]types.TaskGroup, 0)
+	index := make(map[int]int)
+	for _, t := range ts {
+		var key int
+		switch by {
+		case types.GroupByStatus:
+			key = t.Status_id
+		case types.GroupByPriority:
+			key = t.Priority_id
+		case types.GroupByCategory:
+			key = t.Category_id
+		case types.GroupByGroup:
+			key = t.Group_id
+		}
+
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, types.TaskGroup{Key: key})
+		}
+		groups[i].Tasks = append(groups[i].Tasks, t)
+	}
+	return groups
+}
@@ -0,0 +1,157 @@
+package view
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/SibHelly/task-manager-server/types"
+)
+
+const viewSelect = `SELECT v.view_id, v.user_id, COALESCE(v.group_id, 0), v.view_name,
+	v.filter, v.sort, COALESCE(v.group_by, ''), v.created_at
+	FROM saved_views v`
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// GetViews returns the user's own views and the views shared with their
+// groups.
+func (s *Store) GetViews(userID int) ([]types.View, error) {
+	query := viewSelect + `
+	WHERE v.user_id = ?
+		OR ` + types.MemberCond("v.group_id") + `
+	ORDER BY v.view_name, v.view_id`
+	rows, err := s.db.Query(query, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	views := make([]types.View, 0)
+	for rows.Next() {
+		v, err := scanRowsIntoView(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		views = append(views, *v)
+	}
+
+	return views, rows.Err()
+}
+
+func (s *Store) GetViewByID(viewID int) (*types.View, error) {
+	rows, err := s.db.Query(viewSelect+" WHERE v.view_id = ?", viewID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	v := new(types.View)
+	for rows.Next() {
+		v, err = scanRowsIntoView(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if v.ID == 0 {
+		return nil, fmt.Errorf("view not found")
+	}
+	return v, nil
+}
+
+func (s *Store) GetView(userID int, name string) (*types.View, error) {
+	rows, err := s.db.Query(viewSelect+" WHERE v.user_id = ? AND v.view_name = ?", userID, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	v := new(types.View)
+	for rows.Next() {
+		v, err = scanRowsIntoView(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if v.ID == 0 {
+		return nil, fmt.Errorf("view not found")
+	}
+	return v, nil
+}
+
+func (s *Store) CreateView(userID int, v types.CreateView) error {
+	filter, err := json.Marshal(v.Filter)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(
+		"INSERT INTO saved_views (user_id, group_id, view_name, filter, sort, group_by) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, nullIfZero(v.GroupID), v.Name, filter, v.Sort, nullIfEmpty(v.GroupBy),
+	)
+	return err
+}
+
+func (s *Store) UpdateView(viewID int, v types.CreateView) error {
+	filter, err := json.Marshal(v.Filter)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(
+		"UPDATE saved_views SET group_id = ?, view_name = ?, filter = ?, sort = ?, group_by = ? WHERE view_id = ?",
+		nullIfZero(v.GroupID), v.Name, filter, v.Sort, nullIfEmpty(v.GroupBy), viewID,
+	)
+	return err
+}
+
+func (s *Store) DeleteView(viewID int) error {
+	_, err := s.db.Exec("DELETE FROM saved_views WHERE view_id = ?", viewID)
+	return err
+}
+
+func scanRowsIntoView(rows *sql.Rows) (*types.View, error) {
+	v := new(types.View)
+	var filter []byte
+
+	err := rows.Scan(
+		&v.ID,
+		&v.UserID,
+		&v.GroupID,
+		&v.Name,
+		&filter,
+		&v.Sort,
+		&v.GroupBy,
+		&v.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(filter, &v.Filter); err != nil {
+		return nil, fmt.Errorf("view %d has a broken filter: %w", v.ID, err)
+	}
+
+	return v, nil
+}
+
+func nullIfZero(i int) interface{} {
+	if i == 0 {
+		return nil
+	}
+	return i
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,310 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/SibHelly/task-manager-server/types"
+)
+
+// Headers sent with every delivery. The signature is "sha256=" followed by
+// the hex HMAC-SHA256 of the body keyed with the webhook secret.
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// EventTest is sent by the test endpoint. Webhooks can not subscribe to it.
+const EventTest = "webhook.test"
+
+// A failed delivery is retried after baseBackoff, doubling up to maxBackoff,
+// until it has been tried maxAttempts times. Claimed deliveries are leased
+// for claimLease, so a crashed dispatcher's work is picked up again later.
+const (
+	maxAttempts  = 8
+	baseBackoff  = 30 * time.Second
+	maxBackoff   = 6 * time.Hour
+	claimLease   = 2 * time.Minute
+	claimBatch   = 50
+	maxErrorLen  = 1000
+	maxBodyDrain = 64 << 10
+)
+
+// Dispatcher turns events into deliveries and sends them.
+type Dispatcher struct {
+	store  types.WebhookStore
+	client *http.Client
+	now    func() time.Time
+}
+
+// errPrivateAddress refuses receivers on loopback, link-local, private and
+// other non-public addresses, so webhooks can not reach internal services.
+var errPrivateAddress = fmt.Errorf("url must point to a public address")
+
+// nonPublic are the ranges net.IP has no method for: "this network", shared
+// address space, IETF protocol assignments, benchmarking and reserved.
+var nonPublic = parseCIDRs("0.0.0.0/8", "100.64.0.0/10", "192.0.0.0/24", "198.18.0.0/15", "240.0.0.0/4")
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// publicIP tells if webhooks may be sent to ip.
+func publicIP(ip net.IP) bool {
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, n := range nonPublic {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// dialPublic is a net.Dialer Control that refuses non-public addresses. It
+// runs on the address actually dialed, after DNS, so a host that resolves
+// to another address later, or a redirect, can not get around the check.
+func dialPublic(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if !publicIP(net.ParseIP(host)) {
+		return errPrivateAddress
+	}
+	return nil
+}
+
+// NewClient returns the client deliveries should go out with: it only
+// connects to public addresses and does not go through a proxy, which
+// would dial the receiver out of the check's sight.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: dialPublic}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+func NewDispatcher(store types.WebhookStore, client *http.Client) *Dispatcher {
+	return &Dispatcher{
+		store:  store,
+		client: client,
+		now:    func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// payload is the JSON body of a delivery.
+type payload struct {
+	Event   string                 `json:"event"`
+	GroupID int                    `json:"group_id"`
+	TaskID  int                    `json:"task_id,omitempty"`
+	ActorID int                    `json:"actor_id,omitempty"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+	At      time.Time              `json:"at"`
+}
+
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff returns how long to wait after the given failed attempt.
+func backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	d := baseBackoff
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if d >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return d
+}
+
+func subscribed(h types.Webhook, eventType string) bool {
+	for _, e := range h.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleEvent queues the event for every active webhook of its group that
+// subscribed to it. It is meant to be subscribed to the event bus.
+func (d *Dispatcher) HandleEvent(e types.Event) {
+	if e.GroupID == 0 {
+		return
+	}
+
+	hooks, err := d.store.GetWebhooks(e.GroupID)
+	if err != nil {
+		log.Printf("webhooks for group %d: %v", e.GroupID, err)
+		return
+	}
+
+	var body []byte
+	for _, h := range hooks {
+		if !h.Active || !subscribed(h, e.Type) {
+			continue
+		}
+		if body == nil {
+			body, err = json.Marshal(payload{
+				Event:   e.Type,
+				GroupID: e.GroupID,
+				TaskID:  e.TaskID,
+				ActorID: e.ActorID,
+				Data:    e.Data,
+				At:      e.At,
+			})
+			if err != nil {
+				log.Printf("webhook payload for %s: %v", e.Type, err)
+				return
+			}
+		}
+		if _, err := d.store.EnqueueDelivery(h.ID, e.Type, body, d.now()); err != nil {
+			log.Printf("queue %s for webhook %d: %v", e.Type, h.ID, err)
+		}
+	}
+}
+
+// SendTest sends a test event to the webhook right away and returns the
+// logged delivery. Test deliveries are not retried.
+func (d *Dispatcher) SendTest(h *types.Webhook, actorID int) (*types.Delivery, error) {
+	body, err := json.Marshal(payload{
+		Event:   EventTest,
+		GroupID: h.GroupID,
+		ActorID: actorID,
+		At:      d.now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Queued as already claimed, so the background loop leaves it alone.
+	id, err := d.store.EnqueueDelivery(h.ID, EventTest, body, d.now().Add(claimLease))
+	if err != nil {
+		return nil, err
+	}
+
+	d.deliver(types.Delivery{
+		ID:        id,
+		WebhookID: h.ID,
+		EventType: EventTest,
+		Payload:   string(body),
+		Attempts:  maxAttempts - 1,
+		URL:       h.URL,
+		Secret:    h.Secret,
+	})
+
+	return d.store.GetDelivery(id)
+}
+
+// DeliverDue sends the deliveries whose time has come and returns how many
+// it tried.
+func (d *Dispatcher) DeliverDue() (int, error) {
+	deliveries, err := d.store.ClaimDueDeliveries(d.now(), claimLease, claimBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, del := range deliveries {
+		d.deliver(del)
+	}
+	return len(deliveries), nil
+}
+
+// Run delivers due webhooks every interval. It never returns.
+func (d *Dispatcher) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for {
+			n, err := d.DeliverDue()
+			if err != nil {
+				log.Printf("webhook deliveries: %v", err)
+			}
+			if err != nil || n < claimBatch {
+				break
+			}
+		}
+	}
+}
+
+// deliver sends the delivery once and records the outcome, scheduling the
+// next attempt when the receiver did not accept it.
+func (d *Dispatcher) deliver(del types.Delivery) {
+	code, err := d.send(del)
+
+	a := types.DeliveryAttempt{
+		At:           d.now(),
+		ResponseCode: code,
+		Delivered:    err == nil,
+	}
+	if err != nil {
+		a.Error = err.Error()
+		if len(a.Error) > maxErrorLen {
+			a.Error = a.Error[:maxErrorLen]
+		}
+		if attempts := del.Attempts + 1; attempts < maxAttempts {
+			next := a.At.Add(backoff(attempts))
+			a.NextAttempt = &next
+		}
+	}
+
+	if err := d.store.RecordAttempt(del.ID, a); err != nil {
+		log.Printf("webhook delivery %d: %v", del.ID, err)
+	}
+}
+
+func (d *Dispatcher) send(del types.Delivery) (int, error) {
+	body := []byte(del.Payload)
+	req, err := http.NewRequest(http.MethodPost, del.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "task-manager-webhooks")
+	req.Header.Set(EventHeader, del.EventType)
+	req.Header.Set(DeliveryHeader, fmt.Sprint(del.ID))
+	req.Header.Set(SignatureHeader, Sign(del.Secret, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxBodyDrain))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,385 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SibHelly/task-manager-server/types"
+)
+
+func TestSign(t *testing.T) {
+	got := Sign("key", []byte("The quick brown fox jumps over the lazy dog"))
+	want := "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"
+	if got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	if backoff(1) != baseBackoff {
+		t.Errorf("backoff(1) = %s, want %s", backoff(1), baseBackoff)
+	}
+	for i := 2; i < 30; i++ {
+		prev, cur := backoff(i-1), backoff(i)
+		if cur < prev {
+			t.Errorf("backoff(%d) = %s is shorter than backoff(%d) = %s", i, cur, i-1, prev)
+		}
+		if cur > maxBackoff {
+			t.Errorf("backoff(%d) = %s is over %s", i, cur, maxBackoff)
+		}
+	}
+	if backoff(30) != maxBackoff {
+		t.Errorf("backoff(30) = %s, want %s", backoff(30), maxBackoff)
+	}
+}
+
+// receiver is a local webhook endpoint answering with status.
+type receiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+	w.WriteHeader(rc.status)
+}
+
+func newTestDispatcher(store *memStore, clock *time.Time) *Dispatcher {
+	d := NewDispatcher(store, &http.Client{Timeout: 5 * time.Second})
+	d.now = func() time.Time { return *clock }
+	return d
+}
+
+func TestDeliverSignedEvent(t *testing.T) {
+	rc := &receiver{status: http.StatusNoContent}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	clock := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store := &memStore{hooks: []types.Webhook{
+		{ID: 1, GroupID: 7, URL: srv.URL, Secret: "first-secret-0001", Events: []string{types.EventTaskFinished}, Active: true},
+		{ID: 2, GroupID: 7, URL: srv.URL, Secret: "other-secret-0002", Events: []string{types.EventTaskCreated}, Active: true},
+		{ID: 3, GroupID: 7, URL: srv.URL, Secret: "third-secret-0003", Events: []string{types.EventTaskFinished}, Active: false},
+		{ID: 4, GroupID: 8, URL: srv.URL, Secret: "fourth-secret-004", Events: []string{types.EventTaskFinished}, Active: true},
+	}}
+	d := newTestDispatcher(store, &clock)
+
+	d.HandleEvent(types.Event{Type: types.EventTaskFinished, TaskID: 3, GroupID: 7, ActorID: 5, Recipients: []int{9}, At: clock})
+	d.HandleEvent(types.Event{Type: types.EventTaskFinished, TaskID: 4, ActorID: 5, At: clock})
+
+	if len(store.deliveries) != 1 || store.deliveries[0].WebhookID != 1 {
+		t.Fatalf("expected one delivery for webhook 1, got %+v", store.deliveries)
+	}
+
+	n, err := d.DeliverDue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || len(rc.requests) != 1 {
+		t.Fatalf("expected one request, tried %d and received %d", n, len(rc.requests))
+	}
+
+	req, body := rc.requests[0], rc.bodies[0]
+	if got := req.Header.Get(SignatureHeader); got != Sign("first-secret-0001", body) {
+		t.Errorf("signature %q does not match the body", got)
+	}
+	if got := req.Header.Get(EventHeader); got != types.EventTaskFinished {
+		t.Errorf("event header = %q", got)
+	}
+	if got := req.Header.Get(DeliveryHeader); got != fmt.Sprint(store.deliveries[0].ID) {
+		t.Errorf("delivery header = %q", got)
+	}
+
+	var p map[string]interface{}
+	if err := json.Unmarshal(body, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p["event"] != types.EventTaskFinished || p["task_id"] != float64(3) || p["group_id"] != float64(7) {
+		t.Errorf("unexpected payload %s", body)
+	}
+	if _, ok := p["recipients"]; ok {
+		t.Errorf("payload leaks recipients: %s", body)
+	}
+
+	del := store.deliveries[0]
+	if del.Status != types.DeliveryDelivered || del.Attempts != 1 || del.ResponseCode != http.StatusNoContent {
+		t.Errorf("unexpected delivery log %+v", del)
+	}
+
+	if n, _ := d.DeliverDue(); n != 0 {
+		t.Errorf("a delivered event was sent again")
+	}
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	rc := &receiver{status: http.StatusInternalServerError}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	clock := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store := &memStore{hooks: []types.Webhook{
+		{ID: 1, GroupID: 7, URL: srv.URL, Secret: "first-secret-0001", Events: []string{types.EventCommentAdded}, Active: true},
+	}}
+	d := newTestDispatcher(store, &clock)
+	d.HandleEvent(types.Event{Type: types.EventCommentAdded, TaskID: 3, GroupID: 7, ActorID: 5, At: clock})
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if n, err := d.DeliverDue(); err != nil || n != 1 {
+			t.Fatalf("attempt %d: tried %d, err %v", attempt, n, err)
+		}
+
+		del := store.deliveries[0]
+		if del.Attempts != attempt || del.ResponseCode != http.StatusInternalServerError || del.Error == "" {
+			t.Fatalf("attempt %d: unexpected delivery log %+v", attempt, del)
+		}
+		if attempt == maxAttempts {
+			if del.Status != types.DeliveryFailed {
+				t.Fatalf("delivery is %s after %d attempts, want failed", del.Status, attempt)
+			}
+			break
+		}
+
+		if del.Status != types.DeliveryPending {
+			t.Fatalf("attempt %d: delivery is %s, want pending", attempt, del.Status)
+		}
+		if want := clock.Add(backoff(attempt)); !del.NextAttemptAt.Equal(want) {
+			t.Fatalf("attempt %d: next attempt at %s, want %s", attempt, del.NextAttemptAt, want)
+		}
+
+		clock = clock.Add(backoff(attempt) - time.Second)
+		if n, _ := d.DeliverDue(); n != 0 {
+			t.Fatalf("attempt %d: retried before the backoff ran out", attempt)
+		}
+		clock = clock.Add(time.Second)
+	}
+
+	if len(rc.requests) != maxAttempts {
+		t.Errorf("receiver got %d requests, want %d", len(rc.requests), maxAttempts)
+	}
+	clock = clock.Add(24 * time.Hour)
+	if n, _ := d.DeliverDue(); n != 0 {
+		t.Errorf("a failed delivery was retried")
+	}
+}
+
+func TestRetrySucceeds(t *testing.T) {
+	rc := &receiver{status: http.StatusBadGateway}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	clock := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store := &memStore{hooks: []types.Webhook{
+		{ID: 1, GroupID: 7, URL: srv.URL, Secret: "first-secret-0001", Events: []string{types.EventMemberAdded}, Active: true},
+	}}
+	d := newTestDispatcher(store, &clock)
+	d.HandleEvent(types.Event{Type: types.EventMemberAdded, GroupID: 7, ActorID: 5, Data: map[string]interface{}{"user_id": 6}, At: clock})
+
+	d.DeliverDue()
+	rc.status = http.StatusOK
+	clock = clock.Add(backoff(1))
+	d.DeliverDue()
+
+	del := store.deliveries[0]
+	if del.Status != types.DeliveryDelivered || del.Attempts != 2 || del.ResponseCode != http.StatusOK || del.Error != "" {
+		t.Errorf("unexpected delivery log %+v", del)
+	}
+}
+
+func TestSendTest(t *testing.T) {
+	rc := &receiver{status: http.StatusOK}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	clock := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	hook := types.Webhook{ID: 1, GroupID: 7, URL: srv.URL, Secret: "first-secret-0001", Events: []string{types.EventTaskUpdated}, Active: true}
+	store := &memStore{hooks: []types.Webhook{hook}}
+	d := newTestDispatcher(store, &clock)
+
+	del, err := d.SendTest(&hook, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if del.Status != types.DeliveryDelivered || del.EventType != EventTest {
+		t.Errorf("unexpected delivery %+v", del)
+	}
+	if len(rc.requests) != 1 || rc.requests[0].Header.Get(SignatureHeader) != Sign(hook.Secret, rc.bodies[0]) {
+		t.Errorf("test event was not sent signed")
+	}
+	if n, _ := d.DeliverDue(); n != 0 {
+		t.Errorf("the test event was sent twice")
+	}
+
+	rc.status = http.StatusNotFound
+	del, err = d.SendTest(&hook, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if del.Status != types.DeliveryFailed || del.ResponseCode != http.StatusNotFound {
+		t.Errorf("a failed test event should not be retried: %+v", del)
+	}
+}
+
+// memStore keeps webhooks and deliveries in memory.
+type memStore struct {
+	mu         sync.Mutex
+	hooks      []types.Webhook
+	deliveries []types.Delivery
+}
+
+func (m *memStore) hook(id int) *types.Webhook {
+	for i := range m.hooks {
+		if m.hooks[i].ID == id {
+			return &m.hooks[i]
+		}
+	}
+	return nil
+}
+
+func (m *memStore) GetWebhooks(groupID int) ([]types.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]types.Webhook, 0)
+	for _, h := range m.hooks {
+		if h.GroupID == groupID {
+			out = append(out, h)
+		}
+	}
+	return out, nil
+}
+
+func (m *memStore) GetWebhookByID(webhookID int) (*types.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if h := m.hook(webhookID); h != nil {
+		return h, nil
+	}
+	return nil, fmt.Errorf("webhook not found")
+}
+
+func (m *memStore) CreateWebhook(groupID, userID int, w types.CreateWebhook, secret string) (int, error) {
+	return 0, nil
+}
+
+func (m *memStore) UpdateWebhook(webhookID int, w types.UpdateWebhook) error {
+	return nil
+}
+
+func (m *memStore) DeleteWebhook(webhookID int) error {
+	return nil
+}
+
+func (m *memStore) EnqueueDelivery(webhookID int, eventType string, payload []byte, nextAttempt time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := len(m.deliveries) + 1
+	m.deliveries = append(m.deliveries, types.Delivery{
+		ID:            id,
+		WebhookID:     webhookID,
+		EventType:     eventType,
+		Payload:       string(payload),
+		Status:        types.DeliveryPending,
+		NextAttemptAt: nextAttempt,
+	})
+	return id, nil
+}
+
+func (m *memStore) ClaimDueDeliveries(now time.Time, lease time.Duration, limit int) ([]types.Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]types.Delivery, 0)
+	for i := range m.deliveries {
+		d := &m.deliveries[i]
+		h := m.hook(d.WebhookID)
+		if len(out) == limit || d.Status != types.DeliveryPending || d.NextAttemptAt.After(now) || h == nil || !h.Active {
+			continue
+		}
+		d.NextAttemptAt = now.Add(lease)
+		claimed := *d
+		claimed.URL, claimed.Secret = h.URL, h.Secret
+		out = append(out, claimed)
+	}
+	return out, nil
+}
+
+func (m *memStore) RecordAttempt(deliveryID int, a types.DeliveryAttempt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d := &m.deliveries[deliveryID-1]
+	d.Attempts++
+	d.LastAttemptAt = &a.At
+	d.ResponseCode = a.ResponseCode
+	d.Error = a.Error
+	switch {
+	case a.Delivered:
+		d.Status = types.DeliveryDelivered
+	case a.NextAttempt == nil:
+		d.Status = types.DeliveryFailed
+	default:
+		d.NextAttemptAt = *a.NextAttempt
+	}
+	return nil
+}
+
+func (m *memStore) GetDelivery(deliveryID int) (*types.Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if deliveryID < 1 || deliveryID > len(m.deliveries) {
+		return nil, fmt.Errorf("delivery not found")
+	}
+	d := m.deliveries[deliveryID-1]
+	return &d, nil
+}
+
+func (m *memStore) GetDeliveries(webhookID, limit int) ([]types.Delivery, error) {
+	return nil, nil
+}
+
+func TestPrivateReceivers(t *testing.T) {
+	for _, raw := range []string{
+		"http://127.0.0.1/hook",
+		"http://localhost:8080/hook",
+		"http://[::1]/hook",
+		"http://10.0.0.5/hook",
+		"http://192.168.1.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://0.0.0.0/hook",
+		"http://100.64.0.1/hook",
+		"ftp://example.com/hook",
+	} {
+		if err := validateURL(raw); err == nil {
+			t.Errorf("validateURL(%q) should fail", raw)
+		}
+	}
+	if err := validateURL("https://93.184.216.34/hook"); err != nil {
+		t.Errorf("validateURL of a public address: %v", err)
+	}
+
+	rc := &receiver{status: http.StatusNoContent}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	clock := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store := &memStore{}
+	d := NewDispatcher(store, NewClient(5*time.Second))
+	d.now = func() time.Time { return clock }
+
+	del, err := d.SendTest(&types.Webhook{ID: 1, GroupID: 7, URL: srv.URL, Secret: "first-secret-0001", Active: true}, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if del.Status != types.DeliveryFailed || len(rc.requests) != 0 {
+		t.Errorf("a delivery to a loopback receiver should fail without reaching it: %+v", del)
+	}
+}
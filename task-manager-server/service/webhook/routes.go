@@ -0,0 +1,348 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/SibHelly/task-manager-server/service/auth"
+	"github.com/SibHelly/task-manager-server/types"
+	"github.com/SibHelly/task-manager-server/utils"
+	"github.com/gorilla/mux"
+)
+
+const (
+	minSecretLen          = 16
+	defaultDeliveryLimit  = 50
+	maxDeliveryLimit      = 200
+	generatedSecretLength = 32
+)
+
+type Handler struct {
+	store      types.WebhookStore
+	dispatcher *Dispatcher
+	groupStore types.GroupStore
+	userStore  types.UserStore
+}
+
+func NewHandler(store types.WebhookStore, dispatcher *Dispatcher, groupStore types.GroupStore, userStore types.UserStore) *Handler {
+	return &Handler{store: store, dispatcher: dispatcher, groupStore: groupStore, userStore: userStore}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/webhooks/events", auth.WithJWTAuth(h.handleGetEventTypes, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/webhooks/group/{groupID}", auth.WithJWTAuth(h.handleGetWebhooks, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/webhooks/group/{groupID}", auth.WithJWTAuth(h.handleCreateWebhook, h.userStore)).Methods(http.MethodPost)
+	router.HandleFunc("/webhooks/{webhookID}", auth.WithJWTAuth(h.handleGetWebhook, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/webhooks/{webhookID}", auth.WithJWTAuth(h.handleUpdateWebhook, h.userStore)).Methods(http.MethodPut)
+	router.HandleFunc("/webhooks/{webhookID}", auth.WithJWTAuth(h.handleDeleteWebhook, h.userStore)).Methods(http.MethodDelete)
+	router.HandleFunc("/webhooks/{webhookID}/deliveries", auth.WithJWTAuth(h.handleGetDeliveries, h.userStore)).Methods(http.MethodGet)
+	router.HandleFunc("/webhooks/{webhookID}/test", auth.WithJWTAuth(h.handleTestWebhook, h.userStore)).Methods(http.MethodPost)
+}
+
+func (h *Handler) handleGetEventTypes(w http.ResponseWriter, r *http.Request) {
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Get event types",
+		"events": types.EventTypes,
+	})
+}
+
+func (h *Handler) handleGetWebhooks(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	groupID, ok := h.groupFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	hooks, err := h.store.GetWebhooks(groupID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status":   "Get webhooks",
+		"webhooks": hooks,
+	})
+}
+
+func (h *Handler) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	groupID, ok := h.groupFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	var create types.CreateWebhook
+	if err := utils.ParseJSON(r, &create); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validateURL(create.URL); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	events, err := validateEvents(create.Events)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	create.Events = events
+
+	secret := create.Secret
+	if secret == "" {
+		secret, err = newSecret()
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+	} else if len(secret) < minSecretLen {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("secret must be at least %d characters", minSecretLen))
+		return
+	}
+
+	id, err := h.store.CreateWebhook(groupID, userID, create, secret)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusCreated, map[string]interface{}{
+		"Status":     "Webhook created",
+		"webhook_id": id,
+		"secret":     secret,
+	})
+}
+
+func (h *Handler) handleGetWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	hook, ok := h.webhookFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, hook)
+}
+
+func (h *Handler) handleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	hook, ok := h.webhookFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	var update types.UpdateWebhook
+	if err := utils.ParseJSON(r, &update); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if update.URL != nil {
+		if err := validateURL(*update.URL); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if update.Events != nil {
+		events, err := validateEvents(update.Events)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		update.Events = events
+	}
+
+	err := h.store.UpdateWebhook(hook.ID, update)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Webhook updated",
+	})
+}
+
+func (h *Handler) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	hook, ok := h.webhookFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	err := h.store.DeleteWebhook(hook.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status": "Webhook deleted",
+	})
+}
+
+func (h *Handler) handleGetDeliveries(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	hook, ok := h.webhookFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	limit := defaultDeliveryLimit
+	if str := r.URL.Query().Get("limit"); str != "" {
+		n, err := strconv.Atoi(str)
+		if err != nil || n < 1 || n > maxDeliveryLimit {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxDeliveryLimit))
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := h.store.GetDeliveries(hook.ID, limit)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status":     "Get deliveries",
+		"deliveries": deliveries,
+	})
+}
+
+func (h *Handler) handleTestWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	hook, ok := h.webhookFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	delivery, err := h.dispatcher.SendTest(hook, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"Status":   "Test event sent",
+		"delivery": delivery,
+	})
+}
+
+// groupFromRequest reads the group ID from the route and checks the user may
+// manage the group's webhooks.
+func (h *Handler) groupFromRequest(w http.ResponseWriter, r *http.Request, userID int) (int, bool) {
+	vars := mux.Vars(r)
+	str, ok := vars["groupID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing group ID"))
+		return 0, false
+	}
+
+	groupID, err := strconv.Atoi(str)
+	if err != nil || groupID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid group ID"))
+		return 0, false
+	}
+
+	if !h.canManageGroup(groupID, userID) {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("only the group owner or an editor can manage webhooks"))
+		return 0, false
+	}
+
+	return groupID, true
+}
+
+// webhookFromRequest loads the webhook from the route and checks the user
+// may manage it.
+func (h *Handler) webhookFromRequest(w http.ResponseWriter, r *http.Request, userID int) (*types.Webhook, bool) {
+	vars := mux.Vars(r)
+	str, ok := vars["webhookID"]
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing webhook ID"))
+		return nil, false
+	}
+
+	webhookID, err := strconv.Atoi(str)
+	if err != nil || webhookID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid webhook ID"))
+		return nil, false
+	}
+
+	hook, err := h.store.GetWebhookByID(webhookID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return nil, false
+	}
+
+	if !h.canManageGroup(hook.GroupID, userID) {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("only the group owner or an editor can manage webhooks"))
+		return nil, false
+	}
+
+	return hook, true
+}
+
+func (h *Handler) canManageGroup(groupID, userID int) bool {
+	role, err := h.groupStore.GetUserRole(groupID, userID)
+	return err == nil && (role == "owner" || role == "editor")
+}
+
+// validateURL accepts absolute http or https URLs whose host only resolves
+// to public addresses. The address is checked again on every delivery, see
+// NewClient.
+func validateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+
+	ips, err := net.LookupIP(u.Hostname())
+	if err != nil {
+		return fmt.Errorf("url host can not be resolved")
+	}
+	for _, ip := range ips {
+		if !publicIP(ip) {
+			return errPrivateAddress
+		}
+	}
+	return nil
+}
+
+// validateEvents checks the event types and drops repeats.
+func validateEvents(events []string) ([]string, error) {
+	if len(events) == 0 {
+		return nil, fmt.Errorf("subscribe to at least one event")
+	}
+
+	known := make(map[string]bool, len(types.EventTypes))
+	for _, e := range types.EventTypes {
+		known[e] = true
+	}
+
+	out := make([]string, 0, len(events))
+	seen := make(map[string]bool)
+	for _, e := range events {
+		if !known[e] {
+			return nil, fmt.Errorf("unknown event: %s", e)
+		}
+		if !seen[e] {
+			seen[e] = true
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, generatedSecretLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
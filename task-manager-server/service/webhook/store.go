@@ -0,0 +1,299 @@
+package webhook
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/SibHelly/task-manager-server/types"
+)
+
+const webhookSelect = `SELECT w.webhook_id, w.group_id, w.url, w.secret, w.events,
+	w.is_active, COALESCE(w.created_by, 0), w.created_at
+	FROM webhooks w`
+
+const deliverySelect = `SELECT d.delivery_id, d.webhook_id, d.event_type, d.payload, d.status,
+	d.attempts, d.next_attempt_at, d.last_attempt_at, COALESCE(d.response_code, 0),
+	COALESCE(d.error, ''), d.created_at, w.url, w.secret
+	FROM webhook_deliveries d
+	JOIN webhooks w ON w.webhook_id = d.webhook_id`
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) GetWebhooks(groupID int) ([]types.Webhook, error) {
+	rows, err := s.db.Query(webhookSelect+" WHERE w.group_id = ? ORDER BY w.webhook_id", groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := make([]types.Webhook, 0)
+	for rows.Next() {
+		h, err := scanRowsIntoWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, *h)
+	}
+
+	return hooks, rows.Err()
+}
+
+func (s *Store) GetWebhookByID(webhookID int) (*types.Webhook, error) {
+	rows, err := s.db.Query(webhookSelect+" WHERE w.webhook_id = ?", webhookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	h := new(types.Webhook)
+	for rows.Next() {
+		h, err = scanRowsIntoWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if h.ID == 0 {
+		return nil, fmt.Errorf("webhook not found")
+	}
+	return h, nil
+}
+
+func (s *Store) CreateWebhook(groupID, userID int, w types.CreateWebhook, secret string) (int, error) {
+	events, err := json.Marshal(w.Events)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := s.db.Exec("INSERT INTO webhooks (group_id, url, secret, events, created_by) VALUES (?, ?, ?, ?, ?)",
+		groupID, w.URL, secret, events, nullIfZero(userID))
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+func (s *Store) UpdateWebhook(webhookID int, w types.UpdateWebhook) error {
+	if w.URL != nil {
+		if _, err := s.db.Exec("UPDATE webhooks SET url = ? WHERE webhook_id = ?", *w.URL, webhookID); err != nil {
+			return err
+		}
+	}
+	if w.Events != nil {
+		events, err := json.Marshal(w.Events)
+		if err != nil {
+			return err
+		}
+		if _, err := s.db.Exec("UPDATE webhooks SET events = ? WHERE webhook_id = ?", events, webhookID); err != nil {
+			return err
+		}
+	}
+	if w.Active != nil {
+		if _, err := s.db.Exec("UPDATE webhooks SET is_active = ? WHERE webhook_id = ?", *w.Active, webhookID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) DeleteWebhook(webhookID int) error {
+	_, err := s.db.Exec("DELETE FROM webhooks WHERE webhook_id = ?", webhookID)
+	return err
+}
+
+func (s *Store) EnqueueDelivery(webhookID int, eventType string, payload []byte, nextAttempt time.Time) (int, error) {
+	res, err := s.db.Exec(`INSERT INTO webhook_deliveries (webhook_id, event_type, payload, status, next_attempt_at, created_at)
+	VALUES (?, ?, ?, ?, ?, ?)`, webhookID, eventType, payload, types.DeliveryPending, nextAttempt, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// ClaimDueDeliveries takes up to limit pending deliveries of active webhooks
+// whose time has come and pushes their next attempt lease into the future,
+// so no other dispatcher picks them up while they are being sent.
+func (s *Store) ClaimDueDeliveries(now time.Time, lease time.Duration, limit int) ([]types.Delivery, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(deliverySelect+`
+	WHERE d.status = ? AND d.next_attempt_at <= ? AND w.is_active
+	ORDER BY d.next_attempt_at, d.delivery_id
+	LIMIT ?
+	FOR UPDATE OF d SKIP LOCKED`, types.DeliveryPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]types.Delivery, 0)
+	for rows.Next() {
+		d, err := scanRowsIntoDelivery(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range deliveries {
+		deliveries[i].NextAttemptAt = now.Add(lease)
+		_, err := tx.Exec("UPDATE webhook_deliveries SET next_attempt_at = ? WHERE delivery_id = ?",
+			deliveries[i].NextAttemptAt, deliveries[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return deliveries, tx.Commit()
+}
+
+func (s *Store) RecordAttempt(deliveryID int, a types.DeliveryAttempt) error {
+	status := types.DeliveryPending
+	next := a.At
+	switch {
+	case a.Delivered:
+		status = types.DeliveryDelivered
+	case a.NextAttempt == nil:
+		status = types.DeliveryFailed
+	default:
+		next = *a.NextAttempt
+	}
+
+	_, err := s.db.Exec(`UPDATE webhook_deliveries
+	SET status = ?, attempts = attempts + 1, last_attempt_at = ?, next_attempt_at = ?,
+		response_code = ?, error = ?
+	WHERE delivery_id = ?`,
+		status, a.At, next, nullIfZero(a.ResponseCode), nullIfEmpty(a.Error), deliveryID)
+	return err
+}
+
+func (s *Store) GetDelivery(deliveryID int) (*types.Delivery, error) {
+	rows, err := s.db.Query(deliverySelect+" WHERE d.delivery_id = ?", deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	d := new(types.Delivery)
+	for rows.Next() {
+		d, err = scanRowsIntoDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if d.ID == 0 {
+		return nil, fmt.Errorf("delivery not found")
+	}
+	return d, nil
+}
+
+// GetDeliveries returns the latest deliveries of the webhook, newest first.
+func (s *Store) GetDeliveries(webhookID, limit int) ([]types.Delivery, error) {
+	rows, err := s.db.Query(deliverySelect+`
+	WHERE d.webhook_id = ?
+	ORDER BY d.created_at DESC, d.delivery_id DESC
+	LIMIT ?`, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]types.Delivery, 0)
+	for rows.Next() {
+		d, err := scanRowsIntoDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func scanRowsIntoWebhook(rows *sql.Rows) (*types.Webhook, error) {
+	h := new(types.Webhook)
+	var events []byte
+
+	err := rows.Scan(
+		&h.ID,
+		&h.GroupID,
+		&h.URL,
+		&h.Secret,
+		&events,
+		&h.Active,
+		&h.CreatedBy,
+		&h.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(events, &h.Events); err != nil {
+		return nil, fmt.Errorf("webhook %d has broken events: %w", h.ID, err)
+	}
+
+	return h, nil
+}
+
+func scanRowsIntoDelivery(rows *sql.Rows) (*types.Delivery, error) {
+	d := new(types.Delivery)
+	var last sql.NullTime
+
+	err := rows.Scan(
+		&d.ID,
+		&d.WebhookID,
+		&d.EventType,
+		&d.Payload,
+		&d.Status,
+		&d.Attempts,
+		&d.NextAttemptAt,
+		&last,
+		&d.ResponseCode,
+		&d.Error,
+		&d.CreatedAt,
+		&d.URL,
+		&d.Secret,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if last.Valid {
+		d.LastAttemptAt = &last.Time
+	}
+
+	return d, nil
+}
+
+func nullIfZero(i int) interface{} {
+	if i == 0 {
+		return nil
+	}
+	return i
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -3,18 +3,23 @@ package types
 type CategoryStore interface {
 	GetCategories(userID int, flag bool) ([]Category, error)
 	CreateCategory(userID int, category CreateCategory, flag bool) error
-	DeleteCategory(categoryID int) error
+	DeleteCategory(categoryID, replaceWith int) (int64, error)
+	GetCategoryUsage(categoryID int) (*TaskUsage, error)
+	SameCategoryScope(categoryID, otherID int) (bool, error)
 	UpdateCategory(categoryID int, p CreateCategory) error
 	GetCategory(ID int, category string, flag bool) (*Category, error)
 	GetCategoryID(ID int, category string, flag bool) (*int, error)
 	GetCategoryByID(categoryID int) (*Category, error)
 }
 
+// Category belongs to either a user or a group.
 type Category struct {
 	ID          int    `json:"category_id"`
 	Name        string `json:"category_name"`
 	Description string `json:"description"`
 	Color       string `json:"color"`
+	UserID      int    `json:"user_id,omitempty"`
+	GroupID     int    `json:"group_id,omitempty"`
 }
 
 type CreateCategory struct {
@@ -0,0 +1,43 @@
+package types
+
+import "time"
+
+type ChecklistStore interface {
+	GetItems(taskID int) ([]ChecklistItem, error)
+	GetItemByID(itemID int) (*ChecklistItem, error)
+	CreateItem(taskID int, text string) error
+	UpdateItem(itemID int, text string) error
+	SetChecked(itemID, userID int, checked bool) error
+	ReorderItems(taskID int, itemIDs []int) error
+	DeleteItem(itemID int) error
+}
+
+// ChecklistItem is a to-do line inside a task, lighter than a subtask.
+type ChecklistItem struct {
+	ID        int        `json:"item_id"`
+	TaskID    int        `json:"task_id"`
+	Text      string     `json:"item_text"`
+	Position  int        `json:"position"`
+	Checked   bool       `json:"is_checked"`
+	CheckedBy int        `json:"checked_by,omitempty"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+}
+
+type CreateChecklistItem struct {
+	Text string `json:"item_text"`
+}
+
+type CheckChecklistItem struct {
+	Checked bool `json:"is_checked"`
+}
+
+type ReorderChecklist struct {
+	ItemIDs []int `json:"item_ids"`
+}
+
+// ChecklistProgress sums up a task's checklist; Percent is rounded down.
+type ChecklistProgress struct {
+	Total   int `json:"total"`
+	Checked int `json:"checked"`
+	Percent int `json:"percent"`
+}
@@ -0,0 +1,48 @@
+package types
+
+import "time"
+
+// Event types.
+const (
+	EventTaskCreated            = "task.created"
+	EventTaskUpdated            = "task.updated"
+	EventTaskStatusChanged      = "task.status_changed"
+	EventTaskFinished           = "task.finished"
+	EventTaskDeleted            = "task.deleted"
+	EventTaskResponsibleChanged = "task.responsible_changed"
+	EventCommentAdded           = "comment.added"
+	EventMemberAdded            = "group.member_added"
+	EventMemberRemoved          = "group.member_removed"
+	EventMemberRoleChanged      = "group.member_role_changed"
+)
+
+// EventTypes lists every event type, in the order clients see them.
+var EventTypes = []string{
+	EventTaskCreated,
+	EventTaskUpdated,
+	EventTaskStatusChanged,
+	EventTaskFinished,
+	EventTaskDeleted,
+	EventTaskResponsibleChanged,
+	EventCommentAdded,
+	EventMemberAdded,
+	EventMemberRemoved,
+	EventMemberRoleChanged,
+}
+
+// Event is something that happened to a task or a group. Recipients are the
+// users to tell about a task event: the task's responsible users and
+// watchers, without the user who caused it. Group events leave TaskID 0.
+type Event struct {
+	Type       string                 `json:"type"`
+	TaskID     int                    `json:"task_id,omitempty"`
+	GroupID    int                    `json:"group_id,omitempty"`
+	ActorID    int                    `json:"actor_id"`
+	Recipients []int                  `json:"recipients"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+	At         time.Time              `json:"at"`
+}
+
+type EventPublisher interface {
+	Publish(e Event)
+}
@@ -14,12 +14,34 @@ type GroupStore interface {
 	GetGroupOwner(group_id int) (string, error)
 	GetUserRole(group_id, user_id int) (string, error)
 	UpdateUserRole(user_id, group_id int, role string) error
+	SetRequire2FA(group_id int, required bool) error
+	GetMembersWithout2FA(group_id int) ([]UsersGroup, error)
 }
 
+// Group is a team. With Require2FA, members without two-factor
+// authentication lose their role and the group's tasks until they turn it
+// on.
 type Group struct {
-	ID   int    `json:"group_id"`
-	Name string `json:"group_name"`
-	Info string `json:"info"`
+	ID         int    `json:"group_id"`
+	Name       string `json:"group_name"`
+	Info       string `json:"info"`
+	Require2FA bool   `json:"require_2fa"`
+}
+
+// MemberCond is an SQL condition true when the user in its one parameter is
+// a member of the group in groupColumn. A member without 2FA in a group that
+// requires it does not count, so they lose the group's tasks along with
+// their role.
+func MemberCond(groupColumn string) string {
+	return `EXISTS (SELECT 1 FROM inclusions mi
+		JOIN ` + "`groups`" + ` mg ON mg.group_id = mi.group_id
+		JOIN users mu ON mu.user_id = mi.user_id
+		WHERE mi.group_id = ` + groupColumn + ` AND mi.user_id = ?
+			AND (NOT mg.require_2fa OR mu.totp_enabled))`
+}
+
+type Require2FAPayload struct {
+	Required bool `json:"require_2fa"`
 }
 
 type CreateGroup struct {
@@ -33,10 +55,13 @@ type Member struct {
 	Role string `json:"role"`
 }
 
+// UsersGroup is a member of a group. Phone and Email are empty when the
+// member's contact visibility hides them.
 type UsersGroup struct {
 	ID    int    `json:"member_id"`
 	Name  string `json:"name"`
 	Role  string `json:"role"`
 	Info  string `json:"info"`
 	Phone string `json:"phone"`
+	Email string `json:"email,omitempty"`
 }
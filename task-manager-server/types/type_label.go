@@ -0,0 +1,38 @@
+package types
+
+type LabelStore interface {
+	GetLabels(ID int, flag bool) ([]Label, error)
+	GetLabel(ID int, name string, flag bool) (*Label, error)
+	GetLabelByID(labelID int) (*Label, error)
+	CreateLabel(ID int, l CreateLabel, flag bool) error
+	UpdateLabel(labelID int, l CreateLabel) error
+	MergeLabels(sourceID, targetID int) (int64, error)
+	DeleteLabel(labelID int) error
+
+	GetTaskLabels(taskID int) ([]Label, error)
+	AttachLabels(taskID int, labelIDs []int) error
+	DetachLabel(taskID, labelID int) error
+}
+
+// A label belongs either to a user or to a group.
+type Label struct {
+	ID      int    `json:"label_id"`
+	Name    string `json:"label_name"`
+	Color   string `json:"color"`
+	UserID  int    `json:"user_id,omitempty"`
+	GroupID int    `json:"group_id,omitempty"`
+}
+
+type CreateLabel struct {
+	Name  string `json:"label_name"`
+	Color string `json:"color"`
+}
+
+type MergeLabels struct {
+	SourceID int `json:"source_id"`
+	TargetID int `json:"target_id"`
+}
+
+type AttachLabels struct {
+	LabelIDs []int `json:"label_ids"`
+}
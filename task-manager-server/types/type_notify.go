@@ -0,0 +1,15 @@
+package types
+
+// Message is a text for one user, such as a password reset code. To is the
+// address the sender understands; for now that is the user's phone.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// MessageSender delivers messages to users. The notify package has senders
+// for local development; production ones plug in here.
+type MessageSender interface {
+	Send(m Message) error
+}
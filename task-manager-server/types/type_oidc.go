@@ -0,0 +1,33 @@
+package types
+
+import "context"
+
+// IdentityProvider is an OpenID Connect provider users can log in with.
+// service/auth.OIDCProvider talks to a real one.
+type IdentityProvider interface {
+	// Issuer names the provider in the identities linked to users.
+	Issuer() string
+	// AuthURL is where the browser goes to log in, with PKCE.
+	AuthURL(state, nonce, codeChallenge string) (string, error)
+	// Exchange trades the code the provider sent back for the verified
+	// identity of the user.
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error)
+}
+
+// Identity is what the provider vouches for. Phone and Email are only to be
+// trusted for linking when their Verified flag is set.
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Name          string
+	Phone         string
+	PhoneVerified bool
+	Email         string
+	EmailVerified bool
+}
+
+type OIDCCallbackPayload struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+	Flow  string `json:"flow"`
+}
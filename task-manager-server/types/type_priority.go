@@ -1,22 +1,35 @@
 package types
 
 type PriorityStore interface {
-	GetPriorities() ([]Priority, error)
-	CreatePriority(CreatePriority) error
-	DeletePriority(priorityID int) error
+	GetPriorities(ID int, flag bool) ([]Priority, error)
+	CreatePriority(ID int, p CreatePriority, flag bool) error
+	DeletePriority(priorityID, replaceWith int) (int64, error)
+	GetPriorityUsage(priorityID int) (*TaskUsage, error)
 	UpdatePriority(priorityID int, p CreatePriority) error
-	GetPriority(priority string) (*Priority, error)
+	ReorderPriorities(priorityIDs []int) error
+	GetPriority(ID int, priority string, flag bool) (*Priority, error)
 	GetPriorityByID(priorityID int) (*Priority, error)
 	GetPriorityIDbyName(name string) (*int, error)
 }
 
+// Priorities without a user or group are system defaults visible to everyone.
 type Priority struct {
-	ID    int    `json:"priority_id"`
-	Name  string `json:"priority_name"`
-	Color string `json:"color"`
+	ID       int    `json:"priority_id"`
+	Name     string `json:"priority_name"`
+	Color    string `json:"color"`
+	Weight   int    `json:"weight"`
+	Position int    `json:"position"`
+	UserID   int    `json:"user_id,omitempty"`
+	GroupID  int    `json:"group_id,omitempty"`
 }
 
 type CreatePriority struct {
-	Name  string `json:"priority_name"`
-	Color string `json:"color"`
+	Name     string `json:"priority_name"`
+	Color    string `json:"color"`
+	Weight   int    `json:"weight"`
+	Position int    `json:"position"`
+}
+
+type ReorderPriorities struct {
+	PriorityIDs []int `json:"priority_ids"`
 }
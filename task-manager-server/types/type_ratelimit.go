@@ -0,0 +1,15 @@
+package types
+
+import "time"
+
+// RateLimitStore counts hits per key in fixed windows. The ratelimit package
+// has an in-memory store; a shared one lets several servers count together.
+type RateLimitStore interface {
+	// Incr adds a hit to the key's window, starting a new window of the
+	// given length if there is none, and returns the hits so far and when
+	// the window ends.
+	Incr(key string, window time.Duration, now time.Time) (int, time.Time, error)
+	// Get returns the hits in the key's window, or 0 when there is none.
+	Get(key string, now time.Time) (int, time.Time, error)
+	Reset(key string) error
+}
@@ -0,0 +1,38 @@
+package types
+
+// SearchEngine finds the tasks, chats and comments a user can see by free
+// text. The MySQL FULLTEXT store in service/search is the default engine.
+type SearchEngine interface {
+	Search(userID int, q SearchQuery) (*SearchResults, error)
+}
+
+const (
+	SearchTypeTask    = "task"
+	SearchTypeChat    = "chat"
+	SearchTypeComment = "comment"
+)
+
+// SearchQuery is a parsed search request. An empty Types searches everything.
+type SearchQuery struct {
+	Text   string
+	Types  []string
+	Limit  int
+	Offset int
+}
+
+// SearchResult is one hit. Snippet is HTML-escaped text with the matched
+// words wrapped in <mark>.
+type SearchResult struct {
+	Type    string  `json:"type"`
+	ID      int     `json:"id"`
+	TaskID  int     `json:"task_id"`
+	ChatID  int     `json:"chat_id,omitempty"`
+	Title   string  `json:"title"`
+	Snippet string  `json:"snippet"`
+	Score   float64 `json:"score"`
+}
+
+type SearchResults struct {
+	Total   int            `json:"total"`
+	Results []SearchResult `json:"results"`
+}
@@ -0,0 +1,47 @@
+package types
+
+import "time"
+
+type StatsStore interface {
+	GetStats(scope StatsScope, q StatsQuery) (*Stats, error)
+}
+
+// StatsScope selects the tasks the statistics are computed over: the tasks a
+// user is responsible for, or the tasks of a group.
+type StatsScope struct {
+	UserID  int
+	GroupID int
+}
+
+type StatsQuery struct {
+	Weeks int
+	From  time.Time
+	To    time.Time
+}
+
+type Stats struct {
+	ByStatus         []StatCount     `json:"by_status"`
+	ByPriority       []StatCount     `json:"by_priority"`
+	ByCategory       []StatCount     `json:"by_category"`
+	Overdue          int             `json:"overdue"`
+	CompletedPerWeek []WeekCount     `json:"completed_per_week"`
+	AvgCycleTime     float64         `json:"avg_cycle_time_hours"`
+	Burndown         []BurndownPoint `json:"burndown"`
+}
+
+type StatCount struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type WeekCount struct {
+	WeekStart string `json:"week_start"`
+	Count     int    `json:"count"`
+}
+
+type BurndownPoint struct {
+	Day       string `json:"day"`
+	Remaining int    `json:"remaining"`
+	Completed int    `json:"completed"`
+}
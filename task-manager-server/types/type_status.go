@@ -1,19 +1,37 @@
 package types
 
 type StatusStore interface {
-	GetStatuses() ([]Status, error)
-	CreateStatus(CreateStatus) error
-	DeleteStatus(statusID int) error
+	GetStatuses(ID int, flag bool) ([]Status, error)
+	CreateStatus(ID int, st CreateStatus, flag bool) error
+	DeleteStatus(statusID, replaceWith int) (int64, error)
+	GetStatusUsage(statusID int) (*TaskUsage, error)
 	UpdateStatus(statusID int, st CreateStatus) error
-	GetStatus(status string) (*Status, error)
+	ReorderStatuses(statusIDs []int) error
+	GetStatus(ID int, status string, flag bool) (*Status, error)
 	GetStatusByID(statusID int) (*Status, error)
 	GetStatusIDbyName(name string) (*int, error)
 }
 
+// Statuses without a user or group are system defaults visible to everyone.
 type Status struct {
-	ID     int    `json:"status_id"`
-	Status string `json:"status"`
+	ID        int    `json:"status_id"`
+	Status    string `json:"status"`
+	IsFinal   bool   `json:"is_final"`
+	IsBlocked bool   `json:"is_blocked"`
+	Color     string `json:"color"`
+	Position  int    `json:"position"`
+	UserID    int    `json:"user_id,omitempty"`
+	GroupID   int    `json:"group_id,omitempty"`
 }
+
 type CreateStatus struct {
-	Status string `json:"status"`
-}
\ No newline at end of file
+	Status    string `json:"status"`
+	IsFinal   bool   `json:"is_final"`
+	IsBlocked bool   `json:"is_blocked"`
+	Color     string `json:"color"`
+	Position  int    `json:"position"`
+}
+
+type ReorderStatuses struct {
+	StatusIDs []int `json:"status_ids"`
+}
@@ -5,13 +5,17 @@ import (
 )
 
 type TasksStore interface {
-	GetTasks(ID int, flag bool) ([]Task, error)
-	GetSubTasks(ID int) ([]Task, error)
-	GetAllTasksUser(ID int) ([]Task, error)
-	GetMostPriorityTasks(ID int) ([]Task, error)
+	GetTasks(ID int, flag bool, f TaskFilter) ([]Task, error)
+	GetSubTasks(ID int, f TaskFilter) ([]Task, error)
+	GetAllTasksUser(ID int, f TaskFilter) ([]Task, error)
+	GetMostPriorityTasks(ID int, limit int, f TaskFilter) ([]Task, error)
+	FindTasks(userID int, f TaskFilter, sort string) ([]Task, error)
+	GetBoard(b Board) ([]BoardColumn, error)
+	MoveTask(taskID int, b Board, m MoveTask) (string, error)
 
-	CreateTask(t CreateTask) error
-	AddSubtask(t CreateTask) error
+	CreateTask(t CreateTask) (int, error)
+	AddSubtask(t CreateTask) (int, error)
+	CreateTaskTree(t CreateTask) (int, error)
 
 	UpdateTask(t Task) error
 	UpdateTaskStatus(id, statusId int) error
@@ -22,21 +26,39 @@ type TasksStore interface {
 	GetTaskIdByName(name string, ID int, flag bool) (*int, error)
 	GetSubtaskByName(ParentID int, subtask_name string) (*Task, error)
 	GetResponsible(ID int) ([]ResponsibleUserID, error)
+	AddResponsible(taskID int, users []ResponsibleUserID, withSubtasks bool) error
+	RemoveResponsible(taskID int, users []ResponsibleUserID, withSubtasks bool) error
+	ReplaceResponsible(taskID int, users []ResponsibleUserID, withSubtasks bool) error
+
+	GetGroupWorkload(groupID int, from, to, now time.Time) ([]MemberWorkload, error)
 	GetTaskByID(ID int) (*Task, error)
+	CanAccessTask(taskID, userID int) (bool, error)
+
+	AddWatcher(taskID, userID int, reason string) error
+	RemoveWatcher(taskID, userID int) error
+	GetWatchers(taskID int) ([]Watcher, error)
+	GetWatchedTasks(userID int) ([]Task, error)
+	GetTaskRecipients(taskID int) ([]int, error)
+
+	DuplicateTask(taskID int, c TaskCopy) (int, error)
 }
 
 type Task struct {
-	ID             int       `json:"task_id"`
-	Name           string    `json:"task_name"`
-	Description    string    `json:"task_description"`
-	Priority_id    int       `json:"priority_id"`
-	Status_id      int       `json:"status_id"`
-	StartTime      time.Time `json:"start_time"`
-	EndTime        time.Time `json:"end_time"`
-	Attachments    string    `json:"attachments"`
-	Category_id    int       `json:"category_id"`
-	Parent_task_id int       `json:"parent_task_id"`
-	Group_id       int       `json:"group_id"`
+	ID             int                `json:"task_id"`
+	Name           string             `json:"task_name"`
+	Description    string             `json:"task_description"`
+	Priority_id    int                `json:"priority_id"`
+	Status_id      int                `json:"status_id"`
+	StartTime      time.Time          `json:"start_time"`
+	EndTime        time.Time          `json:"end_time"`
+	Attachments    string             `json:"attachments"`
+	Category_id    int                `json:"category_id"`
+	Parent_task_id int                `json:"parent_task_id"`
+	Group_id       int                `json:"group_id"`
+	Estimate       int                `json:"estimate"`
+	CreatedAt      time.Time          `json:"created_at"`
+	Position       string             `json:"position,omitempty"`
+	Checklist      *ChecklistProgress `json:"checklist,omitempty"`
 }
 
 type CreateTask struct {
@@ -50,6 +72,7 @@ type CreateTask struct {
 	Category_id    int                 `json:"category_id"`
 	Parent_task_id int                 `json:"parent_task_id"`
 	Group_id       int                 `json:"group_id"`
+	Estimate       int                 `json:"estimate"`
 	Responsible    []ResponsibleUserID `json:"responsible_users_id"`
 	Subtasks       []CreateTask        `json:"subtasks"`
 }
@@ -69,10 +92,107 @@ type TaskFull struct {
 	Subtasks       []TaskFull        `json:"subtasks"`
 }
 
+// Label filter modes: a task matches when it has any of the labels, all of
+// them, or none of them.
+const (
+	LabelModeAny  = "any"
+	LabelModeAll  = "all"
+	LabelModeNone = "none"
+)
+
+// TaskFilter narrows a task listing. The zero value matches every task; the
+// ID lists match tasks having any of the IDs.
+type TaskFilter struct {
+	Labels     []int  `json:"labels,omitempty"`
+	LabelMode  string `json:"label_mode,omitempty"`
+	Statuses   []int  `json:"statuses,omitempty"`
+	Priorities []int  `json:"priorities,omitempty"`
+	Categories []int  `json:"categories,omitempty"`
+	Groups     []int  `json:"groups,omitempty"`
+	OpenOnly   bool   `json:"open_only,omitempty"`
+	Overdue    bool   `json:"overdue,omitempty"`
+}
+
+// Board is a kanban board: the personal board of UserID or, when GroupID is
+// set, the board of that group. Cards keep their own order on every board.
+type Board struct {
+	UserID  int
+	GroupID int
+}
+
+// BoardColumn holds the cards of one status in board order. StatusID is 0
+// for tasks without a status.
+type BoardColumn struct {
+	StatusID int    `json:"status_id"`
+	Tasks    []Task `json:"tasks"`
+}
+
+// MoveTask puts a card into a status column between two neighbors. With only
+// PrevTaskID the card goes right after it, with only NextTaskID right before
+// it, and with neither to the end of the column.
+type MoveTask struct {
+	StatusID   int `json:"status_id"`
+	GroupID    int `json:"group_id"`
+	PrevTaskID int `json:"prev_task_id"`
+	NextTaskID int `json:"next_task_id"`
+}
+
 type ResponsibleUserID struct {
 	ID int64 `json:"responsible_id"`
 }
 
+// TaskUsage tells how many tasks reference a status, priority or category.
+type TaskUsage struct {
+	Tasks     int `json:"tasks"`
+	OpenTasks int `json:"open_tasks"`
+	Subtasks  int `json:"subtasks"`
+}
+
+// Why a user watches a task.
+const (
+	WatchManual  = "manual"
+	WatchComment = "comment"
+	WatchMention = "mention"
+)
+
+type Watcher struct {
+	UserID    int       `json:"user_id"`
+	Name      string    `json:"name"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DuplicateTask asks for a copy of a task and its subtasks. A nil GroupID
+// keeps the copy where the original is, 0 puts it into the caller's personal
+// list and any other value into that group. OffsetDays shifts the start and
+// end times.
+type DuplicateTask struct {
+	GroupID     *int                `json:"group_id"`
+	Name        string              `json:"task_name"`
+	OffsetDays  int                 `json:"offset_days"`
+	Responsible []ResponsibleUserID `json:"responsible_users_id"`
+	WithChats   bool                `json:"with_chats"`
+}
+
+// TaskCopy is a resolved DuplicateTask. A nil Responsible copies every
+// task's own responsible users; otherwise the whole copy gets these users.
+// Priority, status, category and labels only make sense in the original's
+// scope and are dropped unless SameScope is set.
+type TaskCopy struct {
+	Name        string
+	ParentID    int
+	GroupID     int
+	OffsetDays  int
+	Responsible []ResponsibleUserID
+	SameScope   bool
+	WithChats   bool
+}
+
+type UpdateResponsible struct {
+	Responsible []ResponsibleUserID `json:"responsible_users_id"`
+	Subtasks    bool                `json:"subtasks"`
+}
+
 type ResponsibleUser struct {
 	Name string `json:"responsible_name"`
 }
@@ -83,4 +203,28 @@ type CreateSubtask struct {
 	Priority_id    int    `json:"priority_id"`
 	Status_id      int    `json:"status_id"`
 	Parent_task_id int    `json:"parent_task_id"`
+	Estimate       int    `json:"estimate"`
+}
+
+// MemberWorkload summarizes the open tasks of one group member.
+// Estimate is the total estimated effort in minutes.
+type MemberWorkload struct {
+	ID           int             `json:"member_id"`
+	Name         string          `json:"name"`
+	Role         string          `json:"role"`
+	OpenTasks    int             `json:"open_tasks"`
+	OverdueTasks int             `json:"overdue_tasks"`
+	Estimate     int             `json:"estimate"`
+	ByPriority   []PriorityCount `json:"by_priority"`
+	DueByDay     []DayCount      `json:"due_by_day"`
+}
+
+type PriorityCount struct {
+	PriorityID int `json:"priority_id"`
+	Count      int `json:"count"`
+}
+
+type DayCount struct {
+	Day   string `json:"day"`
+	Count int    `json:"count"`
 }
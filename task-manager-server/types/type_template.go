@@ -0,0 +1,55 @@
+package types
+
+import "time"
+
+type TemplateStore interface {
+	GetTemplates(ID int, flag bool) ([]Template, error)
+	GetTemplate(ID int, name string, flag bool) (*Template, error)
+	GetTemplateByID(templateID int) (*Template, error)
+	CreateTemplate(ID int, t CreateTemplate, flag bool) error
+	UpdateTemplate(templateID int, t CreateTemplate) error
+	DeleteTemplate(templateID int) error
+}
+
+// Template is a saved task tree belonging to a user or to a group.
+type Template struct {
+	ID        int          `json:"template_id"`
+	Name      string       `json:"template_name"`
+	UserID    int          `json:"user_id,omitempty"`
+	GroupID   int          `json:"group_id,omitempty"`
+	Task      TemplateTask `json:"task"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// TemplateTask is one task of a template. Names and descriptions may hold
+// {{variables}}; dates are kept as whole days after the start the template
+// is used with, nil for no date.
+type TemplateTask struct {
+	Name            string         `json:"task_name"`
+	Description     string         `json:"task_description"`
+	Priority_id     int            `json:"priority_id"`
+	Status_id       int            `json:"status_id"`
+	Category_id     int            `json:"category_id"`
+	Attachments     string         `json:"attachments"`
+	Estimate        int            `json:"estimate"`
+	StartOffsetDays *int           `json:"start_offset_days"`
+	DueOffsetDays   *int           `json:"due_offset_days"`
+	Subtasks        []TemplateTask `json:"subtasks"`
+}
+
+type CreateTemplate struct {
+	Name string       `json:"template_name"`
+	Task TemplateTask `json:"task"`
+}
+
+type SaveTemplate struct {
+	Name string `json:"template_name"`
+}
+
+// UseTemplate instantiates a template. StartTime defaults to now; group
+// templates need the responsible users like any group task.
+type UseTemplate struct {
+	StartTime   time.Time           `json:"start_time"`
+	Variables   map[string]string   `json:"variables"`
+	Responsible []ResponsibleUserID `json:"responsible_users_id"`
+}
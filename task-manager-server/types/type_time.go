@@ -0,0 +1,66 @@
+package types
+
+import "time"
+
+type TimeEntryStore interface {
+	StartTimer(userID, taskID int) (*TimeEntry, error)
+	StopTimer(userID int) (*TimeEntry, error)
+	GetRunningTimer(userID int) (*TimeEntry, error)
+
+	CreateEntry(e CreateTimeEntry) (*TimeEntry, error)
+	GetEntry(entryID int) (*TimeEntry, error)
+	UpdateEntry(entryID int, e CreateTimeEntry) error
+	DeleteEntry(entryID int) error
+
+	GetTaskEntries(taskID int) ([]TimeEntry, error)
+	GetTaskTotals(taskID int) (*TimeTotals, error)
+	GetReport(f TimeReportFilter) ([]TimeReportRow, error)
+}
+
+// Durations are in seconds. A running timer has no EndedAt and its duration
+// is counted up to now.
+type TimeEntry struct {
+	ID        int        `json:"entry_id"`
+	TaskID    int        `json:"task_id"`
+	UserID    int        `json:"user_id"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+	Duration  int64      `json:"duration"`
+	Note      string     `json:"note"`
+}
+
+type CreateTimeEntry struct {
+	TaskID    int       `json:"task_id"`
+	UserID    int       `json:"user_id"`
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"`
+	Note      string    `json:"note"`
+}
+
+type TimeTotals struct {
+	TaskID int   `json:"task_id"`
+	Own    int64 `json:"own_duration"`
+	Total  int64 `json:"total_duration"`
+}
+
+type TimeReportFilter struct {
+	From       time.Time
+	To         time.Time
+	GroupID    int
+	UserID     int
+	CategoryID int
+}
+
+type TimeReportRow struct {
+	EntryID    int        `json:"entry_id"`
+	UserID     int        `json:"user_id"`
+	UserName   string     `json:"user_name"`
+	TaskID     int        `json:"task_id"`
+	TaskName   string     `json:"task_name"`
+	GroupID    int        `json:"group_id"`
+	CategoryID int        `json:"category_id"`
+	StartedAt  time.Time  `json:"started_at"`
+	EndedAt    *time.Time `json:"ended_at"`
+	Duration   int64      `json:"duration"`
+	Note       string     `json:"note"`
+}
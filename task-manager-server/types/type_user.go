@@ -1,10 +1,53 @@
 package types
 
+import "time"
+
 type UserStore interface {
 	GetUserByPhone(phone string) (*User, error)
+	GetUserByEmail(email string) (*User, error)
 	GetUserIdByName(name string) (*int, error)
 	GetUserById(id int) (*User, error)
 	CreateUser(User) error
+	UpdateUser(User) error
+	SetAvatar(userID int, avatar string) error
+	DeleteUser(userID int) (*AccountDeletion, error)
+	SearchUsers(callerID int, q UserSearch) ([]UserSearchResult, error)
+
+	SetEmail(userID int, email string) error
+	CreateEmailVerification(userID int, email, codeHash string, expiresAt time.Time) error
+	UseEmailVerification(userID int, codeHash string, now time.Time) (string, error)
+
+	SetTOTPSecret(userID int, secret string) error
+	EnableTOTP(userID int, step int64, recoveryHashes []string) error
+	DisableTOTP(userID int) error
+	UseTOTPStep(userID int, step int64) (bool, error)
+	ReplaceRecoveryCodes(userID int, hashes []string) error
+	UseRecoveryCode(userID int, hash string, now time.Time) (bool, error)
+	CountRecoveryCodes(userID int) (int, error)
+	TwoFactorRequired(userID int) (bool, error)
+
+	CreateSession(s Session) (int, error)
+	GetSession(sessionID int) (*Session, error)
+	GetSessions(userID int) ([]Session, error)
+	TouchSession(sessionID int, at time.Time) error
+	RevokeSession(userID, sessionID int) error
+	RevokeOtherSessions(userID, keepID int) (int, error)
+
+	GetUserByIdentity(issuer, subject string) (*User, error)
+	LinkIdentity(userID int, issuer, subject string) error
+	CreateOIDCUser(u User, issuer, subject string) (int, error)
+
+	CreateAPIToken(userID int, t CreateAPIToken, hash, prefix string) (int, error)
+	GetAPITokens(userID int) ([]APIToken, error)
+	GetAPITokenByHash(hash string) (*APIToken, error)
+	TouchAPIToken(tokenID int, at time.Time) error
+	RevokeAPIToken(userID, tokenID int) error
+
+	RecordLoginAttempt(a LoginAttempt) error
+
+	UpdatePassword(userID int, hash string) error
+	CreatePasswordReset(userID int, codeHash string, expiresAt time.Time) error
+	UsePasswordReset(userID int, codeHash string, now time.Time) (bool, error)
 }
 
 type User struct {
@@ -12,9 +55,93 @@ type User struct {
 	Name     string `json:"name"`
 	Info     string `json:"info"`
 	Phone    string `json:"phone"`
+	Password string `json:"-"`
+	// Avatar is the file name of the uploaded picture, served at
+	// /users/{userID}/avatar; empty when there is none.
+	Avatar   string `json:"avatar"`
+	Timezone string `json:"timezone"`
+	Locale   string `json:"locale"`
+	// Email is only set once the user proved it with a code, so it is
+	// always verified. Either it or the phone logs the user in.
+	Email string `json:"email"`
+	// Searchable lets users who share no group with this one find it by
+	// name in the user search.
+	Searchable bool `json:"searchable"`
+	// ContactVisibility is one of the Contact values: which of the phone and
+	// email other members of the user's groups see.
+	ContactVisibility string `json:"contact_visibility"`
+	// TOTPSecret is set once 2FA setup starts; the codes are only asked for
+	// after TOTPEnabled. TOTPLastStep is the step of the last code used.
+	TOTPSecret   string `json:"-"`
+	TOTPEnabled  bool   `json:"two_factor_enabled"`
+	TOTPLastStep int64  `json:"-"`
+	// TokenVersion goes into every JWT; bumping it signs the user out.
+	TokenVersion int `json:"-"`
+}
+
+// UpdateProfile changes the user's own profile. Fields left out stay as
+// they are.
+type UpdateProfile struct {
+	Name       *string `json:"name"`
+	Info       *string `json:"info"`
+	Phone      *string `json:"phone"`
+	Timezone   *string `json:"timezone"`
+	Locale     *string `json:"locale"`
+	Searchable *bool   `json:"searchable"`
+
+	ContactVisibility *string `json:"contact_visibility"`
+}
+
+// Which contacts of a user other members see.
+const (
+	ContactPhone = "phone"
+	ContactEmail = "email"
+	ContactBoth  = "both"
+	ContactNone  = "none"
+)
+
+type SetEmailPayload struct {
+	Email string `json:"email"`
+}
+
+type VerifyEmailPayload struct {
+	Code string `json:"code"`
+}
+
+// UserSearch is a parsed user search: Text is a name or phone prefix.
+// A non-zero GroupID keeps only the members of that group.
+type UserSearch struct {
+	Text    string
+	GroupID int
+	Limit   int
+}
+
+// UserSearchResult is a user found by the search. Phone and Email are only
+// filled for users who share a group with the caller and show that contact.
+type UserSearchResult struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Avatar      string `json:"avatar"`
+	Phone       string `json:"phone,omitempty"`
+	Email       string `json:"email,omitempty"`
+	SharesGroup bool   `json:"shares_group"`
+}
+
+type DeleteAccountPayload struct {
 	Password string `json:"password"`
 }
 
+// AccountDeletion tells what happened to the user's groups and tasks when
+// the account was deleted. Owned groups go to another member, or are
+// deleted when nobody else is in them. Group tasks the user was the only
+// responsible for go to the group owner; such personal tasks are deleted.
+type AccountDeletion struct {
+	TransferredGroups []int `json:"transferred_groups"`
+	DeletedGroups     []int `json:"deleted_groups"`
+	ReassignedTasks   []int `json:"reassigned_tasks"`
+	DeletedTasks      []int `json:"deleted_tasks"`
+}
+
 type RegisterUserPayload struct {
 	Name     string `json:"name"`
 	Info     string `json:"info"`
@@ -22,7 +149,98 @@ type RegisterUserPayload struct {
 	Password string `json:"password"`
 }
 
+// LoginUserPayload logs in with either the phone or the email.
 type LoginUserPayload struct {
 	Phone    string `json:"phone"`
+	Email    string `json:"email"`
 	Password string `json:"password"`
 }
+
+// APIToken lets scripts act as the user without logging in. Only a hash of
+// the token is kept; Prefix is its start, to tell tokens apart.
+type APIToken struct {
+	ID         int        `json:"token_id"`
+	UserID     int        `json:"-"`
+	Name       string     `json:"token_name"`
+	Prefix     string     `json:"token_prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreateAPIToken asks for a new token. Scopes look like "tasks:read" or
+// "tasks:write"; ExpiresInDays 0 means the token never expires.
+type CreateAPIToken struct {
+	Name          string   `json:"token_name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+type ChangePasswordPayload struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+type ForgotPasswordPayload struct {
+	Phone string `json:"phone"`
+}
+
+type ResetPasswordPayload struct {
+	Phone       string `json:"phone"`
+	Code        string `json:"code"`
+	NewPassword string `json:"new_password"`
+}
+
+// TwoFactorLoginPayload finishes a login that asked for a second factor.
+// Code is either a TOTP code or a recovery code.
+type TwoFactorLoginPayload struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+type TwoFactorCodePayload struct {
+	Code string `json:"code"`
+}
+
+type DisableTwoFactorPayload struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// Session is one login of the user, on one device. Its ID goes into the
+// JWT, so revoking the session ends the token.
+type Session struct {
+	ID         int        `json:"session_id"`
+	UserID     int        `json:"-"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"-"`
+	// Current marks the session of the request.
+	Current bool `json:"current"`
+}
+
+// Why a login failed.
+const (
+	LoginUnknownUser = "unknown_user"
+	LoginBadPassword = "bad_password"
+	LoginBadCode     = "bad_2fa_code"
+	LoginLocked      = "locked"
+	LoginRateLimited = "rate_limited"
+)
+
+// LoginAttempt is one entry of the login audit. Login is the phone or email
+// the user logged in with; UserID is 0 when it matched nobody. Reason is
+// empty for a successful login.
+type LoginAttempt struct {
+	Login   string
+	UserID  int
+	IP      string
+	Success bool
+	Reason  string
+	At      time.Time
+}
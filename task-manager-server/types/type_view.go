@@ -0,0 +1,57 @@
+package types
+
+import "time"
+
+type ViewStore interface {
+	GetViews(userID int) ([]View, error)
+	GetViewByID(viewID int) (*View, error)
+	GetView(userID int, name string) (*View, error)
+	CreateView(userID int, v CreateView) error
+	UpdateView(viewID int, v CreateView) error
+	DeleteView(viewID int) error
+}
+
+// Orders a saved view can list its tasks in.
+const (
+	SortDeadline = "deadline"
+	SortPriority = "priority"
+	SortCreated  = "created"
+	SortName     = "name"
+	SortFocus    = "focus"
+)
+
+// Fields a saved view can group its tasks by.
+const (
+	GroupByStatus   = "status"
+	GroupByPriority = "priority"
+	GroupByCategory = "category"
+	GroupByGroup    = "group"
+)
+
+// View is a saved task filter. Views with a GroupID are shared with the
+// members of that group; only the owner can change them.
+type View struct {
+	ID        int        `json:"view_id"`
+	UserID    int        `json:"user_id"`
+	GroupID   int        `json:"group_id,omitempty"`
+	Name      string     `json:"view_name"`
+	Filter    TaskFilter `json:"filter"`
+	Sort      string     `json:"sort"`
+	GroupBy   string     `json:"group_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type CreateView struct {
+	GroupID int        `json:"group_id"`
+	Name    string     `json:"view_name"`
+	Filter  TaskFilter `json:"filter"`
+	Sort    string     `json:"sort"`
+	GroupBy string     `json:"group_by"`
+}
+
+// TaskGroup holds the tasks of a grouped view sharing one value of the
+// grouping field; Key is 0 for tasks without one.
+type TaskGroup struct {
+	Key   int    `json:"key"`
+	Tasks []Task `json:"tasks"`
+}
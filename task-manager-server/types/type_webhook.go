@@ -0,0 +1,80 @@
+package types
+
+import "time"
+
+type WebhookStore interface {
+	GetWebhooks(groupID int) ([]Webhook, error)
+	GetWebhookByID(webhookID int) (*Webhook, error)
+	CreateWebhook(groupID, userID int, w CreateWebhook, secret string) (int, error)
+	UpdateWebhook(webhookID int, w UpdateWebhook) error
+	DeleteWebhook(webhookID int) error
+
+	EnqueueDelivery(webhookID int, eventType string, payload []byte, nextAttempt time.Time) (int, error)
+	ClaimDueDeliveries(now time.Time, lease time.Duration, limit int) ([]Delivery, error)
+	RecordAttempt(deliveryID int, a DeliveryAttempt) error
+	GetDelivery(deliveryID int) (*Delivery, error)
+	GetDeliveries(webhookID, limit int) ([]Delivery, error)
+}
+
+// Delivery states. A pending delivery waits for its next attempt; a failed
+// one ran out of attempts.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook sends the events of a group to an outside URL. The secret signs
+// every payload and is only shown when the webhook is created.
+type Webhook struct {
+	ID        int       `json:"webhook_id"`
+	GroupID   int       `json:"group_id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"is_active"`
+	CreatedBy int       `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateWebhook registers a webhook. An empty secret gets a random one.
+type CreateWebhook struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+}
+
+// UpdateWebhook changes the fields that are set.
+type UpdateWebhook struct {
+	URL    *string  `json:"url"`
+	Events []string `json:"events"`
+	Active *bool    `json:"is_active"`
+}
+
+// Delivery is one event on its way to a webhook. URL and Secret come from
+// the webhook when the delivery is claimed for sending.
+type Delivery struct {
+	ID            int        `json:"delivery_id"`
+	WebhookID     int        `json:"webhook_id"`
+	EventType     string     `json:"event_type"`
+	Payload       string     `json:"payload"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	LastAttemptAt *time.Time `json:"last_attempt_at"`
+	ResponseCode  int        `json:"response_code,omitempty"`
+	Error         string     `json:"error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	URL           string     `json:"-"`
+	Secret        string     `json:"-"`
+}
+
+// DeliveryAttempt is the outcome of sending a delivery once. A nil
+// NextAttempt on an undelivered attempt gives the delivery up.
+type DeliveryAttempt struct {
+	At           time.Time
+	ResponseCode int
+	Error        string
+	Delivered    bool
+	NextAttempt  *time.Time
+}